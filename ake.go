@@ -13,7 +13,10 @@ import (
 var dontIgnoreFastRepeatQueryMessage = "false"
 
 type ake struct {
-	secretExponent   *big.Int
+	secretExponent *big.Int
+	// secretExponentMemory holds the words of secretExponent, if it could be allocated
+	secretExponentMemory *SecretBuffer
+
 	ourPublicValue   *big.Int
 	theirPublicValue *big.Int
 
@@ -43,6 +46,7 @@ func (c *Conversation) ensureAKE() {
 }
 
 func (c *Conversation) initAKE() {
+	c.ake.wipe(true)
 	c.ake = &ake{
 		state: authStateNone{},
 	}
@@ -53,7 +57,8 @@ func (c *Conversation) calcAKEKeys(s *big.Int) {
 }
 
 func (c *Conversation) setSecretExponent(val *big.Int) {
-	c.ake.secretExponent = new(big.Int).Set(val)
+	c.ake.wipeSecretExponent()
+	c.ake.secretExponent, c.ake.secretExponentMemory = newSecretInt(new(big.Int).Set(val))
 	c.ake.ourPublicValue = modExp(g1, val)
 }
 
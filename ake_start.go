@@ -0,0 +1,50 @@
+package otr3
+
+var errVersionNotKnown = newOtrError("can't start the AKE before the version of the peer is known")
+var errCantRefreshWithoutEncryption = newOtrError("can't refresh a conversation without a secure conversation established")
+
+// StartAKE starts the authenticated key exchange without sending a query message first, and returns the DH-Commit message to send.
+// This can only be done when the version of the peer is already known, for example from a previous query message or
+// whitespace tag, or from a previous conversation. Otherwise the query message has to be sent instead.
+func (c *Conversation) StartAKE() ([]ValidMessage, error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	return c.startAKE()
+}
+
+// Refresh performs a new authenticated key exchange in a conversation that is already encrypted, and returns the DH-Commit message to send.
+// Messages can still be sent and received with the current keys while the exchange is in progress. When it finishes, the new keys
+// will be used and the security event StillSecure will be signalled. The conversation doesn't leave the encrypted state at any point.
+func (c *Conversation) Refresh() ([]ValidMessage, error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	if c.msgState != encrypted {
+		return nil, errCantRefreshWithoutEncryption
+	}
+
+	return c.startAKE()
+}
+
+func (c *Conversation) startAKE() ([]ValidMessage, error) {
+	if !c.Policies.isOTREnabled() {
+		return nil, errInvalidVersion
+	}
+
+	if c.version == nil {
+		return nil, errVersionNotKnown
+	}
+
+	if err := c.setKeyMatchingVersion(); err != nil {
+		return nil, err
+	}
+
+	ts, err := c.sendDHCommit()
+	toSend, err := c.potentialAuthError(compactMessagesWithHeader(ts), err)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.encodeAndCombine(toSend), nil
+}
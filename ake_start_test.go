@@ -0,0 +1,73 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func Test_StartAKE_returnsADHCommitMessage(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader, version: otrV3{}}
+	alice.Policies = policies(allowV3)
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+
+	bob := &Conversation{Rand: rand.Reader}
+	bob.Policies = policies(allowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	toSend, err := alice.StartAKE()
+	assertNil(t, err)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessDHCommit)
+
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	alice.Receive(toSend[0])
+
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+}
+
+func Test_StartAKE_returnsErrorWhenTheVersionIsNotKnown(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = policies(allowV3)
+
+	_, err := c.StartAKE()
+	assertEquals(t, err, errVersionNotKnown)
+}
+
+func Test_Refresh_returnsErrorWhenNotEncrypted(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+
+	_, err := c.Refresh()
+	assertEquals(t, err, errCantRefreshWithoutEncryption)
+}
+
+func Test_Refresh_performsANewAKEWithoutLeavingTheEncryptedState(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	oldSSID := alice.ssid
+
+	toSend, err := alice.Refresh()
+	assertNil(t, err)
+
+	_, toSend, _ = bob.Receive(toSend[0])
+	assertTrue(t, bob.IsEncrypted())
+	_, toSend, _ = alice.Receive(toSend[0])
+	assertTrue(t, alice.IsEncrypted())
+
+	bob.expectSecurityEvent(t, func() {
+		_, toSend, _ = bob.Receive(toSend[0])
+	}, StillSecure)
+
+	alice.expectSecurityEvent(t, func() {
+		alice.Receive(toSend[0])
+	}, StillSecure)
+
+	assertTrue(t, alice.IsEncrypted())
+	assertEquals(t, alice.ssid, bob.ssid)
+	assertTrue(t, alice.ssid != oldSSID)
+
+	msg, _ := alice.Send(ValidMessage("hello"))
+	plain, _, err := bob.Receive(msg[0])
+	assertNil(t, err)
+	assertEquals(t, string(plain), "hello")
+}
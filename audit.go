@@ -0,0 +1,262 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/coyim/gotrax"
+)
+
+// AuditEvent is the kind of security relevant transition recorded in an audit log
+type AuditEvent int
+
+const (
+	// AuditAKEStarted is recorded when we start an AKE, or answer one started by the peer
+	AuditAKEStarted AuditEvent = iota
+	// AuditAKEFinished is recorded when an AKE has finished and the conversation is encrypted.
+	// The record contains the version chosen, both fingerprints and the SSID.
+	AuditAKEFinished
+	// AuditSMPFinished is recorded when an SMP exchange finishes. The record contains the SMP event that finished it.
+	AuditSMPFinished
+	// AuditEnded is recorded when we end the conversation
+	AuditEnded
+	// AuditDisconnectReceived is recorded when the peer tells us it has ended the conversation
+	AuditDisconnectReceived
+	// AuditMessageMalformed is recorded when we receive a malformed message
+	AuditMessageMalformed
+	// AuditMessageUnreadable is recorded when we receive an encrypted message we can't read
+	AuditMessageUnreadable
+)
+
+// String returns the string representation of the AuditEvent
+func (e AuditEvent) String() string {
+	switch e {
+	case AuditAKEStarted:
+		return "AuditAKEStarted"
+	case AuditAKEFinished:
+		return "AuditAKEFinished"
+	case AuditSMPFinished:
+		return "AuditSMPFinished"
+	case AuditEnded:
+		return "AuditEnded"
+	case AuditDisconnectReceived:
+		return "AuditDisconnectReceived"
+	case AuditMessageMalformed:
+		return "AuditMessageMalformed"
+	case AuditMessageUnreadable:
+		return "AuditMessageUnreadable"
+	default:
+		return "AUDIT EVENT: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// AuditRecord is an entry in an audit log. It never contains plaintext or secrets - the SSID is meant to be compared
+// with the peer over another channel, and fingerprints are public. Fields that don't apply to the event are left empty.
+// Every record contains the hash of the record before it, so that a log can't be changed without it being noticed.
+type AuditRecord struct {
+	// Sequence is the position of the record in the log, starting at zero
+	Sequence uint64
+	Time     time.Time
+	Event    AuditEvent
+
+	// Version is the OTR protocol version used, or zero before one has been chosen
+	Version          uint16
+	OurInstanceTag   uint32
+	TheirInstanceTag uint32
+	OurFingerprint   []byte
+	TheirFingerprint []byte
+	SSID             []byte
+	SMPEvent         SMPEvent
+	// Detail describes the event further, like the error that made a message unreadable
+	Detail string
+
+	// PreviousHash is the Hash of the record before, or all zeroes for the first record
+	PreviousHash []byte
+	// Hash is the SHA-256 hash of all the other fields
+	Hash []byte
+}
+
+// AuditHead identifies the last record of an audit log. Stored separately from the log, it makes it possible
+// to notice when records have been removed from the end of the log.
+type AuditHead struct {
+	Sequence uint64
+	Hash     []byte
+}
+
+// AuditSink stores audit records
+type AuditSink interface {
+	// AppendAuditRecord stores the record after all the records stored before it. Records must never be changed or reordered.
+	// It is called while the conversation recording the event and the audit log are locked, so it must not call methods of either.
+	AppendAuditRecord(r AuditRecord) error
+}
+
+// AuditLog hash-chains the audit records of conversations and appends them to a sink. The same log can be given
+// to several conversations, and it is safe for concurrent use.
+//
+// A record the sink fails to store is left out of the chain, and the next record follows the last one stored, so the
+// chain still verifies but has a gap nothing in it points to. The conversation that recorded the event signals the
+// failure with MessageEventAuditLogFailure, and Err returns the first one.
+type AuditLog struct {
+	lock     sync.Mutex
+	sink     AuditSink
+	next     uint64
+	lastHash []byte
+	err      error
+}
+
+// NewAuditLog returns a log that starts a new chain of records in sink
+func NewAuditLog(sink AuditSink) *AuditLog {
+	return &AuditLog{sink: sink, lastHash: make([]byte, sha256.Size)}
+}
+
+// ResumeAuditLog returns a log that continues a chain of records in sink, after the head given
+func ResumeAuditLog(sink AuditSink, head AuditHead) *AuditLog {
+	return &AuditLog{sink: sink, next: head.Sequence + 1, lastHash: makeCopy(head.Hash)}
+}
+
+// Head returns the last record appended to the log, and false if there is none
+func (l *AuditLog) Head() (AuditHead, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.next == 0 {
+		return AuditHead{}, false
+	}
+	return AuditHead{Sequence: l.next - 1, Hash: makeCopy(l.lastHash)}, true
+}
+
+// Err returns the first error returned by the sink, if any
+func (l *AuditLog) Err() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.err
+}
+
+func (l *AuditLog) append(r AuditRecord) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	r.Sequence = l.next
+	r.PreviousHash = makeCopy(l.lastHash)
+	r.Hash = r.computeHash()
+
+	if err := l.sink.AppendAuditRecord(r); err != nil {
+		if l.err == nil {
+			l.err = err
+		}
+		return err
+	}
+
+	l.next++
+	l.lastHash = r.Hash
+	return nil
+}
+
+func (r *AuditRecord) computeHash() []byte {
+	var out []byte
+	out = gotrax.AppendLong(out, r.Sequence)
+	out = gotrax.AppendLong(out, uint64(r.Time.UnixNano()))
+	out = gotrax.AppendWord(out, uint32(r.Event))
+	out = gotrax.AppendShort(out, r.Version)
+	out = gotrax.AppendWord(out, r.OurInstanceTag)
+	out = gotrax.AppendWord(out, r.TheirInstanceTag)
+	out = gotrax.AppendData(out, r.OurFingerprint)
+	out = gotrax.AppendData(out, r.TheirFingerprint)
+	out = gotrax.AppendData(out, r.SSID)
+	out = gotrax.AppendWord(out, uint32(r.SMPEvent))
+	out = gotrax.AppendData(out, []byte(r.Detail))
+	out = gotrax.AppendData(out, r.PreviousHash)
+
+	sum := sha256.Sum256(out)
+	return sum[:]
+}
+
+// VerifyAuditLog checks that records are a complete audit log that hasn't been changed. If head is given, it also checks
+// that no records have been removed from the end of the log. It returns an error describing the first problem found.
+func VerifyAuditLog(records []AuditRecord, head *AuditHead) error {
+	previous := make([]byte, sha256.Size)
+
+	for i, r := range records {
+		if r.Sequence != uint64(i) {
+			return newOtrErrorf("audit record %d has sequence number %d", i, r.Sequence)
+		}
+		if !bytes.Equal(r.PreviousHash, previous) {
+			return newOtrErrorf("audit record %d doesn't follow the record before it", i)
+		}
+		if !bytes.Equal(r.Hash, r.computeHash()) {
+			return newOtrErrorf("audit record %d has been changed", i)
+		}
+		previous = r.Hash
+	}
+
+	if head == nil {
+		return nil
+	}
+
+	if len(records) == 0 || records[len(records)-1].Sequence != head.Sequence {
+		return newOtrErrorf("audit log doesn't end at record %d", head.Sequence)
+	}
+	if !bytes.Equal(previous, head.Hash) {
+		return newOtrError("audit log doesn't end with the expected record")
+	}
+
+	return nil
+}
+
+// SetAuditLog sets the log that security relevant transitions of the conversation are recorded in
+func (c *Conversation) SetAuditLog(l *AuditLog) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	c.auditLog = l
+}
+
+// audit records the event with the version and instance tags of the conversation
+func (c *Conversation) audit(e AuditEvent, f func(*AuditRecord)) {
+	if c.auditLog == nil {
+		return
+	}
+
+	r := AuditRecord{
+		Time:             c.now(),
+		Event:            e,
+		OurInstanceTag:   c.ourInstanceTag,
+		TheirInstanceTag: c.theirInstanceTag,
+	}
+	if c.version != nil {
+		r.Version = c.version.protocolVersion()
+	}
+	if f != nil {
+		f(&r)
+	}
+
+	if err := c.auditLog.append(r); err != nil {
+		c.messageEventWithError(MessageEventAuditLogFailure, err)
+	}
+}
+
+func (c *Conversation) auditAKEFinished() {
+	c.audit(AuditAKEFinished, func(r *AuditRecord) {
+		if c.ourCurrentKey != nil {
+			r.OurFingerprint = c.ourCurrentKey.PublicKey().Fingerprint()
+		}
+		r.TheirFingerprint, _ = c.theirFingerprint()
+		r.SSID = makeCopy(c.ssid[:])
+	})
+}
+
+func (c *Conversation) auditSMPFinished(e SMPEvent) {
+	c.audit(AuditSMPFinished, func(r *AuditRecord) {
+		r.TheirFingerprint, _ = c.theirFingerprint()
+		r.SMPEvent = e
+	})
+}
+
+func (c *Conversation) auditWithDetail(e AuditEvent, detail string) {
+	c.audit(e, func(r *AuditRecord) {
+		r.Detail = detail
+	})
+}
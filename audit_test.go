@@ -0,0 +1,280 @@
+package otr3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type memoryAuditSink struct {
+	records []AuditRecord
+	err     error
+}
+
+func (s *memoryAuditSink) AppendAuditRecord(r AuditRecord) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memoryAuditSink) events() []AuditEvent {
+	var ret []AuditEvent
+	for _, r := range s.records {
+		ret = append(ret, r.Event)
+	}
+	return ret
+}
+
+func fixtureAuditLog() (*AuditLog, *memoryAuditSink) {
+	sink := &memoryAuditSink{}
+	l := NewAuditLog(sink)
+	c := &Conversation{version: otrV3{}, ourInstanceTag: 0x101, theirInstanceTag: 0x102}
+	c.SetClock(&fixedClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)})
+	c.auditLog = l
+
+	c.auditWithDetail(AuditAKEStarted, "initiated")
+	c.audit(AuditAKEFinished, func(r *AuditRecord) { r.SSID = []byte{1, 2, 3, 4, 5, 6, 7, 8} })
+	c.auditSMPFinished(SMPEventSuccess)
+	c.audit(AuditEnded, nil)
+
+	return l, sink
+}
+
+func Test_AuditEvent_String(t *testing.T) {
+	assertEquals(t, AuditAKEStarted.String(), "AuditAKEStarted")
+	assertEquals(t, AuditAKEFinished.String(), "AuditAKEFinished")
+	assertEquals(t, AuditSMPFinished.String(), "AuditSMPFinished")
+	assertEquals(t, AuditEnded.String(), "AuditEnded")
+	assertEquals(t, AuditDisconnectReceived.String(), "AuditDisconnectReceived")
+	assertEquals(t, AuditMessageMalformed.String(), "AuditMessageMalformed")
+	assertEquals(t, AuditMessageUnreadable.String(), "AuditMessageUnreadable")
+	assertEquals(t, AuditEvent(100).String(), "AUDIT EVENT: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_AuditLog_chainsTheRecords(t *testing.T) {
+	l, sink := fixtureAuditLog()
+
+	assertEquals(t, len(sink.records), 4)
+	assertDeepEquals(t, sink.records[0].PreviousHash, make([]byte, 32))
+	for i, r := range sink.records {
+		assertEquals(t, r.Sequence, uint64(i))
+		if i > 0 {
+			assertDeepEquals(t, r.PreviousHash, sink.records[i-1].Hash)
+		}
+	}
+
+	head, ok := l.Head()
+	assertTrue(t, ok)
+	assertDeepEquals(t, head, AuditHead{Sequence: 3, Hash: sink.records[3].Hash})
+	assertEquals(t, sink.records[0].Version, uint16(3))
+	assertEquals(t, sink.records[0].TheirInstanceTag, uint32(0x102))
+}
+
+func Test_AuditLog_Head_returnsFalseForAnEmptyLog(t *testing.T) {
+	_, ok := NewAuditLog(&memoryAuditSink{}).Head()
+	assertFalse(t, ok)
+}
+
+func Test_AuditLog_keepsTheFirstSinkErrorAndDoesntChainTheRecord(t *testing.T) {
+	diskFull := errors.New("disk full")
+	sink := &memoryAuditSink{err: diskFull}
+	l := NewAuditLog(sink)
+	c := &Conversation{auditLog: l}
+
+	c.audit(AuditEnded, nil)
+	sink.err = nil
+	c.audit(AuditEnded, nil)
+
+	assertEquals(t, l.Err(), diskFull)
+	assertEquals(t, sink.records[0].Sequence, uint64(0))
+	assertNil(t, VerifyAuditLog(sink.records, nil))
+}
+
+func Test_ResumeAuditLog_continuesTheChain(t *testing.T) {
+	l, sink := fixtureAuditLog()
+	head, _ := l.Head()
+
+	resumed := ResumeAuditLog(sink, head)
+	c := &Conversation{auditLog: resumed}
+	c.audit(AuditDisconnectReceived, nil)
+
+	newHead, _ := resumed.Head()
+	assertNil(t, VerifyAuditLog(sink.records, &newHead))
+}
+
+func Test_VerifyAuditLog_acceptsAnUnchangedLog(t *testing.T) {
+	l, sink := fixtureAuditLog()
+	head, _ := l.Head()
+
+	assertNil(t, VerifyAuditLog(sink.records, nil))
+	assertNil(t, VerifyAuditLog(sink.records, &head))
+}
+
+func Test_VerifyAuditLog_acceptsAnEmptyLog(t *testing.T) {
+	assertNil(t, VerifyAuditLog(nil, nil))
+}
+
+func Test_VerifyAuditLog_detectsAChangedRecord(t *testing.T) {
+	_, sink := fixtureAuditLog()
+	sink.records[2].SMPEvent = SMPEventFailure
+
+	assertEquals(t, VerifyAuditLog(sink.records, nil), newOtrError("audit record 2 has been changed"))
+}
+
+func Test_VerifyAuditLog_detectsAChangedTime(t *testing.T) {
+	_, sink := fixtureAuditLog()
+	sink.records[1].Time = sink.records[1].Time.Add(time.Second)
+
+	assertEquals(t, VerifyAuditLog(sink.records, nil), newOtrError("audit record 1 has been changed"))
+}
+
+func Test_VerifyAuditLog_detectsARecordWithItsHashRecomputed(t *testing.T) {
+	_, sink := fixtureAuditLog()
+	sink.records[1].Detail = "forged"
+	sink.records[1].Hash = sink.records[1].computeHash()
+
+	assertEquals(t, VerifyAuditLog(sink.records, nil), newOtrError("audit record 2 doesn't follow the record before it"))
+}
+
+func Test_VerifyAuditLog_detectsARemovedRecord(t *testing.T) {
+	_, sink := fixtureAuditLog()
+	records := append(sink.records[:1:1], sink.records[2:]...)
+
+	assertEquals(t, VerifyAuditLog(records, nil), newOtrError("audit record 1 has sequence number 2"))
+}
+
+func Test_VerifyAuditLog_detectsReorderedRecords(t *testing.T) {
+	_, sink := fixtureAuditLog()
+	sink.records[1], sink.records[2] = sink.records[2], sink.records[1]
+
+	assertEquals(t, VerifyAuditLog(sink.records, nil), newOtrError("audit record 1 has sequence number 2"))
+}
+
+func Test_VerifyAuditLog_detectsALogMissingItsStart(t *testing.T) {
+	_, sink := fixtureAuditLog()
+
+	assertEquals(t, VerifyAuditLog(sink.records[1:], nil), newOtrError("audit record 0 has sequence number 1"))
+}
+
+func Test_VerifyAuditLog_detectsTruncationWithTheHead(t *testing.T) {
+	l, sink := fixtureAuditLog()
+	head, _ := l.Head()
+
+	assertNil(t, VerifyAuditLog(sink.records[:2], nil))
+	assertEquals(t, VerifyAuditLog(sink.records[:2], &head), newOtrError("audit log doesn't end at record 3"))
+	assertEquals(t, VerifyAuditLog(nil, &head), newOtrError("audit log doesn't end at record 3"))
+}
+
+func Test_VerifyAuditLog_detectsALogEndingWithADifferentRecord(t *testing.T) {
+	l, sink := fixtureAuditLog()
+	head, _ := l.Head()
+	head.Hash = make([]byte, 32)
+
+	assertEquals(t, VerifyAuditLog(sink.records, &head), newOtrError("audit log doesn't end with the expected record"))
+}
+
+func Test_Conversation_signalsAnAuditLogFailure(t *testing.T) {
+	diskFull := errors.New("disk full")
+	c := &Conversation{auditLog: NewAuditLog(&memoryAuditSink{err: diskFull})}
+
+	var event MessageEvent = -1
+	var eventErr error
+	c.SetMessageEventHandler(dynamicMessageEventHandler{func(e MessageEvent, message []byte, err error, trace ...interface{}) {
+		event, eventErr = e, err
+	}})
+
+	c.audit(AuditEnded, nil)
+
+	assertEquals(t, event, MessageEventAuditLogFailure)
+	assertEquals(t, eventErr, diskFull)
+}
+
+func Test_Conversation_auditsADataMessageReceivedWhenNotInPrivate(t *testing.T) {
+	sink := &memoryAuditSink{}
+	alice, bob := fixtureAuditedConversations(NewAuditLog(sink))
+
+	msgs, _ := alice.Send(ValidMessage("hello"))
+	bob.End()
+	bob.Receive(msgs[0])
+
+	r := sink.records[len(sink.records)-1]
+	assertEquals(t, r.Event, AuditMessageUnreadable)
+	assertEquals(t, r.Detail, errMessageNotInPrivate.Error())
+}
+
+func Test_Conversation_auditsAFullConversation(t *testing.T) {
+	sink := &memoryAuditSink{}
+	l := NewAuditLog(sink)
+
+	alice, bob := fixtureAuditedConversations(l)
+	aliceFingerprint := alice.ourCurrentKey.PublicKey().Fingerprint()
+	bobFingerprint := bob.ourCurrentKey.PublicKey().Fingerprint()
+
+	msgs, _ := alice.Send(ValidMessage("a very secret message"))
+	bob.Receive(msgs[0])
+
+	msgs, _ = alice.StartAuthenticate("", []byte("a very secret secret"))
+	_, msgs, _ = bob.Receive(msgs[0])
+	msgs, _ = bob.ProvideAuthenticationSecret([]byte("a very secret secret"))
+	_, msgs, _ = alice.Receive(msgs[0])
+	_, msgs, _ = bob.Receive(msgs[0])
+	alice.Receive(msgs[0])
+
+	header, _ := alice.messageHeader(msgTypeData)
+	bob.Receive(ValidMessage(alice.encode(append(header, 0x00, 0x01))))
+
+	msgs, _ = alice.End()
+	bob.Receive(msgs[0])
+
+	assertDeepEquals(t, sink.events(), []AuditEvent{
+		AuditAKEStarted, AuditAKEStarted, AuditAKEFinished, AuditAKEFinished,
+		AuditSMPFinished, AuditSMPFinished,
+		AuditMessageMalformed,
+		AuditEnded, AuditDisconnectReceived,
+	})
+
+	assertEquals(t, sink.records[0].Detail, "initiated")
+	assertEquals(t, sink.records[1].Detail, "answered")
+
+	aliceFinished, bobFinished := sink.records[2], sink.records[3]
+	assertEquals(t, aliceFinished.Version, uint16(3))
+	assertDeepEquals(t, aliceFinished.OurFingerprint, aliceFingerprint)
+	assertDeepEquals(t, aliceFinished.TheirFingerprint, bobFingerprint)
+	assertDeepEquals(t, bobFinished.OurFingerprint, bobFingerprint)
+	assertDeepEquals(t, aliceFinished.SSID, alice.ssid[:])
+	assertDeepEquals(t, bobFinished.SSID, alice.ssid[:])
+
+	assertEquals(t, sink.records[4].SMPEvent, SMPEventSuccess)
+	assertEquals(t, sink.records[5].SMPEvent, SMPEventSuccess)
+
+	head, _ := l.Head()
+	assertNil(t, VerifyAuditLog(sink.records, &head))
+
+	for _, r := range sink.records {
+		assertFalse(t, bytes.Contains([]byte(fmt.Sprintf("%#v", r)), []byte("very secret")))
+	}
+}
+
+func fixtureAuditedConversations(l *AuditLog) (alice, bob *Conversation) {
+	alice = &Conversation{Rand: NewInsecureDeterministicRand([]byte("alice"))}
+	alice.Policies = policies(allowV3)
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.SetAuditLog(l)
+
+	bob = &Conversation{Rand: NewInsecureDeterministicRand([]byte("bob"))}
+	bob.Policies = policies(allowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.SetAuditLog(l)
+
+	_, toSend, _ := bob.Receive(alice.QueryMessage())
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, toSend, _ = alice.Receive(toSend[0])
+	bob.Receive(toSend[0])
+
+	return alice, bob
+}
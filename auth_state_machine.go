@@ -2,7 +2,6 @@ package otr3
 
 import (
 	"bytes"
-	"time"
 
 	"github.com/coyim/gotrax"
 )
@@ -19,8 +18,9 @@ func (c *Conversation) akeHasFinished() error {
 	c.ake.wipe(false)
 
 	previousMsgState := c.msgState
-	c.lastMessageStateChange = time.Now()
+	c.lastMessageStateChange = c.now()
 	c.msgState = encrypted
+	c.auditAKEFinished()
 	defer c.signalSecurityEventIf(previousMsgState != encrypted, GoneSecure)
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, StillSecure)
 
@@ -52,7 +52,7 @@ func (c *Conversation) processAKE(msgType byte, msg []byte) (toSend []messageWit
 		err = newOtrErrorf("unknown message type 0x%X", msgType)
 	}
 
-	c.ake.lastStateChange = time.Now()
+	c.ake.lastStateChange = c.now()
 
 	messages := append([]messageWithHeader{toSendSingle}, toSendExtra...)
 	toSend = compactMessagesWithHeader(messages...)
@@ -100,6 +100,7 @@ func (s authStateNone) receiveDHCommitMessage(c *Conversation, msg []byte) (auth
 		return s, nil, err
 	}
 
+	c.auditWithDetail(AuditAKEStarted, "answered")
 	return authStateAwaitingRevealSig{}, dhKeyMsg, nil
 }
 
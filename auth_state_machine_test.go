@@ -3,6 +3,7 @@ package otr3
 import (
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/coyim/gotrax"
 )
@@ -338,8 +339,8 @@ func Test_receiveDecoded_receiveRevealSigMessageAndSetMessageStateToEncrypted(t
 
 func Test_receiveDecoded_receiveRevealSigMessageWillResendPotentialLastMessage(t *testing.T) {
 	c := aliceContextAtAwaitingRevealSig()
-	c.resend.later(MessagePlaintext("what do you think turn 2"))
-	c.resend.later(MessagePlaintext("I mean, about that thing"))
+	c.resend.later(time.Now(), MessagePlaintext("what do you think turn 2"), SendOptions{})
+	c.resend.later(time.Now(), MessagePlaintext("I mean, about that thing"), SendOptions{})
 	c.resend.mayRetransmit = retransmitWithPrefix
 	c.updateLastSent()
 	msg := fixtureRevealSigMsg(otrV2{})
@@ -405,8 +406,8 @@ func Test_receiveDecoded_receiveSigMessageAndSetMessageStateToEncrypted(t *testi
 
 func Test_receiveDecoded_receiveSigMessageWillResendTheLastPotentialMessage(t *testing.T) {
 	c := bobContextAtAwaitingSig()
-	c.resend.later(MessagePlaintext("what do you think"))
-	c.resend.later(MessagePlaintext("you think, dont you?"))
+	c.resend.later(time.Now(), MessagePlaintext("what do you think"), SendOptions{})
+	c.resend.later(time.Now(), MessagePlaintext("you think, dont you?"), SendOptions{})
 	c.resend.mayRetransmit = retransmitWithPrefix
 	c.updateLastSent()
 
@@ -4,13 +4,35 @@ package otr3
 // The authentication uses an optional question message and a shared secret. The authentication will proceed
 // until the event handler reports that SMP is complete, that a secret is needed or that SMP has failed.
 func (c *Conversation) StartAuthenticate(question string, mutualSecret []byte) ([]ValidMessage, error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	return c.startAuthenticate(question, mutualSecret)
+}
+
+func (c *Conversation) startAuthenticate(question string, mutualSecret []byte) ([]ValidMessage, error) {
 	c.smp.ensureSMP()
 
-	tlvs, err := c.smp.state.startAuthenticate(c, question, mutualSecret)
+	if !c.IsEncrypted() {
+		return nil, errCantAuthenticateWithoutEncryption
+	}
+
+	normalizedSecret := normalizeSecret(c.smp.ourNormalization, mutualSecret)
+
+	// The secret as it was typed is used unless the peer acknowledges the normalization
+	sm := c.smpEngine()
+	tlvs, err := sm.state.startAuthenticate(sm, question, mutualSecret)
+	c.updateSMPTimeout()
 
 	if err != nil {
 		return nil, err
 	}
+	c.smpAttemptStarted()
+
+	c.smp.forgetNormalizedSecret()
+	if c.smp.ourNormalization != 0 {
+		tlvs = c.offerNormalization(tlvs, normalizedSecret)
+	}
 
 	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, tlvs)
 	return msgs, err
@@ -19,19 +41,48 @@ func (c *Conversation) StartAuthenticate(question string, mutualSecret []byte) (
 // ProvideAuthenticationSecret should be called when the peer has started an authentication request, and the UI has been notified that a secret is needed
 // It is only valid to call this function if the current SMP state is waiting for a secret to be provided. The return is the potential messages to send.
 func (c *Conversation) ProvideAuthenticationSecret(mutualSecret []byte) ([]ValidMessage, error) {
-	t, err := c.continueSMP(mutualSecret)
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	return c.provideAuthenticationSecret(mutualSecret)
+}
+
+func (c *Conversation) provideAuthenticationSecret(mutualSecret []byte) ([]ValidMessage, error) {
+	if !c.IsEncrypted() {
+		c.smp.restartSMP()
+		c.updateSMPTimeout()
+		return nil, errCantAuthenticateWithoutEncryption
+	}
+
+	t, err := c.smpEngine().continueSMP(normalizeSecret(c.smp.normalization, mutualSecret))
+	c.updateSMPTimeout()
 	if err != nil {
 		return nil, err
 	}
 
-	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{*t})
+	tlvs := []tlv{*t}
+	if c.smp.normalization != 0 {
+		tlvs = c.acceptNormalization(tlvs)
+	}
+
+	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, tlvs)
 	return msgs, err
 }
 
 // AbortAuthentication should be called when the user wants to abort authentication with a peer.
 // It will return an SMP abort message to send.
 func (c *Conversation) AbortAuthentication() ([]ValidMessage, error) {
-	t := c.restartSMP()
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	return c.abortAuthentication()
+}
+
+func (c *Conversation) abortAuthentication() ([]ValidMessage, error) {
+	t := c.smp.restartSMP()
+	c.smp.forgetNormalizedSecret()
+	c.updateSMPTimeout()
+	c.authenticationFinished(SMPEventAbort)
 
 	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{t})
 	return msgs, err
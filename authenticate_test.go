@@ -47,7 +47,7 @@ func Test_StartAuthenticate_generatesAndReturnsTheFirstSMPMessageToSend(t *testi
 
 	dec, _ := c.decode(encodedMessage(msg[0]))
 	_, messageBody, _ := c.parseMessageHeader(dec)
-	assertDeepEquals(t, len(messageBody), 1361)
+	assertDeepEquals(t, len(messageBody), 1265)
 }
 
 func Test_StartAuthenticate_generatesAndSetsTheFirstMessageOnTheConversation(t *testing.T) {
@@ -94,7 +94,7 @@ func Test_StartAuthenticate_generatesAnAbortMessageTLVIfWeAreInAnSMPStateAlready
 	assertEquals(t, e, nil)
 	dec, _ := c.decode(encodedMessage(msg[0]))
 	_, messageBody, _ := c.parseMessageHeader(dec)
-	assertDeepEquals(t, len(messageBody), 1369)
+	assertDeepEquals(t, len(messageBody), 1265)
 }
 
 func Test_ProvideAuthenticationSecret_failsIfWeAreNotCurrentlyEncrypted(t *testing.T) {
@@ -146,7 +146,7 @@ func Test_ProvideAuthenticationSecret_continuesWithMessageProcessingIfInTheRight
 	assertNil(t, e)
 	dec, _ := c.decode(encodedMessage(msg[0]))
 	_, messageBody, _ := c.parseMessageHeader(dec)
-	assertDeepEquals(t, len(messageBody), 2181)
+	assertDeepEquals(t, len(messageBody), 2033)
 }
 
 func Test_ProvideAuthenticationSecret_setsTheNextMessageState(t *testing.T) {
@@ -189,7 +189,7 @@ func Test_AbortAuthentication_generatesSMPAbortMessage(t *testing.T) {
 	assertNil(t, e)
 	dec, _ := c.decode(encodedMessage(msgs[0]))
 	_, messageBody, _ := c.parseMessageHeader(dec)
-	assertEquals(t, len(messageBody), 505)
+	assertEquals(t, len(messageBody), 497)
 }
 
 func Test_AbortAuthentication_generatesErrorWhenNoEncryptedChannelExists(t *testing.T) {
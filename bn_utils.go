@@ -2,8 +2,9 @@ package otr3
 
 import "math/big"
 
+// modExp returns g^x mod p in constant time, see montgomeryField
 func modExp(g, x *big.Int) *big.Int {
-	return new(big.Int).Exp(g, x, p)
+	return pField.exp(g, x)
 }
 
 func modInverse(g, x *big.Int) *big.Int {
@@ -19,6 +20,10 @@ func sub(l, r *big.Int) *big.Int {
 }
 
 func mulMod(l, r, m *big.Int) *big.Int {
+	if f := fieldFor(m); f != nil {
+		return f.mul(l, r)
+	}
+
 	res := mul(l, r)
 	res.Mod(res, m)
 	return res
@@ -26,10 +31,18 @@ func mulMod(l, r, m *big.Int) *big.Int {
 
 // Fast division over a modular field, without using division
 func divMod(l, r, m *big.Int) *big.Int {
+	if f := fieldFor(m); f != nil {
+		return f.div(l, r)
+	}
+
 	return mulMod(l, modInverse(r, m), m)
 }
 
 func subMod(l, r, m *big.Int) *big.Int {
+	if f := fieldFor(m); f != nil {
+		return f.sub(l, r)
+	}
+
 	res := sub(l, r)
 	res.Mod(res, m)
 	return res
@@ -0,0 +1,30 @@
+package otr3
+
+import "time"
+
+// Clock tells the current time. A conversation uses it to decide when its timers are due.
+type Clock interface {
+	// Now returns the current time.
+	// It is called while the conversation is locked, so it must not call methods of the conversation.
+	Now() time.Time
+}
+
+type dynamicClock struct {
+	now func() time.Time
+}
+
+func (d dynamicClock) Now() time.Time {
+	return d.now()
+}
+
+// SetClock sets the clock used by the timers of the conversation. By default, the system clock is used.
+func (c *Conversation) SetClock(clock Clock) {
+	c.clock = clock
+}
+
+func (c *Conversation) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
@@ -2,6 +2,7 @@ package otr3
 
 import (
 	"io"
+	"sync"
 	"time"
 )
 
@@ -20,8 +21,21 @@ var (
 )
 
 // Conversation contains all the information for a specific connection between two peers in an IM system.
-// Policies are not supposed to change once a conversation has been used
+// Policies are not supposed to change once a conversation has been used.
+//
+// The methods that create or process messages are serialized by a lock, so that streams can be used from other goroutines.
+// The handlers that are only told about something, like the MessageEventHandler, SMPEventHandler, SecurityEventHandler,
+// PeerErrorHandler, QueuedMessageHandler, ReceiptHandler, ExpiredMessageHandler, StreamHandler and the ReceivedKeyHandlers,
+// are called after the lock has been released, in the order the events happened, right before the method that caused them
+// returns. They can call any method of the conversation. Everything else the application provides is called while the conversation is locked,
+// because the library needs its answer to continue, and must not call methods of the conversation: the ErrorMessageHandler,
+// the TLVHandlers, the MaxMessageSizeFunc, the PaddingStrategy, the Clock, the AuditSink of the audit log and the MessageSink
+// of streams.
 type Conversation struct {
+	lock            sync.Mutex
+	delayHandlers   bool
+	delayedHandlers []func()
+
 	version otrVersion
 	Rand    io.Reader
 
@@ -45,20 +59,48 @@ type Conversation struct {
 	heartbeat  heartbeatContext
 	resend     resendContext
 	injections injections
+	customTLVs customTLVs
+	streams    streams
+	receipts   receiptsContext
+	retention  retentionContext
+	timers     timers
+	clock      Clock
 
 	fragmentSize         uint16
+	maxMessageSize       MaxMessageSizeFunc
+	messageSizeUnit      SizeUnit
 	fragmentationContext fragmentationContext
+	paddingStrategy      PaddingStrategy
+	inputLimits          Limits
+	smpAttempts          SMPAttempts
+	smpAttemptLimit      SMPAttemptLimit
+	smpAttemptTracker    *SMPAttemptTracker
+
+	randomness                    *healthTestedRandom
+	randomnessHealthTestsDisabled bool
+	auditLog                      *AuditLog
 
 	smpEventHandler      SMPEventHandler
 	errorMessageHandler  ErrorMessageHandler
 	messageEventHandler  MessageEventHandler
 	securityEventHandler SecurityEventHandler
 	receivedKeyHandler   ReceivedKeyHandler
+	queuedMessageHandler QueuedMessageHandler
+	receiptHandler       ReceiptHandler
+	peerErrorHandler     PeerErrorHandler
+
+	expiredMessageHandler ExpiredMessageHandler
+
+	receivedKeyUsageHandlers map[uint32]ReceivedKeyHandler
 
 	debug         bool
 	sentRevealSig bool
 
+	receivedMetadata MessageMetadata
+	sentMetadata     MessageMetadata
+
 	friendlyQueryMessage string
+	queryIgnoreWindow    time.Duration
 }
 
 // NewConversationWithVersion creates a new conversation with the given version
@@ -112,15 +154,25 @@ func (c *Conversation) IsEncrypted() bool {
 // End ends a secure conversation by generating a termination message for
 // the peer and switches to unencrypted communication.
 func (c *Conversation) End() (toSend []ValidMessage, err error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
 	previousMsgState := c.msgState
+	c.abortAllStreams()
+	c.dropQueuedMessages()
 	if c.msgState == encrypted {
 		c.smp.wipe()
+		c.authenticationFinished(SMPEventAbort)
 		// Error can only happen when Rand reader is broken
 		toSend, _, err = c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{tlv{tlvType: tlvTypeDisconnected}})
 	}
 	c.lastMessageStateChange = time.Time{}
+	c.ake.wipe(true)
 	c.ake = nil
 	c.msgState = plainText
+	if previousMsgState != plainText {
+		c.audit(AuditEnded, nil)
+	}
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, GoneInsecure)
 
 	c.keys.ourCurrentDHKeys.wipe()
@@ -0,0 +1,33 @@
+package otr3
+
+// lockConversation takes the conversation lock. Every exported method that reads or changes the state of the conversation
+// takes it, since streams are read and written from other goroutines. Until unlockConversation is called, handlers are not
+// called right away but collected: calling them with the lock held would deadlock any handler that answers an event by
+// calling the conversation, like ending it from a security event, and calling them after unlocking halfway through
+// a method would let them see, and change, a half updated state.
+func (c *Conversation) lockConversation() {
+	c.lock.Lock()
+	c.delayHandlers = true
+}
+
+// unlockConversation releases the conversation lock, and then calls the handlers collected while it was held
+func (c *Conversation) unlockConversation() {
+	delayed := c.delayedHandlers
+	c.delayedHandlers = nil
+	c.delayHandlers = false
+	c.lock.Unlock()
+
+	for _, f := range delayed {
+		f()
+	}
+}
+
+// callHandler calls f, which has to call a handler set by the application. If the conversation lock is held,
+// f is called once it has been released.
+func (c *Conversation) callHandler(f func()) {
+	if !c.delayHandlers {
+		f()
+		return
+	}
+	c.delayedHandlers = append(c.delayedHandlers, f)
+}
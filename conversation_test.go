@@ -471,3 +471,22 @@ func Test_Conversation_InitializeInstanceTag_initializesTheInstanceTagFromRandom
 	assertEquals(t, c.ourInstanceTag, uint32(0xabcdabcd))
 	assertEquals(t, ret, uint32(0xabcdabcd))
 }
+
+func Test_Receive_callsHandlersThatCanUseTheConversation(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+
+	var sent []ValidMessage
+	bob.SetSecurityEventHandler(dynamicSecurityEventHandler{func(event SecurityEvent) {
+		if event == GoneInsecure {
+			bob.End()
+			sent, _ = bob.Send(ValidMessage("are you there?"))
+		}
+	}})
+
+	toSend, _ := alice.End()
+	_, _, err := bob.Receive(toSend[0])
+
+	assertNil(t, err)
+	assertFalse(t, bob.IsEncrypted())
+	assertDeepEquals(t, sent, []ValidMessage{ValidMessage("are you there?")})
+}
@@ -0,0 +1,154 @@
+package otr3
+
+import "math"
+
+// TLV is an application defined type/length/value record, carried inside encrypted data messages.
+// The length is implicit in the size of Value, which can be at most 65535 bytes.
+type TLV struct {
+	Type  uint16
+	Value []byte
+}
+
+// TLVHandler is an interface that will be invoked when a TLV that is not handled by the OTR protocol itself is received
+type TLVHandler interface {
+	// HandleTLV is called with the received TLV. If it returns a TLV, that TLV will be sent back to the peer.
+	// Returning an error will make the whole data message be considered malformed.
+	// It is called while the conversation is locked, so it must not call methods of the conversation.
+	HandleTLV(t TLV) (reply *TLV, err error)
+}
+
+type dynamicTLVHandler struct {
+	eh func(t TLV) (*TLV, error)
+}
+
+func (d dynamicTLVHandler) HandleTLV(t TLV) (*TLV, error) {
+	return d.eh(t)
+}
+
+type customTLVs struct {
+	handlers map[uint16]TLVHandler
+	unknown  TLVHandler
+}
+
+var errBuiltinTLVType = newOtrError("TLV type is reserved by the OTR protocol")
+
+// RegisterTLVHandler assigns a handler for received TLVs of the given type.
+// It is not possible to register handlers for the TLV types defined by the OTR protocol (0x0000 to 0x0008),
+// or for the range 0x0100 to 0x01FF, which is reserved for the extensions of otr3.
+// Registering a nil handler removes the handler for that type.
+func (c *Conversation) RegisterTLVHandler(tlvType uint16, handler TLVHandler) error {
+	if isBuiltinTLV(tlvType) {
+		return errBuiltinTLVType
+	}
+
+	if handler == nil {
+		delete(c.customTLVs.handlers, tlvType)
+		return nil
+	}
+
+	if c.customTLVs.handlers == nil {
+		c.customTLVs.handlers = make(map[uint16]TLVHandler)
+	}
+	c.customTLVs.handlers[tlvType] = handler
+	return nil
+}
+
+// SetUnknownTLVHandler assigns a handler that will be called for received TLVs
+// that are neither defined by the OTR protocol, nor in the range reserved for otr3, nor have a registered handler.
+// Without this handler, those TLVs are silently ignored.
+func (c *Conversation) SetUnknownTLVHandler(handler TLVHandler) {
+	c.customTLVs.unknown = handler
+}
+
+func (c *Conversation) customTLVHandler(tlvType uint16) TLVHandler {
+	if h, ok := c.customTLVs.handlers[tlvType]; ok {
+		return h
+	}
+	return c.customTLVs.unknown
+}
+
+func (c *Conversation) processCustomTLV(t tlv) (toSend *tlv, err error) {
+	// A type in the reserved range without a handler comes from a newer version of otr3, and is ignored
+	if isBuiltinTLV(t.tlvType) {
+		return nil, nil
+	}
+
+	h := c.customTLVHandler(t.tlvType)
+	if h == nil {
+		return nil, nil
+	}
+
+	reply, err := h.HandleTLV(t.toTLV())
+	if err != nil || reply == nil {
+		return nil, err
+	}
+
+	if !isValidCustomTLV(*reply) {
+		return nil, errBuiltinTLVType
+	}
+
+	result := fromTLV(*reply)
+	return &result, nil
+}
+
+func isValidCustomTLV(t TLV) bool {
+	return !isBuiltinTLV(t.Type) && len(t.Value) <= math.MaxUint16
+}
+
+func (t tlv) toTLV() TLV {
+	return TLV{Type: t.tlvType, Value: makeCopy(t.tlvValue)}
+}
+
+func fromTLV(t TLV) tlv {
+	return tlv{
+		tlvType:   t.Type,
+		tlvLength: uint16(len(t.Value)),
+		tlvValue:  makeCopy(t.Value),
+	}
+}
+
+// SendWithTLVs works like Send, but also attaches the given application defined TLVs to the data message.
+// TLVs can only be sent in an encrypted conversation. The message can be empty, in which case the data message
+// will be flagged so that the peer doesn't show an error if it can't read it.
+func (c *Conversation) SendWithTLVs(m ValidMessage, tlvs []TLV, trace ...interface{}) ([]ValidMessage, error) {
+	toSend, _, err := c.SendWithOptions(m, SendOptions{TLVs: tlvs}, trace...)
+	return toSend, err
+}
+
+func (c *Conversation) sendWithTLVs(m ValidMessage, opts SendOptions, trace ...interface{}) ([]ValidMessage, error) {
+	ts := make([]tlv, 0, len(opts.TLVs))
+	for _, t := range opts.TLVs {
+		if !isValidCustomTLV(t) {
+			return nil, newOtrErrorf("invalid application TLV of type 0x%04X", t.Type)
+		}
+		ts = append(ts, fromTLV(t))
+	}
+
+	if c.msgState != encrypted {
+		return nil, errCannotSendUnencrypted
+	}
+
+	ts = append(c.outgoingTLVsFor(opts), ts...)
+
+	message := makeCopy(m)
+	defer wipeBytes(message)
+
+	flag := messageFlagNormal
+	if len(message) == 0 {
+		flag = messageFlagIgnoreUnreadable
+	}
+
+	result, _, err := c.createSerializedDataMessage(message, flag, ts)
+	if err != nil {
+		c.messageEvent(MessageEventEncryptionError)
+		c.generatePotentialErrorMessage(ErrorCodeEncryptionError)
+	} else {
+		var id QueuedMessageID
+		if len(message) > 0 {
+			id = c.lastMessage(MessagePlaintext(message), opts, trace...)
+		}
+		c.sentMetadata = c.sentWithRetention(id, opts)
+	}
+
+	return c.withInjections(result, err)
+}
@@ -0,0 +1,174 @@
+package otr3
+
+import "testing"
+
+func Test_RegisterTLVHandler_returnsErrorForBuiltinTLVTypes(t *testing.T) {
+	c := &Conversation{}
+	h := dynamicTLVHandler{func(TLV) (*TLV, error) { return nil, nil }}
+
+	assertEquals(t, c.RegisterTLVHandler(tlvTypePadding, h), errBuiltinTLVType)
+	assertEquals(t, c.RegisterTLVHandler(tlvTypeSMP1WithQuestion, h), errBuiltinTLVType)
+	assertEquals(t, c.RegisterTLVHandler(tlvTypeExtraSymmetricKey, h), errBuiltinTLVType)
+	assertEquals(t, c.RegisterTLVHandler(tlvTypeStreamData, h), errBuiltinTLVType)
+	assertEquals(t, c.RegisterTLVHandler(0x01FF, h), errBuiltinTLVType)
+	assertNil(t, c.RegisterTLVHandler(0x0200, h))
+	assertNil(t, c.RegisterTLVHandler(0x4242, h))
+}
+
+func Test_RegisterTLVHandler_withNilHandlerRemovesTheHandler(t *testing.T) {
+	c := &Conversation{}
+	c.RegisterTLVHandler(0x4242, dynamicTLVHandler{func(TLV) (*TLV, error) { return nil, nil }})
+	c.RegisterTLVHandler(0x4242, nil)
+
+	assertNil(t, c.customTLVHandler(0x4242))
+}
+
+func Test_processTLVs_callsTheRegisteredHandlerForAnApplicationTLV(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	var received TLV
+	c.RegisterTLVHandler(0x4242, dynamicTLVHandler{func(t TLV) (*TLV, error) {
+		received = t
+		return nil, nil
+	}})
+
+	toSend, err := c.processTLVs([]tlv{tlv{tlvType: 0x4242, tlvLength: 2, tlvValue: []byte{0x01, 0x02}}}, dataMessageExtra{})
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertDeepEquals(t, received, TLV{Type: 0x4242, Value: []byte{0x01, 0x02}})
+}
+
+func Test_processTLVs_callsTheUnknownTLVHandlerForUnregisteredTypes(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	var received []uint16
+	c.RegisterTLVHandler(0x4242, dynamicTLVHandler{func(t TLV) (*TLV, error) { return nil, nil }})
+	c.SetUnknownTLVHandler(dynamicTLVHandler{func(t TLV) (*TLV, error) {
+		received = append(received, t.Type)
+		return nil, nil
+	}})
+
+	_, err := c.processTLVs([]tlv{
+		tlv{tlvType: 0x4242, tlvLength: 0, tlvValue: []byte{}},
+		tlv{tlvType: 0x0099, tlvLength: 0, tlvValue: []byte{}},
+	}, dataMessageExtra{})
+
+	assertNil(t, err)
+	assertDeepEquals(t, received, []uint16{0x0099})
+}
+
+func Test_processTLVs_ignoresUnknownTypesInTheReservedRange(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	called := false
+	c.SetUnknownTLVHandler(dynamicTLVHandler{func(t TLV) (*TLV, error) {
+		called = true
+		return nil, nil
+	}})
+
+	_, err := c.processTLVs([]tlv{
+		tlv{tlvType: 0x01F0, tlvLength: 0, tlvValue: []byte{}},
+	}, dataMessageExtra{})
+
+	assertNil(t, err)
+	assertFalse(t, called)
+}
+
+func Test_processTLVs_returnsTheReplyFromAnApplicationTLVHandler(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.RegisterTLVHandler(0x4242, dynamicTLVHandler{func(t TLV) (*TLV, error) {
+		return &TLV{Type: 0x4243, Value: []byte{0xAA}}, nil
+	}})
+
+	toSend, err := c.processTLVs([]tlv{tlv{tlvType: 0x4242, tlvLength: 0, tlvValue: []byte{}}}, dataMessageExtra{})
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []tlv{tlv{tlvType: 0x4243, tlvLength: 1, tlvValue: []byte{0xAA}}})
+}
+
+func Test_processTLVs_doesntAllowAnApplicationTLVHandlerToReplyWithABuiltinTLV(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.SetUnknownTLVHandler(dynamicTLVHandler{func(t TLV) (*TLV, error) {
+		return &TLV{Type: tlvTypeDisconnected}, nil
+	}})
+
+	_, err := c.processTLVs([]tlv{tlv{tlvType: 0x4242, tlvLength: 0, tlvValue: []byte{}}}, dataMessageExtra{})
+
+	assertEquals(t, err, errBuiltinTLVType)
+}
+
+func Test_decideFlagFrom_setsIgnoreUnreadableForApplicationTLVs(t *testing.T) {
+	assertEquals(t, decideFlagFrom([]tlv{tlv{tlvType: 0x4242}}), messageFlagIgnoreUnreadable)
+	assertEquals(t, decideFlagFrom([]tlv{tlv{tlvType: tlvTypeDisconnected}}), messageFlagNormal)
+}
+
+func Test_SendWithTLVs_returnsErrorIfTheConversationIsNotEncrypted(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.msgState = plainText
+
+	_, err := c.SendWithTLVs(ValidMessage("hello"), []TLV{TLV{Type: 0x4242}})
+
+	assertEquals(t, err, errCannotSendUnencrypted)
+}
+
+func Test_SendWithTLVs_returnsErrorForBuiltinTLVs(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+
+	_, err := c.SendWithTLVs(ValidMessage("hello"), []TLV{TLV{Type: tlvTypeSMPAbort}})
+
+	assertDeepEquals(t, err, newOtrError("invalid application TLV of type 0x0006"))
+}
+
+func Test_SendWithTLVs_deliversMessageAndTLVsToThePeer(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	var received []TLV
+	bob.RegisterTLVHandler(0x4242, dynamicTLVHandler{func(t TLV) (*TLV, error) {
+		received = append(received, t)
+		return nil, nil
+	}})
+
+	toSend, err := alice.SendWithTLVs(ValidMessage("hello"), []TLV{TLV{Type: 0x4242, Value: []byte("meta")}})
+	assertNil(t, err)
+
+	plain, _, err := bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertDeepEquals(t, received, []TLV{TLV{Type: 0x4242, Value: []byte("meta")}})
+}
+
+func Test_SendWithOptions_asksForAReceiptTogetherWithTLVs(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+
+	toSend, _, err := alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: "msg-1", TLVs: []TLV{TLV{Type: 0x4242}}})
+	assertNil(t, err)
+
+	plain, meta, _, err := bob.ReceiveWithMetadata(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, meta.ID, MessageID("msg-1"))
+}
+
+func Test_SendWithOptions_returnsErrorForATooLongMessageIDWithTLVs(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	_, _, err := alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: MessageID(make([]byte, maxMessageIDLength+1)), TLVs: []TLV{TLV{Type: 0x4242}}})
+
+	assertEquals(t, err, errMessageIDTooLong)
+}
+
+func Test_SendWithTLVs_setsIgnoreUnreadableWhenThereIsNoMessage(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	toSend, _ := alice.SendWithTLVs(nil, []TLV{TLV{Type: 0x4242}})
+	decoded, _ := alice.decode(encodedMessage(toSend[0]))
+
+	assertEquals(t, decoded[otrv3HeaderLen], messageFlagIgnoreUnreadable)
+}
+
+func Test_SendWithTLVs_doesntSetIgnoreUnreadableWhenThereIsAMessage(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	toSend, _ := alice.SendWithTLVs(ValidMessage("hi"), []TLV{TLV{Type: 0x4242}})
+	decoded, _ := alice.decode(encodedMessage(toSend[0]))
+
+	assertEquals(t, decoded[otrv3HeaderLen], messageFlagNormal)
+}
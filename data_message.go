@@ -1,6 +1,9 @@
 package otr3
 
-import "encoding/binary"
+import (
+	"encoding/base64"
+	"encoding/binary"
+)
 
 type dataMessageExtra struct {
 	key []byte
@@ -19,6 +22,7 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 	if err != nil {
 		return dataMsg{}, dataMessageExtra{}, err
 	}
+	defer keys.destroy()
 
 	topHalfCtr := [8]byte{}
 	counter := c.keys.counterHistory.findCounterFor(c.keys.ourKeyID-1, c.keys.theirKeyID)
@@ -29,13 +33,6 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 	binary.BigEndian.PutUint64(topHalfCtr[:], counter.ourCounter)
 	counter.ourCounter++
 
-	plain := plainDataMsg{
-		message: message,
-		tlvs:    tlvs,
-	}
-
-	encrypted := plain.encrypt(keys.sendingAESKey[:], topHalfCtr)
-
 	header, err := c.messageHeader(msgTypeData)
 	if err != nil {
 		return dataMsg{}, dataMessageExtra{}, err
@@ -47,17 +44,25 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 		recipientKeyID: c.keys.theirKeyID,
 		y:              c.keys.ourCurrentDHKeys.pub,
 		topHalfCtr:     topHalfCtr,
-		encryptedMsg:   encrypted,
-		oldMACKeys:     c.keys.revealMACKeys(),
 	}
 
+	overhead := len(header) + len(dataMessage.serialize(c.version)) + c.version.hashLength() + len(c.keys.oldMACKeys)*c.version.hashLength()
+
+	plain, err := c.padDataMessage(plainDataMsg{message: message, tlvs: tlvs}, overhead)
+	if err != nil {
+		return dataMsg{}, dataMessageExtra{}, err
+	}
+
+	dataMessage.encryptedMsg = plain.encrypt(keys.sendingAESKey[:], topHalfCtr)
+	dataMessage.oldMACKeys = c.keys.revealMACKeys()
+
 	// fmt.Printf("sendingMACKey: len: %d %X\n", len(keys.sendingMACKey), keys.sendingMACKey)
 	dataMessage.sign(keys.sendingMACKey, header, c.version)
 
 	c.updateMayRetransmitTo(noRetransmit)
-	c.lastMessage(message)
 
-	x := dataMessageExtra{keys.extraKey[:]}
+	// The extra key is handed to the user, so it can't stay in the session keys memory
+	x := dataMessageExtra{makeCopy(keys.extraKey)}
 
 	return dataMessage, x, nil
 }
@@ -85,13 +90,18 @@ func (c *Conversation) createSerializedDataMessage(msg []byte, flag byte, tlvs [
 }
 
 func (c *Conversation) fragEncode(msg messageWithHeader) []ValidMessage {
-	return c.fragment(c.encode(msg), c.fragmentSize)
+	return c.fragment(c.encode(msg), c.fragmentSizeLimit())
 }
 
 func (c *Conversation) encode(msg messageWithHeader) encodedMessage {
 	return append(append(msgMarker, b64encode(msg)...), '.')
 }
 
+// encodedLength returns the length of the result of encode for a message of length l
+func encodedLength(l int) int {
+	return len(msgMarker) + base64.StdEncoding.EncodedLen(l) + 1
+}
+
 func (c *Conversation) processDataMessage(header, msg []byte) (plain MessagePlaintext, toSend messageWithHeader, err error) {
 	ignoreUnreadable := (extractDataMessageFlag(msg) & messageFlagIgnoreUnreadable) == messageFlagIgnoreUnreadable
 	plain, toSend, err = c.processDataMessageWithRawErrors(header, msg)
@@ -109,6 +119,7 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 
 	if c.msgState != encrypted {
 		err = errMessageNotInPrivate
+		c.auditWithDetail(AuditMessageUnreadable, err.Error())
 		c.messageEvent(MessageEventReceivedMessageNotInPrivate)
 		return
 	}
@@ -117,6 +128,11 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 		return
 	}
 
+	if !isGroupElement(dataMessage.y) {
+		err = newOtrError("DH value out of range")
+		return
+	}
+
 	if err = c.keys.checkMessageCounter(dataMessage); err != nil {
 		return
 	}
@@ -125,14 +141,18 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 	if err != nil {
 		return
 	}
+	defer sessionKeys.destroy()
 
 	if err = dataMessage.checkSign(sessionKeys.receivingMACKey, header, c.version); err != nil {
 		return
 	}
 
 	p := plainDataMsg{}
-	//this can't return an error since receivingAESKey is a AES-128 key
-	p.decrypt(sessionKeys.receivingAESKey[:], dataMessage.topHalfCtr, dataMessage.encryptedMsg)
+	// The only error possible is having too many TLVs, since receivingAESKey is an AES-128 key
+	if err = p.decrypt(sessionKeys.receivingAESKey[:], dataMessage.topHalfCtr, dataMessage.encryptedMsg, c.limits().MaxTLVs); err != nil {
+		err = c.exceededLimits(err)
+		return
+	}
 
 	plain = makeCopy(p.message)
 	if len(plain) == 0 {
@@ -147,7 +167,7 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 
 	var tlvs []tlv
 
-	tlvs, err = c.processTLVs(p.tlvs, dataMessageExtra{sessionKeys.extraKey})
+	tlvs, err = c.processTLVs(p.tlvs, dataMessageExtra{makeCopy(sessionKeys.extraKey)})
 	if err != nil {
 		return
 	}
@@ -171,10 +191,9 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 func decideFlagFrom(tlvs []tlv) byte {
 	flag := byte(0x00)
 	for _, t := range tlvs {
-		if t.tlvType >= tlvTypeSMP1 && t.tlvType <= tlvTypeSMP1WithQuestion {
+		if t.isSMPMessage() || t.isStreamMessage() || t.isReceiptMessage() || !isBuiltinTLV(t.tlvType) {
 			flag = messageFlagIgnoreUnreadable
 		}
-
 	}
 	return flag
 }
@@ -182,24 +201,52 @@ func decideFlagFrom(tlvs []tlv) byte {
 func (c *Conversation) processSMPTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
 	c.smp.ensureSMP()
 
+	if err = c.checkSMPLimits(t); err != nil {
+		return nil, err
+	}
+
 	smpMessage, ok := t.smpMessage()
 	if !ok {
 		return nil, newOtrError("corrupt data message")
 	}
 
-	return c.receiveSMP(smpMessage)
+	if t.tlvType == tlvTypeSMP1 || t.tlvType == tlvTypeSMP1WithQuestion {
+		if abort, refused := c.refuseSMPIfBlocked(); refused {
+			c.smp.nextNormalization = 0
+			defer c.updateSMPTimeout()
+			return abort, nil
+		}
+		c.smpAttemptStarted()
+
+		// The normalization only applies to the exchange started by the SMP message right after it
+		c.smp.normalization, c.smp.nextNormalization = c.smp.nextNormalization, 0
+		if !canNormalize(c.smp.normalization) {
+			c.smp.normalization = 0
+		}
+	}
+
+	if t.tlvType == tlvTypeSMP2 {
+		// The peer has either acknowledged the normalization right before this message, or won't apply it
+		defer c.smp.forgetNormalizedSecret()
+	}
+
+	defer c.updateSMPTimeout()
+	return c.smpEngine().receiveSMP(smpMessage)
 }
 
 func (c *Conversation) processTLVs(tlvs []tlv, x dataMessageExtra) ([]tlv, error) {
 	var retTLVs []tlv
 
 	for _, t := range tlvs {
-		mh, e := messageHandlerForTLV(t)
-		if e != nil {
-			continue
+		var toSend *tlv
+		var err error
+
+		if mh, e := messageHandlerForTLV(t); e == nil {
+			toSend, err = mh(c, t, x)
+		} else {
+			toSend, err = c.processCustomTLV(t)
 		}
 
-		toSend, err := mh(c, t, x)
 		if err != nil {
 			//We assume this will only happen if the message was sent by a
 			//malicious/broken client and it's reasonable to stop processing the
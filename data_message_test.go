@@ -2,6 +2,7 @@ package otr3
 
 import (
 	"crypto/rand"
+	"math/big"
 	"testing"
 	"time"
 )
@@ -90,7 +91,18 @@ func Test_genDataMsg_willNotResetMayRetransmitIfItEncountersAnError(t *testing.T
 	assertEquals(t, c.resend.mayRetransmit, retransmitExact)
 }
 
-func Test_genDataMsg_setsLastMessageWhenNewMessageIsPlaintext(t *testing.T) {
+func Test_genDataMsg_doesntKeepTheMessageToResend(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.keys.ourKeyID = 2
+	c.keys.theirKeyID = 3
+
+	c.genDataMsg(nil, tlv{tlvType: tlvTypeSMPAbort})
+
+	assertEquals(t, len(c.resend.pending()), 0)
+}
+
+func Test_sendMessageOnEncrypted_keepsTheMessageToResend(t *testing.T) {
 	msg := []byte("hello")
 	c := bobContextAfterAKE()
 	c.msgState = encrypted
@@ -100,11 +112,11 @@ func Test_genDataMsg_setsLastMessageWhenNewMessageIsPlaintext(t *testing.T) {
 	counter := c.keys.counterHistory.findCounterFor(c.keys.ourKeyID-1, c.keys.theirKeyID)
 	counter.ourCounter = 0x1011121314
 
-	c.genDataMsg(msg)
+	c.sendMessageOnEncrypted(msg, SendOptions{})
 
-	assertDeepEquals(t, c.resend.pending(),
-		[]messageToResend{
-			messageToResend{MessagePlaintext(msg), nil},
+	assertDeepEquals(t, withoutQueuedTimes(c.resend.pending()),
+		[]QueuedMessage{
+			QueuedMessage{ID: 1, Message: MessagePlaintext(msg), Status: QueuedMessageSent},
 		})
 }
 
@@ -231,6 +243,17 @@ func Test_processDataMessage_returnsErrorIfSomethingGoesWrongWithDeserialize(t *
 	assertEquals(t, err.Error(), "otr: dataMsg.deserialize empty message")
 }
 
+func Test_processDataMessage_returnsErrorIfTheDHValueIsOutOfRange(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.msgState = encrypted
+
+	h, _ := c.messageHeader(msgTypeData)
+	m := dataMsg{senderKeyID: 1, recipientKeyID: 1, y: big.NewInt(1), topHalfCtr: [8]byte{0, 0, 0, 0, 0, 0, 0, 1}, encryptedMsg: []byte{0x01}, authenticator: make([]byte, 20)}
+	_, _, err := c.receiveDecoded(append(h, m.serialize(c.version)...))
+
+	assertDeepEquals(t, err, newOtrError("DH value out of range"))
+}
+
 func Test_processDataMessage_returnsErrorIfDataMessageHasWrongCounter(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
 	c.ourCurrentKey = bobPrivateKey
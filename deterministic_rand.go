@@ -0,0 +1,68 @@
+package otr3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// maxDRBGRequest is the most bytes generated with one request, which is 2^19 bits as required by NIST SP 800-90A
+const maxDRBGRequest = 1 << 16
+
+// InsecureDeterministicRand is a random source that returns the same bytes every time it is created with the same seed.
+// Using it as the Rand of conversations makes the messages they send reproducible up to the first DSA signature, since
+// crypto/dsa doesn't always read the same number of bytes for a nonce.
+// It is HMAC_DRBG with SHA-256 from NIST SP 800-90A, without reseeding.
+// It is ONLY meant for tests: anybody who knows the seed can derive every key generated from it.
+type InsecureDeterministicRand struct {
+	k, v []byte
+}
+
+// NewInsecureDeterministicRand returns a deterministic random source for tests, seeded with seed
+func NewInsecureDeterministicRand(seed []byte) *InsecureDeterministicRand {
+	d := &InsecureDeterministicRand{
+		k: make([]byte, sha256.Size),
+		v: make([]byte, sha256.Size),
+	}
+	for i := range d.v {
+		d.v[i] = 0x01
+	}
+
+	d.update(seed)
+	return d
+}
+
+func (d *InsecureDeterministicRand) mac(data ...[]byte) []byte {
+	h := hmac.New(sha256.New, d.k)
+	for _, b := range data {
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
+
+func (d *InsecureDeterministicRand) update(data []byte) {
+	d.k = d.mac(d.v, []byte{0x00}, data)
+	d.v = d.mac(d.v)
+
+	if len(data) > 0 {
+		d.k = d.mac(d.v, []byte{0x01}, data)
+		d.v = d.mac(d.v)
+	}
+}
+
+// Read fills p with the next bytes of the deterministic stream. It never fails.
+func (d *InsecureDeterministicRand) Read(p []byte) (int, error) {
+	for done := 0; done < len(p); {
+		end := done + maxDRBGRequest
+		if end > len(p) {
+			end = len(p)
+		}
+
+		for done < end {
+			d.v = d.mac(d.v)
+			done += copy(p[done:end], d.v)
+		}
+		d.update(nil)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,122 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_InsecureDeterministicRand_matchesTheNISTTestVector(t *testing.T) {
+	// HMAC_DRBG SHA-256 without prediction resistance, reseeding or additional input, COUNT = 0
+	d := NewInsecureDeterministicRand(bytesFromHex("ca851911349384bffe89de1cbdc46e6831e44d34a4fb935ee285dd14b71a7488" + "659ba96c601dc69fc902940805ec0ca8"))
+	b := make([]byte, 128)
+
+	d.Read(b)
+	d.Read(b)
+
+	assertDeepEquals(t, b, bytesFromHex("e528e9abf2dece54d47c7e75e5fe302149f817ea9fb4bee6f4199697d04d5b89d54fbb978a15b5c443c9ec21036d2460b6f73ebad0dc2aba6e624abf07745bc107694bb7547bb0995f70de25d6b29e2d3011bb19d27676c07162c8b5ccde0668961df86803482cb37ed6d5c0bb8d50cf1f50d476aa0458bdaba806f48be9dcb8"))
+}
+
+func Test_InsecureDeterministicRand_returnsTheSameBytesForTheSameSeed(t *testing.T) {
+	b1, b2 := make([]byte, 100), make([]byte, 100)
+
+	NewInsecureDeterministicRand([]byte("seed")).Read(b1)
+	NewInsecureDeterministicRand([]byte("seed")).Read(b2)
+
+	assertDeepEquals(t, b1, b2)
+}
+
+func Test_InsecureDeterministicRand_returnsDifferentBytesForDifferentSeeds(t *testing.T) {
+	b1, b2 := make([]byte, 100), make([]byte, 100)
+
+	NewInsecureDeterministicRand([]byte("seed")).Read(b1)
+	NewInsecureDeterministicRand([]byte("other seed")).Read(b2)
+
+	assertFalse(t, string(b1) == string(b2))
+}
+
+func Test_InsecureDeterministicRand_splitsLargeReads(t *testing.T) {
+	b := make([]byte, maxDRBGRequest+10)
+
+	n, err := NewInsecureDeterministicRand(nil).Read(b)
+
+	assertEquals(t, n, len(b))
+	assertNil(t, err)
+	assertFalse(t, string(b[:10]) == string(b[maxDRBGRequest:]))
+}
+
+func Test_InsecureDeterministicRand_passesTheHealthTests(t *testing.T) {
+	r := newHealthTestedRandom(NewInsecureDeterministicRand([]byte("seed")), nil)
+
+	_, err := r.Read(make([]byte, 1<<16))
+
+	assertNil(t, err)
+}
+
+// deterministicTranscript runs an AKE, a data message and an SMP exchange between two conversations
+// using deterministic randomness, and returns every message sent
+func deterministicTranscript(t *testing.T, seed string) []ValidMessage {
+	clock := &fixedClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	alice := &Conversation{Rand: NewInsecureDeterministicRand([]byte(seed + " alice"))}
+	alice.Policies = policies(allowV3)
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	alice.SetClock(clock)
+
+	bob := &Conversation{Rand: NewInsecureDeterministicRand([]byte(seed + " bob"))}
+	bob.Policies = policies(allowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	bob.SetClock(clock)
+	var result SMPEvent
+	alice.SetSMPEventHandler(dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) {
+		result = e
+	}})
+
+	var transcript []ValidMessage
+	deliver := func(to *Conversation, msgs []ValidMessage) []ValidMessage {
+		var replies []ValidMessage
+		for _, m := range msgs {
+			transcript = append(transcript, m)
+			_, toSend, err := to.Receive(m)
+			assertNil(t, err)
+			replies = append(replies, toSend...)
+			replies = append(replies, to.Poll()...)
+		}
+		return replies
+	}
+	converse := func(from, to *Conversation, msgs []ValidMessage) {
+		for len(msgs) > 0 {
+			msgs = deliver(to, msgs)
+			from, to = to, from
+		}
+	}
+
+	converse(alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	msgs, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	converse(alice, bob, msgs)
+
+	msgs, err = alice.StartAuthenticate("", []byte("secret"))
+	assertNil(t, err)
+	converse(alice, bob, msgs)
+
+	msgs, err = bob.ProvideAuthenticationSecret([]byte("secret"))
+	assertNil(t, err)
+	converse(bob, alice, msgs)
+
+	assertEquals(t, result, SMPEventSuccess)
+	return transcript
+}
+
+// crypto/dsa doesn't always read the same number of bytes for a nonce, so only the messages before the first signature
+// are the same every time. The exchanges still have to succeed, which means every signature was verified.
+func Test_InsecureDeterministicRand_makesConversationTranscriptsReproducibleUntilTheFirstSignature(t *testing.T) {
+	t1 := deterministicTranscript(t, "seed")
+	t2 := deterministicTranscript(t, "seed")
+	t3 := deterministicTranscript(t, "other seed")
+
+	assertTrue(t, len(t1) >= 9)
+	assertEquals(t, len(t1), len(t2))
+	assertDeepEquals(t, t1[:3], t2[:3])
+	assertFalse(t, string(t1[1]) == string(t3[1]))
+}
@@ -33,6 +33,9 @@ func init() {
 	pMinusTwo = sub(p, big.NewInt(2))
 	g1 = big.NewInt(2)
 
+	pField = newMontgomeryField(p)
+	qField = newMontgomeryField(q)
+
 	initTLVHandlers()
 }
 
@@ -8,9 +8,15 @@ func (c *Conversation) processDisconnectedTLV(t tlv, x dataMessageExtra) (toSend
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, GoneInsecure)
 	c.lastMessageStateChange = time.Time{}
 	c.msgState = finished
+	c.audit(AuditDisconnectReceived, nil)
 	c.smp.wipe()
+	c.authenticationFinished(SMPEventAbort)
+	c.abortAllStreams()
+	c.dropQueuedMessages()
+	c.ake.wipe(true)
 	c.ake = nil
 
+	c.keys.wipe()
 	c.keys = keyManagementContext{}
 
 	return nil, nil
@@ -1,6 +1,9 @@
 package otr3
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+)
 
 // ErrorCode represents an error that can happen during OTR processing
 type ErrorCode int
@@ -21,7 +24,8 @@ const (
 
 // ErrorMessageHandler generates error messages for error codes
 type ErrorMessageHandler interface {
-	// HandleErrorMessage should return a string according to the error event. This string will be concatenated to an OTR header to produce an OTR protocol error message
+	// HandleErrorMessage should return a string according to the error event. This string will be concatenated to an OTR header to produce an OTR protocol error message.
+	// It is called while the conversation is locked, so it must not call methods of the conversation.
 	HandleErrorMessage(error ErrorCode) []byte
 }
 
@@ -33,13 +37,80 @@ func (d dynamicErrorMessageHandler) HandleErrorMessage(error ErrorCode) []byte {
 	return d.eh(error)
 }
 
+// PeerErrorHandler is told about the standard OTR error messages sent by the peer, as the ErrorCode they stand for
+type PeerErrorHandler interface {
+	// HandlePeerError is called with the error code and the text of the error message
+	HandlePeerError(code ErrorCode, message []byte)
+}
+
+type dynamicPeerErrorHandler struct {
+	eh func(code ErrorCode, message []byte)
+}
+
+func (d dynamicPeerErrorHandler) HandlePeerError(code ErrorCode, message []byte) {
+	d.eh(code, message)
+}
+
+// SetPeerErrorHandler assigns the handler for the standard OTR error messages sent by the peer
+func (c *Conversation) SetPeerErrorHandler(handler PeerErrorHandler) {
+	c.peerErrorHandler = handler
+}
+
+func (c *Conversation) peerError(code ErrorCode, msg []byte) {
+	if h := c.peerErrorHandler; h != nil {
+		// The message can be wiped before the delayed handler is called
+		msg = makeCopy(msg)
+		c.callHandler(func() { h.HandlePeerError(code, msg) })
+	}
+}
+
 func (c *Conversation) generatePotentialErrorMessage(ec ErrorCode) {
 	if c.errorMessageHandler != nil {
 		msg := c.errorMessageHandler.HandleErrorMessage(ec)
-		c.injectMessage(append(append(errorMarker, ' '), msg...))
+		c.injectMessage(c.trimToMessageSize(append(append(errorMarker, ' '), msg...), len(errorMarker)))
 	}
 }
 
+// knownErrorMessage is the text libotr based clients send for an error code. Some of them contain
+// the account name of the peer, so a text is recognized by what it starts and ends with.
+type knownErrorMessage struct {
+	code   ErrorCode
+	prefix []byte
+	suffix []byte
+}
+
+var knownErrorMessages = []knownErrorMessage{
+	{ErrorCodeEncryptionError, []byte("Error occurred encrypting message."), nil},
+	{ErrorCodeMessageUnreadable, []byte("You transmitted an unreadable encrypted message."), nil},
+	{ErrorCodeMessageMalformed, []byte("You transmitted a malformed data message."), nil},
+	{ErrorCodeMessageNotInPrivate, []byte("You sent encrypted data to "), []byte(", who wasn't expecting it.")},
+}
+
+// ParseErrorMessage returns the error code of the text of an OTR error message sent by the peer,
+// and false if the text isn't one of the standard messages sent by libotr based clients
+func ParseErrorMessage(msg []byte) (ErrorCode, bool) {
+	msg = bytes.TrimSpace(msg)
+	for _, k := range knownErrorMessages {
+		if k.matches(msg) {
+			return k.code, true
+		}
+	}
+	return 0, false
+}
+
+func (k knownErrorMessage) matches(msg []byte) bool {
+	if k.suffix == nil {
+		return bytes.Equal(msg, k.prefix)
+	}
+	return len(msg) >= len(k.prefix)+len(k.suffix) && bytes.HasPrefix(msg, k.prefix) && bytes.HasSuffix(msg, k.suffix)
+}
+
+// shouldRestartAKE returns true if the error means the peer has lost the keys of the conversation,
+// so that starting a new AKE can fix it
+func (s ErrorCode) shouldRestartAKE() bool {
+	return s == ErrorCodeMessageUnreadable || s == ErrorCodeMessageNotInPrivate
+}
+
 func (s ErrorCode) String() string {
 	switch s {
 	case ErrorCodeEncryptionError:
@@ -51,3 +51,45 @@ func Test_debugErrorMessageHandler_writesTheErrorCodeToStderr(t *testing.T) {
 	})
 	assertEquals(t, ss, "[DEBUG] HandleErrorMessage(ErrorCodeMessageMalformed)\n")
 }
+
+func Test_ParseErrorMessage_recognizesTheStandardErrorMessages(t *testing.T) {
+	code, ok := ParseErrorMessage([]byte("Error occurred encrypting message."))
+	assertTrue(t, ok)
+	assertEquals(t, code, ErrorCodeEncryptionError)
+
+	code, ok = ParseErrorMessage([]byte("You transmitted an unreadable encrypted message."))
+	assertTrue(t, ok)
+	assertEquals(t, code, ErrorCodeMessageUnreadable)
+
+	code, ok = ParseErrorMessage([]byte("You transmitted a malformed data message."))
+	assertTrue(t, ok)
+	assertEquals(t, code, ErrorCodeMessageMalformed)
+
+	code, ok = ParseErrorMessage([]byte("You sent encrypted data to bob@example.org, who wasn't expecting it."))
+	assertTrue(t, ok)
+	assertEquals(t, code, ErrorCodeMessageNotInPrivate)
+}
+
+func Test_ParseErrorMessage_ignoresSurroundingWhitespace(t *testing.T) {
+	code, ok := ParseErrorMessage([]byte(" You transmitted an unreadable encrypted message.\n"))
+	assertTrue(t, ok)
+	assertEquals(t, code, ErrorCodeMessageUnreadable)
+}
+
+func Test_ParseErrorMessage_doesntRecognizeOtherMessages(t *testing.T) {
+	_, ok := ParseErrorMessage([]byte("You are wrong"))
+	assertFalse(t, ok)
+
+	_, ok = ParseErrorMessage([]byte("You transmitted an unreadable encrypted message. Or not."))
+	assertFalse(t, ok)
+
+	_, ok = ParseErrorMessage([]byte("You sent encrypted data to, who wasn't expecting it."))
+	assertFalse(t, ok)
+}
+
+func Test_ErrorCode_shouldRestartAKE_onlyWhenThePeerHasLostTheKeys(t *testing.T) {
+	assertFalse(t, ErrorCodeEncryptionError.shouldRestartAKE())
+	assertTrue(t, ErrorCodeMessageUnreadable.shouldRestartAKE())
+	assertFalse(t, ErrorCodeMessageMalformed.shouldRestartAKE())
+	assertTrue(t, ErrorCodeMessageNotInPrivate.shouldRestartAKE())
+}
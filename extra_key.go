@@ -13,6 +13,9 @@ func (c *Conversation) processExtraSymmetricKeyTLV(t tlv, x dataMessageExtra) (t
 // UseExtraSymmetricKey takes a usage parameter and optional usageData and returns the current symmetric key
 // and a set of messages to send in order to ask the peer to use the same symmetric key for the usage defined
 func (c *Conversation) UseExtraSymmetricKey(usage uint32, usageData []byte) ([]byte, []ValidMessage, error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
 	if c.msgState != encrypted ||
 		c.keys.theirKeyID == 0 {
 		return nil, nil, newOtrError("cannot send message in current state")
@@ -42,8 +45,44 @@ func (d dynamicReceivedKeyHandler) ReceivedSymmetricKey(usage uint32, usageData
 	d.eh(usage, usageData, symkey)
 }
 
+// SetReceivedKeyHandler assigns handler for extra symmetric keys the peer asks us to use.
+// It will be called for all usages that don't have a handler registered with RegisterReceivedKeyHandler
+func (c *Conversation) SetReceivedKeyHandler(handler ReceivedKeyHandler) {
+	c.receivedKeyHandler = handler
+}
+
+// RegisterReceivedKeyHandler assigns handler for extra symmetric keys the peer asks us to use for the given usage.
+// Registering a nil handler removes the handler for that usage.
+func (c *Conversation) RegisterReceivedKeyHandler(usage uint32, handler ReceivedKeyHandler) {
+	if handler == nil {
+		delete(c.receivedKeyUsageHandlers, usage)
+		return
+	}
+
+	if c.receivedKeyUsageHandlers == nil {
+		c.receivedKeyUsageHandlers = make(map[uint32]ReceivedKeyHandler)
+	}
+	c.receivedKeyUsageHandlers[usage] = handler
+}
+
+func (c *Conversation) receivedKeyHandlerFor(usage uint32) ReceivedKeyHandler {
+	if h, ok := c.receivedKeyUsageHandlers[usage]; ok {
+		return h
+	}
+	return c.receivedKeyHandler
+}
+
 func (c *Conversation) receivedSymKey(usage uint32, usageData []byte, symkey []byte) {
-	if c.receivedKeyHandler != nil {
-		c.receivedKeyHandler.ReceivedSymmetricKey(usage, usageData, symkey)
+	h := c.receivedKeyHandlerFor(usage)
+	if h == nil {
+		c.messageEventWithMessage(MessageEventReceivedSymmetricKeyForUnknownUsage, usageData, usage)
+		return
+	}
+
+	// The key and usage data can be wiped before a delayed handler is called
+	if usageData != nil {
+		usageData = makeCopy(usageData)
 	}
+	symkey = makeCopy(symkey)
+	c.callHandler(func() { h.ReceivedSymmetricKey(usage, usageData, symkey) })
 }
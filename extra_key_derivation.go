@@ -0,0 +1,102 @@
+package otr3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/coyim/gotrax"
+)
+
+var extraKeyDerivationSalt = []byte("OTR3 extra symmetric key derivation")
+
+const maxDerivedExtraKeyLength = 255 * sha256.Size
+
+var errInvalidDerivedKeyLength = newOtrErrorf("derived key length must be between 1 and %d bytes", maxDerivedExtraKeyLength)
+
+// DeriveExtraSymmetricKey derives a key of the given length from the extra symmetric key, bound to the usage and usage data.
+// Different usages, or different usage data for the same usage, produce independent keys. The derivation is HKDF (RFC 5869)
+// with SHA-256, using the usage as a big-endian 32 bit number followed by the usage data as the info parameter.
+func DeriveExtraSymmetricKey(key []byte, usage uint32, usageData []byte, length int) ([]byte, error) {
+	if length <= 0 || length > maxDerivedExtraKeyLength {
+		return nil, errInvalidDerivedKeyLength
+	}
+
+	info := append(gotrax.AppendWord(nil, usage), usageData...)
+	return hkdfExpand(hkdfExtract(extraKeyDerivationSalt, key), info, length), nil
+}
+
+func hkdfExtract(salt, secret []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+func hkdfExpand(prk, info []byte, length int) []byte {
+	mac := hmac.New(sha256.New, prk)
+	result := make([]byte, 0, length+sha256.Size)
+	var prev []byte
+
+	for i := byte(1); len(result) < length; i++ {
+		mac.Reset()
+		mac.Write(prev)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		prev = mac.Sum(nil)
+		result = append(result, prev...)
+	}
+
+	wipeBytes(prk)
+	return result[:length]
+}
+
+// UseDerivedExtraSymmetricKey works like UseExtraSymmetricKey, but instead of the extra symmetric key itself it returns a key
+// of the given length derived from it, the usage and the usage data with DeriveExtraSymmetricKey.
+// The peer should register a handler with RegisterDerivedKeyHandler for the same usage and length to get the same key.
+func (c *Conversation) UseDerivedExtraSymmetricKey(usage uint32, usageData []byte, length int) ([]byte, []ValidMessage, error) {
+	if length <= 0 || length > maxDerivedExtraKeyLength {
+		return nil, nil, errInvalidDerivedKeyLength
+	}
+
+	key, toSend, err := c.UseExtraSymmetricKey(usage, usageData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	derived, err := deriveAndWipeExtraSymmetricKey(key, usage, usageData, length)
+	return derived, toSend, err
+}
+
+// deriveAndWipeExtraSymmetricKey derives a key like DeriveExtraSymmetricKey, and wipes the extra symmetric key,
+// which isn't needed anymore once the derived key has been produced
+func deriveAndWipeExtraSymmetricKey(key []byte, usage uint32, usageData []byte, length int) ([]byte, error) {
+	defer wipeBytes(key)
+	return DeriveExtraSymmetricKey(key, usage, usageData, length)
+}
+
+type derivedReceivedKeyHandler struct {
+	length  int
+	handler ReceivedKeyHandler
+}
+
+func (d derivedReceivedKeyHandler) ReceivedSymmetricKey(usage uint32, usageData []byte, symkey []byte) {
+	// This can't fail, since the length is verified when registering the handler.
+	// The key given to every handler is a copy, so it can be wiped here.
+	derived, _ := deriveAndWipeExtraSymmetricKey(symkey, usage, usageData, d.length)
+	d.handler.ReceivedSymmetricKey(usage, usageData, derived)
+}
+
+// RegisterDerivedKeyHandler works like RegisterReceivedKeyHandler, but instead of the extra symmetric key itself the handler will
+// receive a key of the given length, derived in the same way as UseDerivedExtraSymmetricKey does.
+func (c *Conversation) RegisterDerivedKeyHandler(usage uint32, length int, handler ReceivedKeyHandler) error {
+	if handler == nil {
+		c.RegisterReceivedKeyHandler(usage, nil)
+		return nil
+	}
+
+	if length <= 0 || length > maxDerivedExtraKeyLength {
+		return errInvalidDerivedKeyLength
+	}
+
+	c.RegisterReceivedKeyHandler(usage, derivedReceivedKeyHandler{length, handler})
+	return nil
+}
@@ -0,0 +1,103 @@
+package otr3
+
+import "testing"
+
+func Test_hkdf_matchesTheRFC5869TestVector(t *testing.T) {
+	ikm := bytesFromHex("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt := bytesFromHex("000102030405060708090a0b0c")
+	info := bytesFromHex("f0f1f2f3f4f5f6f7f8f9")
+
+	prk := hkdfExtract(salt, ikm)
+	assertDeepEquals(t, prk, bytesFromHex("077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5"))
+
+	okm := hkdfExpand(prk, info, 42)
+	assertDeepEquals(t, okm, bytesFromHex("3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"))
+}
+
+func Test_DeriveExtraSymmetricKey_returnsKeysOfTheRequestedLength(t *testing.T) {
+	key := bytesFromHex("0e1810c7c62c3bace6450dcbef16af8a271b5ac93030b83e9d0d80e0641e3c18")
+
+	k1, _ := DeriveExtraSymmetricKey(key, 1, nil, 16)
+	k2, _ := DeriveExtraSymmetricKey(key, 1, nil, 100)
+
+	assertEquals(t, len(k1), 16)
+	assertEquals(t, len(k2), 100)
+	assertDeepEquals(t, k2[:16], k1)
+}
+
+func Test_DeriveExtraSymmetricKey_producesDifferentKeysForDifferentUsages(t *testing.T) {
+	key := bytesFromHex("0e1810c7c62c3bace6450dcbef16af8a271b5ac93030b83e9d0d80e0641e3c18")
+
+	k1, _ := DeriveExtraSymmetricKey(key, 1, nil, 32)
+	k2, _ := DeriveExtraSymmetricKey(key, 2, nil, 32)
+	k3, _ := DeriveExtraSymmetricKey(key, 1, []byte("file.txt"), 32)
+
+	assertFalse(t, string(k1) == string(k2))
+	assertFalse(t, string(k1) == string(k3))
+	assertFalse(t, string(k1) == string(key))
+}
+
+func Test_DeriveExtraSymmetricKey_returnsErrorForInvalidLengths(t *testing.T) {
+	_, err := DeriveExtraSymmetricKey([]byte{0x01}, 1, nil, 0)
+	assertEquals(t, err, errInvalidDerivedKeyLength)
+
+	_, err = DeriveExtraSymmetricKey([]byte{0x01}, 1, nil, 255*32+1)
+	assertEquals(t, err, errInvalidDerivedKeyLength)
+}
+
+func Test_UseDerivedExtraSymmetricKey_returnsErrorIfWeAreNotInEncryptedMode(t *testing.T) {
+	c := aliceContextAfterAKE()
+	c.msgState = plainText
+
+	_, _, err := c.UseDerivedExtraSymmetricKey(0, nil, 32)
+	assertDeepEquals(t, err, newOtrError("cannot send message in current state"))
+}
+
+func Test_RegisterDerivedKeyHandler_returnsErrorForInvalidLengths(t *testing.T) {
+	c := &Conversation{}
+	err := c.RegisterDerivedKeyHandler(1, -1, dynamicReceivedKeyHandler{func(uint32, []byte, []byte) {}})
+	assertEquals(t, err, errInvalidDerivedKeyLength)
+	assertNil(t, c.receivedKeyHandlerFor(1))
+}
+
+func Test_UseDerivedExtraSymmetricKey_derivesTheSameKeyOnBothSides(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+
+	var received []byte
+	bob.RegisterDerivedKeyHandler(0x42, 24, dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		received = symkey
+	}})
+
+	key, toSend, err := alice.UseDerivedExtraSymmetricKey(0x42, []byte("file.txt"), 24)
+	assertNil(t, err)
+	assertEquals(t, len(key), 24)
+
+	_, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, received, key)
+}
+
+func Test_deriveAndWipeExtraSymmetricKey_wipesTheExtraSymmetricKey(t *testing.T) {
+	key := bytesFromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	expected, _ := DeriveExtraSymmetricKey(makeCopy(key), 0x42, []byte("file.txt"), 24)
+
+	derived, err := deriveAndWipeExtraSymmetricKey(key, 0x42, []byte("file.txt"), 24)
+
+	assertNil(t, err)
+	assertDeepEquals(t, derived, expected)
+	assertBytesWiped(t, key)
+}
+
+func Test_derivedReceivedKeyHandler_wipesTheReceivedKey(t *testing.T) {
+	var received []byte
+	h := derivedReceivedKeyHandler{24, dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		received = symkey
+	}}}
+	key := bytesFromHex("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	expected, _ := DeriveExtraSymmetricKey(makeCopy(key), 0x42, nil, 24)
+
+	h.ReceivedSymmetricKey(0x42, nil, key)
+
+	assertDeepEquals(t, received, expected)
+	assertBytesWiped(t, key)
+}
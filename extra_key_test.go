@@ -140,3 +140,76 @@ func Test_UseExtraSymmetricKey_returnsTheGeneratedSymmetricKey(t *testing.T) {
 	k, _, _ := c.UseExtraSymmetricKey(0x1234, []byte{0xAB, 0xCD, 0xEE})
 	assertDeepEquals(t, k, bytesFromHex("0e1810c7c62c3bace6450dcbef16af8a271b5ac93030b83e9d0d80e0641e3c18"))
 }
+
+func Test_SetReceivedKeyHandler_setsTheReceivedKeyHandler(t *testing.T) {
+	c := &Conversation{}
+	called := false
+	c.SetReceivedKeyHandler(dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		called = true
+	}})
+
+	c.receivedSymKey(0x01, nil, nil)
+	assertEquals(t, called, true)
+}
+
+func Test_processExtraSymmetricKeyTLV_dispatchesToTheHandlerRegisteredForTheUsage(t *testing.T) {
+	c := &Conversation{}
+	x := dataMessageExtra{[]byte{0x89, 0x11, 0x13, 0x66, 0xAB, 0xCD}}
+
+	var called []string
+	c.SetReceivedKeyHandler(dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		called = append(called, "general")
+	}})
+	c.RegisterReceivedKeyHandler(0xAB12CD44, dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		called = append(called, "usage")
+	}})
+
+	c.processExtraSymmetricKeyTLV(tlv{tlvTypeExtraSymmetricKey, 0x04, []byte{0xAB, 0x12, 0xCD, 0x44}}, x)
+	c.processExtraSymmetricKeyTLV(tlv{tlvTypeExtraSymmetricKey, 0x04, []byte{0x00, 0x00, 0x00, 0x01}}, x)
+
+	assertDeepEquals(t, called, []string{"usage", "general"})
+}
+
+func Test_RegisterReceivedKeyHandler_withNilHandlerRemovesTheHandlerForTheUsage(t *testing.T) {
+	c := &Conversation{}
+	c.RegisterReceivedKeyHandler(0x01, dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {}})
+	c.RegisterReceivedKeyHandler(0x01, nil)
+
+	assertNil(t, c.receivedKeyHandlerFor(0x01))
+}
+
+func Test_processExtraSymmetricKeyTLV_signalsAMessageEventForAnUnregisteredUsage(t *testing.T) {
+	c := &Conversation{}
+	x := dataMessageExtra{[]byte{0x89, 0x11, 0x13, 0x66, 0xAB, 0xCD}}
+	c.RegisterReceivedKeyHandler(0x01, dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		t.Errorf("Didn't expect the handler for another usage to be called")
+	}})
+
+	called := false
+	c.messageEventHandler = dynamicMessageEventHandler{func(event MessageEvent, message []byte, err error, trace ...interface{}) {
+		assertEquals(t, event, MessageEventReceivedSymmetricKeyForUnknownUsage)
+		assertDeepEquals(t, message, []byte{0x01, 0x02})
+		assertDeepEquals(t, trace, []interface{}{uint32(0xAB12CD44)})
+		called = true
+	}}
+
+	c.processExtraSymmetricKeyTLV(tlv{tlvTypeExtraSymmetricKey, 0x06, []byte{0xAB, 0x12, 0xCD, 0x44, 0x01, 0x02}}, x)
+
+	assertEquals(t, called, true)
+}
+
+func Test_UseExtraSymmetricKey_deliversTheSameKeyToThePeersHandler(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+
+	var received []byte
+	bob.RegisterReceivedKeyHandler(0x42, dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		received = symkey
+	}})
+
+	key, toSend, err := alice.UseExtraSymmetricKey(0x42, []byte("file.txt"))
+	assertNil(t, err)
+
+	_, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, received, key)
+}
@@ -0,0 +1,65 @@
+package filetransfer
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/coyim/gotrax"
+)
+
+const idLength = 16
+
+var errInvalidOffer = errors.New("filetransfer: invalid offer")
+
+// Offer describes a file that is being transferred. It is sent to the peer as the usage data of the extra symmetric key TLV,
+// and it is also bound into the key used to encrypt the transfer.
+type Offer struct {
+	// ID is a random identifier for the transfer, that makes sure every transfer uses a different key
+	ID [idLength]byte
+	// Name is the file name suggested by the sender. It should not be trusted as a path.
+	Name string
+	// Size is the number of bytes in the file
+	Size uint64
+	// Hash is the SHA-256 hash of the content of the file
+	Hash [sha256.Size]byte
+}
+
+// NewOffer creates an offer for the content given, calculating its size and hash.
+// The reader is consumed, so it will need to be rewound or reopened before sending the file.
+func NewOffer(name string, content io.Reader) (Offer, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, content)
+	if err != nil {
+		return Offer{}, err
+	}
+
+	o := Offer{Name: name, Size: uint64(n)}
+	copy(o.Hash[:], h.Sum(nil))
+	return o, nil
+}
+
+func (o Offer) serialize() []byte {
+	out := append([]byte{}, o.ID[:]...)
+	out = gotrax.AppendData(out, []byte(o.Name))
+	out = gotrax.AppendLong(out, o.Size)
+	return append(out, o.Hash[:]...)
+}
+
+func parseOffer(data []byte) (Offer, error) {
+	var o Offer
+
+	data, id, ok1 := gotrax.ExtractFixedData(data, idLength)
+	data, name, ok2 := gotrax.ExtractData(data)
+	data, size, ok3 := gotrax.ExtractLong(data)
+	data, hash, ok4 := gotrax.ExtractFixedData(data, sha256.Size)
+	if !ok1 || !ok2 || !ok3 || !ok4 || len(data) != 0 {
+		return o, errInvalidOffer
+	}
+
+	copy(o.ID[:], id)
+	o.Name = string(name)
+	o.Size = size
+	copy(o.Hash[:], hash)
+	return o, nil
+}
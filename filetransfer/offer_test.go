@@ -0,0 +1,36 @@
+package filetransfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func Test_NewOffer_calculatesSizeAndHash(t *testing.T) {
+	o, err := NewOffer("file.txt", bytes.NewReader([]byte("hello")))
+
+	assertNil(t, err)
+	assertEquals(t, o.Name, "file.txt")
+	assertEquals(t, o.Size, uint64(5))
+	assertEquals(t, o.Hash, sha256.Sum256([]byte("hello")))
+}
+
+func Test_parseOffer_parsesASerializedOffer(t *testing.T) {
+	o := Offer{ID: [16]byte{0x01, 0x02}, Name: "file.txt", Size: 42, Hash: sha256.Sum256([]byte("hello"))}
+
+	parsed, err := parseOffer(o.serialize())
+
+	assertNil(t, err)
+	assertDeepEquals(t, parsed, o)
+}
+
+func Test_parseOffer_returnsErrorForInvalidData(t *testing.T) {
+	o := Offer{Name: "file.txt", Size: 42}
+	serialized := o.serialize()
+
+	_, err := parseOffer(serialized[:len(serialized)-1])
+	assertEquals(t, err, errInvalidOffer)
+
+	_, err = parseOffer(append(serialized, 0x00))
+	assertEquals(t, err, errInvalidOffer)
+}
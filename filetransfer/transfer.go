@@ -0,0 +1,300 @@
+// Package filetransfer implements encrypted file transfers protected by the OTR extra symmetric key.
+//
+// The sender creates an Offer and calls Start, which asks the peer to use the extra symmetric key for the transfer. The offer
+// is carried as the usage data of that request. Both sides derive a key from the extra symmetric key and the offer, and the file
+// is sent over any transport the application chooses, encrypted and authenticated in chunks with AES-GCM. When all of the file has
+// been received and its hash verified, the receiver sends back an encrypted acknowledgement.
+//
+// This is not compatible with the file transfers of libotr based clients, like Pidgin or Jitsi. Those use usage 1 of the extra
+// symmetric key and their own format, while this package uses its own usage, KeyUsage, so it can't send files to them or receive
+// files from them. Both sides of a transfer have to use this package, or an implementation of the same format.
+package filetransfer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/coyim/otr3"
+)
+
+// KeyUsage is the usage of the extra symmetric key used for file transfers. It is deliberately not usage 1, which libotr
+// based clients use for their own file transfers: those don't use this format, so a transfer started with this package can
+// only be received by a peer that also uses it. The value is "otrf" in ASCII.
+const KeyUsage uint32 = 0x6F747266
+
+// DefaultChunkSize is the size of the chunks files are split in, unless a different size is set on the Transfer
+const DefaultChunkSize = 16 * 1024
+
+// MaxChunkSize is the largest chunk size accepted
+const MaxChunkSize = 1024 * 1024
+
+const keyLength = 32
+
+const (
+	directionData byte = iota
+	directionAck
+)
+
+var (
+	errInvalidChunkSize      = errors.New("filetransfer: invalid chunk size")
+	errChunkTooLarge         = errors.New("filetransfer: received chunk is too large")
+	errEmptyChunk            = errors.New("filetransfer: received an empty chunk before the last one")
+	errInvalidChunk          = errors.New("filetransfer: received chunk could not be authenticated")
+	errUnexpectedSize        = errors.New("filetransfer: file size doesn't match the offer")
+	errHashMismatch          = errors.New("filetransfer: file hash doesn't match the offer")
+	errContentChanged        = errors.New("filetransfer: content doesn't match the offer")
+	errInvalidAcknowledgment = errors.New("filetransfer: transfer was not acknowledged by the peer")
+)
+
+// ProgressFunc is called after every chunk sent or received, with the number of bytes transferred so far and the total size
+type ProgressFunc func(transferred, total uint64)
+
+// Transfer is a single file transfer, either outgoing or incoming
+type Transfer struct {
+	// Offer describes the file transferred
+	Offer Offer
+	// ChunkSize is the size of the chunks used when sending. It has no effect when receiving.
+	ChunkSize int
+	// Progress will be called after every chunk, if set
+	Progress ProgressFunc
+
+	aead cipher.AEAD
+}
+
+func newTransfer(offer Offer, key []byte) (*Transfer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transfer{Offer: offer, ChunkSize: DefaultChunkSize, aead: aead}, nil
+}
+
+// Start asks the peer to use the extra symmetric key to receive the file described by the offer.
+// A random ID is assigned to the offer. The returned messages have to be sent to the peer through
+// the conversation, after which the file can be sent using Send on the returned Transfer.
+func Start(c *otr3.Conversation, offer Offer) (*Transfer, []otr3.ValidMessage, error) {
+	r := c.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+
+	if _, err := io.ReadFull(r, offer.ID[:]); err != nil {
+		return nil, nil, err
+	}
+
+	key, toSend, err := c.UseDerivedExtraSymmetricKey(KeyUsage, offer.serialize(), keyLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wipe(key)
+
+	t, err := newTransfer(offer, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t, toSend, nil
+}
+
+// OfferHandler is an interface that will be invoked when the peer offers a file
+type OfferHandler interface {
+	// ReceivedOffer will be called with the incoming transfer. The file can be received by calling Receive on it.
+	ReceivedOffer(t *Transfer)
+}
+
+type keyHandler struct {
+	handler OfferHandler
+}
+
+func (h keyHandler) ReceivedSymmetricKey(usage uint32, usageData []byte, symkey []byte) {
+	defer wipe(symkey)
+
+	offer, err := parseOffer(usageData)
+	if err != nil {
+		return
+	}
+
+	t, err := newTransfer(offer, symkey)
+	if err != nil {
+		return
+	}
+
+	h.handler.ReceivedOffer(t)
+}
+
+// Listen makes the conversation accept file offers from the peer, and invokes the handler for each one.
+// Offers that can't be parsed are ignored. A nil handler stops listening for offers.
+func Listen(c *otr3.Conversation, handler OfferHandler) {
+	if handler == nil {
+		c.RegisterReceivedKeyHandler(KeyUsage, nil)
+		return
+	}
+
+	// This can't fail, since the key length is valid
+	_ = c.RegisterDerivedKeyHandler(KeyUsage, keyLength, keyHandler{handler})
+}
+
+// Send reads the file from content and sends it over the transport, and then waits for the acknowledgement of the peer.
+// The content has to match the size and hash of the offer, otherwise the transfer will be aborted before it is completed.
+func (t *Transfer) Send(transport io.ReadWriter, content io.Reader) error {
+	if t.ChunkSize <= 0 || t.ChunkSize > MaxChunkSize {
+		return errInvalidChunkSize
+	}
+
+	h := sha256.New()
+	buf := make([]byte, t.ChunkSize)
+	var sent, seq uint64
+
+	for {
+		n := t.ChunkSize
+		if remaining := t.Offer.Size - sent; remaining < uint64(n) {
+			n = int(remaining)
+		}
+
+		if _, err := io.ReadFull(content, buf[:n]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errContentChanged
+			}
+			return err
+		}
+
+		h.Write(buf[:n])
+		sent += uint64(n)
+
+		final := sent == t.Offer.Size
+		if final && !bytes.Equal(h.Sum(nil), t.Offer.Hash[:]) {
+			return errContentChanged
+		}
+
+		if err := t.writeFrame(transport, directionData, seq, final, buf[:n]); err != nil {
+			return err
+		}
+		seq++
+
+		t.progress(sent)
+		if final {
+			break
+		}
+	}
+
+	ack, final, err := t.readFrame(transport, directionAck, 0)
+	if err != nil || !final || !bytes.Equal(ack, t.Offer.Hash[:]) {
+		return errInvalidAcknowledgment
+	}
+
+	return nil
+}
+
+// Receive reads the file from the transport and writes it to w. Every chunk is authenticated before it is written, but the file
+// is only complete and verified against the offer when Receive returns without an error. When it does, the peer is sent an acknowledgement.
+func (t *Transfer) Receive(transport io.ReadWriter, w io.Writer) error {
+	h := sha256.New()
+	var received, seq uint64
+
+	for final := false; !final; seq++ {
+		var chunk []byte
+		var err error
+		if chunk, final, err = t.readFrame(transport, directionData, seq); err != nil {
+			return err
+		}
+
+		// Send never produces these, and accepting them would let the peer keep us receiving forever
+		if len(chunk) == 0 && !final {
+			return errEmptyChunk
+		}
+
+		h.Write(chunk)
+		received += uint64(len(chunk))
+		if received > t.Offer.Size {
+			return errUnexpectedSize
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+
+		t.progress(received)
+	}
+
+	if received != t.Offer.Size {
+		return errUnexpectedSize
+	}
+
+	sum := h.Sum(nil)
+	if !bytes.Equal(sum, t.Offer.Hash[:]) {
+		return errHashMismatch
+	}
+
+	return t.writeFrame(transport, directionAck, 0, true, sum)
+}
+
+func (t *Transfer) progress(transferred uint64) {
+	if t.Progress != nil {
+		t.Progress(transferred, t.Offer.Size)
+	}
+}
+
+func nonce(direction byte, seq uint64) []byte {
+	n := make([]byte, 12)
+	n[0] = direction
+	binary.BigEndian.PutUint64(n[4:], seq)
+	return n
+}
+
+// A frame is the length of the sealed data, a flag marking the last frame and the sealed data.
+// The flag is authenticated as additional data, so a truncated transfer can't be mistaken for a complete one.
+func (t *Transfer) writeFrame(w io.Writer, direction byte, seq uint64, final bool, data []byte) error {
+	flag := []byte{0x00}
+	if final {
+		flag[0] = 0x01
+	}
+
+	sealed := t.aead.Seal(nil, nonce(direction, seq), data, flag)
+
+	frame := make([]byte, 5, 5+len(sealed))
+	binary.BigEndian.PutUint32(frame, uint32(len(sealed)))
+	frame[4] = flag[0]
+	_, err := w.Write(append(frame, sealed...))
+	return err
+}
+
+func (t *Transfer) readFrame(r io.Reader, direction byte, seq uint64) (data []byte, final bool, err error) {
+	var header [5]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return nil, false, err
+	}
+
+	l := binary.BigEndian.Uint32(header[:4])
+	if l > MaxChunkSize+uint32(t.aead.Overhead()) {
+		return nil, false, errChunkTooLarge
+	}
+
+	sealed := make([]byte, l)
+	if _, err = io.ReadFull(r, sealed); err != nil {
+		return nil, false, err
+	}
+
+	if data, err = t.aead.Open(nil, nonce(direction, seq), sealed, header[4:]); err != nil {
+		return nil, false, errInvalidChunk
+	}
+
+	return data, header[4] == 0x01, nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,270 @@
+package filetransfer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/coyim/otr3"
+)
+
+var (
+	alicePrivateKey = parseIntoPrivateKey("000000000080c81c2cb2eb729b7e6fd48e975a932c638b3a9055478583afa46755683e30102447f6da2d8bec9f386bbb5da6403b0040fee8650b6ab2d7f32c55ab017ae9b6aec8c324ab5844784e9a80e194830d548fb7f09a0410df2c4d5c8bc2b3e9ad484e65412be689cf0834694e0839fb2954021521ffdffb8f5c32c14dbf2020b3ce7500000014da4591d58def96de61aea7b04a8405fe1609308d000000808ddd5cb0b9d66956e3dea5a915d9aba9d8a6e7053b74dadb2fc52f9fe4e5bcc487d2305485ed95fed026ad93f06ebb8c9e8baf693b7887132c7ffdd3b0f72f4002ff4ed56583ca7c54458f8c068ca3e8a4dfa309d1dd5d34e2a4b68e6f4338835e5e0fb4317c9e4c7e4806dafda3ef459cd563775a586dd91b1319f72621bf3f00000080b8147e74d8c45e6318c37731b8b33b984a795b3653c2cd1d65cc99efe097cb7eb2fa49569bab5aab6e8a1c261a27d0f7840a5e80b317e6683042b59b6dceca2879c6ffc877a465be690c15e4a42f9a7588e79b10faac11b1ce3741fcef7aba8ce05327a2c16d279ee1b3d77eb783fb10e3356caa25635331e26dd42b8396c4d00000001420bec691fea37ecea58a5c717142f0b804452f57")
+	bobPrivateKey   = parseIntoPrivateKey("000000000080a5138eb3d3eb9c1d85716faecadb718f87d31aaed1157671d7fee7e488f95e8e0ba60ad449ec732710a7dec5190f7182af2e2f98312d98497221dff160fd68033dd4f3a33b7c078d0d9f66e26847e76ca7447d4bab35486045090572863d9e4454777f24d6706f63e02548dfec2d0a620af37bbc1d24f884708a212c343b480d00000014e9c58f0ea21a5e4dfd9f44b6a9f7f6a9961a8fa9000000803c4d111aebd62d3c50c2889d420a32cdf1e98b70affcc1fcf44d59cca2eb019f6b774ef88153fb9b9615441a5fe25ea2d11b74ce922ca0232bd81b3c0fcac2a95b20cb6e6c0c5c1ace2e26f65dc43c751af0edbb10d669890e8ab6beea91410b8b2187af1a8347627a06ecea7e0f772c28aae9461301e83884860c9b656c722f0000008065af8625a555ea0e008cd04743671a3cda21162e83af045725db2eb2bb52712708dc0cc1a84c08b3649b88a966974bde27d8612c2861792ec9f08786a246fcadd6d8d3a81a32287745f309238f47618c2bd7612cb8b02d940571e0f30b96420bcd462ff542901b46109b1e5ad6423744448d20a57818a8cbb1647d0fea3b664e0000001440f9f2eb554cb00d45a5826b54bfa419b6980e48")
+)
+
+func parseIntoPrivateKey(hexString string) otr3.PrivateKey {
+	b, _ := hex.DecodeString(hexString)
+	pk := new(otr3.DSAPrivateKey)
+	pk.Parse(b)
+	return pk
+}
+
+func encryptedConversations() (alice, bob *otr3.Conversation) {
+	alice = &otr3.Conversation{Rand: rand.Reader}
+	alice.Policies.AllowV3()
+	alice.SetOurKeys([]otr3.PrivateKey{alicePrivateKey})
+
+	bob = &otr3.Conversation{Rand: rand.Reader}
+	bob.Policies.AllowV3()
+	bob.SetOurKeys([]otr3.PrivateKey{bobPrivateKey})
+
+	_, toSend, _ := bob.Receive(alice.QueryMessage())
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, toSend, _ = alice.Receive(toSend[0])
+	bob.Receive(toSend[0])
+
+	return alice, bob
+}
+
+type duplex struct {
+	io.Reader
+	io.Writer
+}
+
+func transports() (sender, receiver io.ReadWriter) {
+	toReceiver, fromSender := io.Pipe()
+	toSender, fromReceiver := io.Pipe()
+	return duplex{toSender, fromSender}, duplex{toReceiver, fromReceiver}
+}
+
+type offerHandler func(t *Transfer)
+
+func (f offerHandler) ReceivedOffer(t *Transfer) {
+	f(t)
+}
+
+func fixtureTransfers(content []byte) (sending, receiving *Transfer) {
+	key := make([]byte, keyLength)
+	offer, _ := NewOffer("file.txt", bytes.NewReader(content))
+	sending, _ = newTransfer(offer, key)
+	receiving, _ = newTransfer(offer, key)
+	return
+}
+
+func transfer(sending, receiving *Transfer, content []byte) (sendErr, receiveErr error, received []byte) {
+	st, rt := transports()
+	done := make(chan error)
+	var out bytes.Buffer
+
+	go func() {
+		done <- receiving.Receive(rt, &out)
+	}()
+
+	sendErr = sending.Send(st, bytes.NewReader(content))
+	return sendErr, <-done, out.Bytes()
+}
+
+func Test_Transfer_sendsAFileBetweenTwoConversations(t *testing.T) {
+	alice, bob := encryptedConversations()
+	content := bytes.Repeat([]byte("some file content "), 5000)
+
+	var incoming *Transfer
+	Listen(bob, offerHandler(func(t *Transfer) { incoming = t }))
+
+	offer, _ := NewOffer("file.txt", bytes.NewReader(content))
+	outgoing, toSend, err := Start(alice, offer)
+	assertNil(t, err)
+
+	_, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertEquals(t, incoming.Offer.Name, "file.txt")
+	assertEquals(t, incoming.Offer.Size, uint64(len(content)))
+	assertEquals(t, incoming.Offer.ID, outgoing.Offer.ID)
+
+	var progress []uint64
+	incoming.Progress = func(transferred, total uint64) {
+		progress = append(progress, transferred)
+	}
+
+	sendErr, receiveErr, received := transfer(outgoing, incoming, content)
+
+	assertNil(t, sendErr)
+	assertNil(t, receiveErr)
+	assertDeepEquals(t, received, content)
+	assertDeepEquals(t, progress, []uint64{16384, 32768, 49152, 65536, 81920, 90000})
+}
+
+func Test_Start_returnsErrorIfTheConversationIsNotEncrypted(t *testing.T) {
+	c := &otr3.Conversation{}
+	_, _, err := Start(c, Offer{})
+	assertEquals(t, err != nil, true)
+}
+
+func Test_Start_usesANewKeyForEveryTransfer(t *testing.T) {
+	alice, bob := encryptedConversations()
+	content := []byte("hello")
+
+	var incoming []*Transfer
+	Listen(bob, offerHandler(func(t *Transfer) { incoming = append(incoming, t) }))
+
+	offer, _ := NewOffer("file.txt", bytes.NewReader(content))
+	_, toSend1, _ := Start(alice, offer)
+	_, toSend2, _ := Start(alice, offer)
+	bob.Receive(toSend1[0])
+	bob.Receive(toSend2[0])
+
+	assertEquals(t, len(incoming), 2)
+	assertEquals(t, incoming[0].Offer.ID != incoming[1].Offer.ID, true)
+}
+
+func Test_Listen_withNilHandlerStopsListening(t *testing.T) {
+	alice, bob := encryptedConversations()
+	called := false
+	Listen(bob, offerHandler(func(t *Transfer) { called = true }))
+	Listen(bob, nil)
+
+	_, toSend, _ := Start(alice, Offer{})
+	bob.Receive(toSend[0])
+
+	assertEquals(t, called, false)
+}
+
+func Test_Transfer_sendsAnEmptyFile(t *testing.T) {
+	sending, receiving := fixtureTransfers(nil)
+
+	sendErr, receiveErr, received := transfer(sending, receiving, nil)
+
+	assertNil(t, sendErr)
+	assertNil(t, receiveErr)
+	assertEquals(t, len(received), 0)
+}
+
+func Test_Transfer_Send_returnsErrorIfTheContentDoesntMatchTheOffer(t *testing.T) {
+	sending, _ := fixtureTransfers([]byte("hello"))
+	st, _ := transports()
+
+	assertEquals(t, sending.Send(st, bytes.NewReader([]byte("hellO"))), errContentChanged)
+	assertEquals(t, sending.Send(st, bytes.NewReader([]byte("hel"))), errContentChanged)
+}
+
+func Test_Transfer_Send_returnsErrorForAnInvalidChunkSize(t *testing.T) {
+	sending, _ := fixtureTransfers([]byte("hello"))
+	sending.ChunkSize = 0
+
+	assertEquals(t, sending.Send(nil, nil), errInvalidChunkSize)
+}
+
+func Test_Transfer_Receive_returnsErrorIfAChunkIsTamperedWith(t *testing.T) {
+	sending, receiving := fixtureTransfers([]byte("hello"))
+	var wire bytes.Buffer
+	sending.writeFrame(&wire, directionData, 0, true, []byte("hello"))
+	tampered := wire.Bytes()
+	tampered[len(tampered)-1] ^= 0x01
+
+	err := receiving.Receive(duplex{bytes.NewReader(tampered), &wire}, &bytes.Buffer{})
+
+	assertEquals(t, err, errInvalidChunk)
+}
+
+func Test_Transfer_Receive_returnsErrorIfTheFinalFlagIsChanged(t *testing.T) {
+	sending, receiving := fixtureTransfers([]byte("hello"))
+	var wire bytes.Buffer
+	sending.writeFrame(&wire, directionData, 0, false, []byte("hello"))
+	tampered := wire.Bytes()
+	tampered[4] = 0x01
+
+	err := receiving.Receive(duplex{bytes.NewReader(tampered), &wire}, &bytes.Buffer{})
+
+	assertEquals(t, err, errInvalidChunk)
+}
+
+func Test_Transfer_Receive_returnsErrorIfChunksAreReordered(t *testing.T) {
+	sending, receiving := fixtureTransfers([]byte("helloworld"))
+	var first, second bytes.Buffer
+	sending.writeFrame(&first, directionData, 0, false, []byte("hello"))
+	sending.writeFrame(&second, directionData, 1, true, []byte("world"))
+
+	err := receiving.Receive(duplex{io.MultiReader(&second, &first), &bytes.Buffer{}}, &bytes.Buffer{})
+
+	assertEquals(t, err, errInvalidChunk)
+}
+
+func Test_Transfer_Receive_returnsErrorIfTheTransferIsTruncated(t *testing.T) {
+	sending, receiving := fixtureTransfers([]byte("helloworld"))
+	var wire bytes.Buffer
+	sending.writeFrame(&wire, directionData, 0, false, []byte("hello"))
+
+	err := receiving.Receive(duplex{&wire, &bytes.Buffer{}}, &bytes.Buffer{})
+
+	assertEquals(t, err, io.EOF)
+}
+
+func Test_Transfer_Receive_returnsErrorIfTheHashDoesntMatch(t *testing.T) {
+	sending, receiving := fixtureTransfers([]byte("hello"))
+	var wire bytes.Buffer
+	sending.writeFrame(&wire, directionData, 0, true, []byte("hellO"))
+
+	err := receiving.Receive(duplex{&wire, &bytes.Buffer{}}, &bytes.Buffer{})
+
+	assertEquals(t, err, errHashMismatch)
+}
+
+func Test_Transfer_Receive_returnsErrorIfMoreDataThanOfferedIsSent(t *testing.T) {
+	sending, receiving := fixtureTransfers([]byte("hello"))
+	var wire bytes.Buffer
+	sending.writeFrame(&wire, directionData, 0, true, []byte("hello world"))
+
+	err := receiving.Receive(duplex{&wire, &bytes.Buffer{}}, &bytes.Buffer{})
+
+	assertEquals(t, err, errUnexpectedSize)
+}
+
+func Test_Transfer_Receive_returnsErrorForAnEmptyChunkBeforeTheLastOne(t *testing.T) {
+	sending, receiving := fixtureTransfers([]byte("hello"))
+	var wire bytes.Buffer
+	sending.writeFrame(&wire, directionData, 0, false, nil)
+	sending.writeFrame(&wire, directionData, 1, true, []byte("hello"))
+
+	err := receiving.Receive(duplex{&wire, &bytes.Buffer{}}, &bytes.Buffer{})
+
+	assertEquals(t, err, errEmptyChunk)
+}
+
+func Test_Transfer_Receive_returnsErrorForTooLargeChunks(t *testing.T) {
+	_, receiving := fixtureTransfers([]byte("hello"))
+	wire := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00}
+
+	err := receiving.Receive(duplex{bytes.NewReader(wire), &bytes.Buffer{}}, &bytes.Buffer{})
+
+	assertEquals(t, err, errChunkTooLarge)
+}
+
+func Test_Transfer_Send_returnsErrorIfTheAcknowledgmentIsInvalid(t *testing.T) {
+	sending, _ := fixtureTransfers([]byte("hello"))
+	var ack bytes.Buffer
+	sending.writeFrame(&ack, directionAck, 0, true, make([]byte, 32))
+
+	err := sending.Send(duplex{&ack, &bytes.Buffer{}}, bytes.NewReader([]byte("hello")))
+
+	assertEquals(t, err, errInvalidAcknowledgment)
+}
+
+func Test_KeyUsage_isNotTheUsageOfLibotrFileTransfers(t *testing.T) {
+	if KeyUsage == 0x00000001 {
+		t.Errorf("KeyUsage must not be usage 1, since the transfers aren't compatible with libotr's")
+	}
+}
@@ -237,7 +237,7 @@ func fixtureDataMsg(plain plainDataMsg) ([]byte, keyManagementContext) {
 		y:          fixedGY(), //this is alices current Pub
 		topHalfCtr: [8]byte{0, 0, 0, 0, 0, 0, 0, 2},
 	}
-	m.encryptedMsg = plain.encrypt(keys.sendingAESKey[:], m.topHalfCtr)
+	m.encryptedMsg = fixturePadded(plain).encrypt(keys.sendingAESKey[:], m.topHalfCtr)
 
 	// fmt.Printf("sendingMACKey2: len: %d %X\n", len(keys.sendingMACKey), keys.sendingMACKey)
 	m.sign(keys.sendingMACKey, h, conv.version)
@@ -246,6 +246,12 @@ func fixtureDataMsg(plain plainDataMsg) ([]byte, keyManagementContext) {
 	return msg, receiverContext
 }
 
+// fixturePadded pads the plaintext with the default padding strategy
+func fixturePadded(plain plainDataMsg) plainDataMsg {
+	padded, _ := (&Conversation{}).padDataMessage(plain, 0)
+	return padded
+}
+
 //Alice decrypts a encrypted message from Bob, generated after receiving
 //an encrypted message from Alice generated with fixtureDataMsg()
 func fixtureDecryptDataMsg(encryptedDataMsg []byte) plainDataMsg {
@@ -278,7 +284,7 @@ func fixtureDecryptDataMsgBase(encryptedDataMsg []byte) ([]byte, plainDataMsg, e
 		return nil, plainDataMsg{}, err
 	}
 
-	exp.decrypt(keys.receivingAESKey[:], m.topHalfCtr, m.encryptedMsg)
+	exp.decrypt(keys.receivingAESKey[:], m.topHalfCtr, m.encryptedMsg, 0)
 
 	return header, exp, nil
 }
@@ -306,3 +312,22 @@ func hashedFixedGX() []byte {
 func encryptedFixedGX() []byte {
 	return bytesFromHex("5dd6a5999be73a99b80bdb78194a125f3067bd79e69c648b76a068117a8c4d0f36f275305423a933541937145d85ab4618094cbafbe4db0c0081614c1ff0f516c3dc4f352e9c92f88e4883166f12324d82240a8f32874c3d6bc35acedb8d501aa0111937a4859f33aa9b43ec342d78c3a45a5939c1e58e6b4f02725c1922f3df8754d1e1ab7648f558e9043ad118e63603b3ba2d8cbfea99a481835e42e73e6cd6019840f4470b606e168b1cd4a1f401c3dc52525d79fa6b959a80d4e11f1ec3a7984cf9")
 }
+
+// fixtureEncryptedConversations returns two conversations that have gone through a full AKE with each other
+func fixtureEncryptedConversations() (alice, bob *Conversation) {
+	alice = &Conversation{Rand: rand.Reader}
+	alice.Policies = policies(allowV3)
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+
+	bob = &Conversation{Rand: rand.Reader}
+	bob.Policies = policies(allowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	_, toSend, _ := bob.Receive(alice.QueryMessage())
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, toSend, _ = alice.Receive(toSend[0])
+	bob.Receive(toSend[0])
+
+	return alice, bob
+}
@@ -1,17 +1,34 @@
 package otr3
 
-import "bytes"
+import (
+	"bytes"
+	"time"
+)
 
 var (
 	fragmentSeparator      = []byte{','}
 	fragmentItagsSeparator = []byte{'|'}
 )
 
-// fragmentationContext store the current fragmentation running. A fragmentationContext is zero-valid and can be immediately used without initialization.
-// In order to follow the fragmentation rules, when the context needs to be reset, just create a new one - don't bother resetting variables
+const fragmentExpiry = 2 * time.Minute
+
+var errFragmentsExpired = newOtrError("fragmented message expired before all fragments arrived")
+var errFragmentedMessageTooLarge = newOtrError("fragmented message is too large")
+var errFragmentBufferFull = newOtrError("too much memory used by fragmented messages")
+
+// fragmentedMessage is a message being reassembled. Its fragments can arrive in any order.
+type fragmentedMessage struct {
+	parts    [][]byte
+	received uint16
+	size     int
+	started  time.Time
+}
+
+// fragmentationContext stores the messages being reassembled, one for each sender instance tag.
+// A fragmentationContext is zero-valid and can be immediately used without initialization.
 type fragmentationContext struct {
-	frag                     []byte
-	currentIndex, currentLen uint16
+	messages map[uint32]*fragmentedMessage
+	size     int
 }
 
 func min(l, r uint16) uint16 {
@@ -40,21 +57,33 @@ func (c *Conversation) SetFragmentSize(size uint16) {
 	c.fragmentSize = size
 }
 
-func (c *Conversation) fragment(data encodedMessage, fraglen uint16) []ValidMessage {
-	l := len(data)
-
+// fragmentDataLength returns how much of the message can be put in each fragment, or zero if the message shouldn't be fragmented
+func (c *Conversation) fragmentDataLength(l int, fraglen uint16) uint16 {
 	if l <= int(fraglen) || fraglen == 0 {
-		return []ValidMessage{ValidMessage(data)}
+		return 0
 	}
 
 	fakeHeader := c.version.fragmentPrefix(1, 1, c.ourInstanceTag, c.theirInstanceTag)
-	realFraglen := (fraglen - uint16(len(fakeHeader))) - 1
+	return (fraglen - uint16(len(fakeHeader))) - 1
+}
+
+func (c *Conversation) fragmentCount(l int, fraglen uint16) int {
+	realFraglen := c.fragmentDataLength(l, fraglen)
+	if realFraglen <= 0 {
+		return 1
+	}
+	return (l / int(realFraglen)) + 1
+}
+
+func (c *Conversation) fragment(data encodedMessage, fraglen uint16) []ValidMessage {
+	l := len(data)
+	realFraglen := c.fragmentDataLength(l, fraglen)
 
 	if realFraglen <= 0 {
 		return []ValidMessage{ValidMessage(data)}
 	}
 
-	numFragments := (l / int(realFraglen)) + 1
+	numFragments := c.fragmentCount(l, fraglen)
 	ret := make([]ValidMessage, numFragments)
 	for i := 0; i < numFragments; i++ {
 		prefix := c.version.fragmentPrefix(i, numFragments, c.ourInstanceTag, c.theirInstanceTag)
@@ -63,8 +92,16 @@ func (c *Conversation) fragment(data encodedMessage, fraglen uint16) []ValidMess
 	return ret
 }
 
-func fragmentsFinished(fctx fragmentationContext) bool {
-	return fctx.currentIndex > 0 && fctx.currentIndex == fctx.currentLen
+func (m *fragmentedMessage) finished() bool {
+	return m.received == uint16(len(m.parts))
+}
+
+func (m *fragmentedMessage) assemble() []byte {
+	result := make([]byte, 0, m.size)
+	for _, p := range m.parts {
+		result = append(result, p...)
+	}
+	return result
 }
 
 func parseFragment(data []byte) (resultData []byte, ix uint16, length uint16, ok bool) {
@@ -80,55 +117,137 @@ func parseFragment(data []byte) (resultData []byte, ix uint16, length uint16, ok
 	return
 }
 
+// fragmentInstanceTag returns the sender instance tag of a version 3 fragment, or zero for version 2 fragments
+func fragmentInstanceTag(data []byte) uint32 {
+	if !bytes.HasPrefix(data, otrv3FragmentationPrefix) || len(data) < len(otrv3FragmentationPrefix)+8 {
+		return 0
+	}
+
+	tag, err := parseItag(data[len(otrv3FragmentationPrefix) : len(otrv3FragmentationPrefix)+8])
+	if err != nil {
+		return 0
+	}
+	return tag
+}
+
 func fragmentIsInvalid(ix, l uint16) bool {
 	return ix == 0 || l == 0 || ix > l
 }
 
-func fragmentIsFirstMessage(ix, l uint16) bool {
-	return ix == 1
+func (ctx *fragmentationContext) forget(tag uint32) {
+	if m, ok := ctx.messages[tag]; ok {
+		ctx.size -= m.size
+		delete(ctx.messages, tag)
+	}
 }
 
-func fragmentIsNextMessage(beforeCtx fragmentationContext, ix, l uint16) bool {
-	return beforeCtx.currentIndex+1 == ix && beforeCtx.currentLen == l
+func (ctx *fragmentationContext) forgetAll() {
+	ctx.messages = nil
+	ctx.size = 0
 }
 
-func (ctx fragmentationContext) discardFragment() fragmentationContext {
-	return ctx
+// oldest returns the instance tag of the message that has been reassembled the longest
+func (ctx *fragmentationContext) oldest() uint32 {
+	var result uint32
+	var started time.Time
+	for tag, m := range ctx.messages {
+		if started.IsZero() || m.started.Before(started) {
+			result, started = tag, m.started
+		}
+	}
+	return result
 }
 
-func (ctx fragmentationContext) appendFragment(data []byte, ix, l uint16) fragmentationContext {
-	return fragmentationContext{append(ctx.frag, data...), ix, l}
+// expireFragments drops all messages that have been incomplete for too long
+func (c *Conversation) expireFragments(now time.Time) {
+	for tag, m := range c.fragmentationContext.messages {
+		if now.Sub(m.started) > fragmentExpiry {
+			c.fragmentationContext.forget(tag)
+			c.messageEventWithError(MessageEventReceivedFragmentsDropped, errFragmentsExpired)
+		}
+	}
 }
 
-func restartFragment(data []byte, ix, l uint16) fragmentationContext {
-	return fragmentationContext{makeCopy(data), ix, l}
-}
+func (c *Conversation) fragmentedMessageFor(tag uint32, l uint16, now time.Time) *fragmentedMessage {
+	ctx := &c.fragmentationContext
+	if m, ok := ctx.messages[tag]; ok && len(m.parts) == int(l) {
+		return m
+	}
+
+	ctx.forget(tag)
+	if ctx.messages == nil {
+		ctx.messages = make(map[uint32]*fragmentedMessage)
+	}
 
-func forgetFragment() fragmentationContext {
-	return fragmentationContext{}
+	m := &fragmentedMessage{parts: make([][]byte, l), started: now}
+	ctx.messages[tag] = m
+	return m
 }
 
-func (c *Conversation) receiveFragment(beforeCtx fragmentationContext, data ValidMessage) (fragmentationContext, error) {
+// receiveFragment adds the fragment to the message being reassembled for the sender instance, and returns the message when it is complete.
+func (c *Conversation) receiveFragment(data ValidMessage) (complete []byte, err error) {
 	fragBody, ignore, ok1 := c.parseFragmentPrefix(data)
 	resultData, ix, l, ok2 := parseFragment(fragBody)
 
 	if ignore {
 		c.messageEvent(MessageEventReceivedMessageForOtherInstance)
-		return beforeCtx, nil
+		return nil, nil
 	}
 
 	if !ok1 || !ok2 {
-		return beforeCtx, newOtrError("invalid OTR fragment")
+		return nil, newOtrError("invalid OTR fragment")
 	}
 
-	switch {
-	case fragmentIsInvalid(ix, l):
-		return beforeCtx.discardFragment(), nil
-	case fragmentIsFirstMessage(ix, l):
-		return restartFragment(resultData, ix, l), nil
-	case fragmentIsNextMessage(beforeCtx, ix, l):
-		return beforeCtx.appendFragment(resultData, ix, l), nil
-	default:
-		return forgetFragment(), nil
+	if fragmentIsInvalid(ix, l) {
+		return nil, nil
 	}
+
+	limits := c.limits()
+	if int(l) > limits.MaxFragments {
+		c.exceededLimits(errTooManyFragments)
+		return nil, nil
+	}
+
+	now := c.now()
+	c.expireFragments(now)
+
+	tag := fragmentInstanceTag(data)
+	ctx := &c.fragmentationContext
+	m := c.fragmentedMessageFor(tag, l, now)
+
+	if m.parts[ix-1] != nil {
+		if ix != 1 {
+			return nil, nil
+		}
+		// A repeated first fragment means the peer has started sending a new message
+		ctx.forget(tag)
+		m = c.fragmentedMessageFor(tag, l, now)
+	}
+
+	if m.size+len(resultData) > limits.MaxFragmentedMessageSize {
+		ctx.forget(tag)
+		c.exceededLimits(errFragmentedMessageTooLarge)
+		return nil, nil
+	}
+
+	for ctx.size+len(resultData) > limits.MaxFragmentBufferSize {
+		oldest := ctx.oldest()
+		ctx.forget(oldest)
+		c.messageEventWithError(MessageEventReceivedFragmentsDropped, errFragmentBufferFull)
+		if oldest == tag {
+			return nil, nil
+		}
+	}
+
+	m.parts[ix-1] = makeCopy(resultData)
+	m.received++
+	m.size += len(resultData)
+	ctx.size += len(resultData)
+
+	if !m.finished() {
+		return nil, nil
+	}
+
+	ctx.forget(tag)
+	return m.assemble(), nil
 }
@@ -3,6 +3,7 @@ package otr3
 import (
 	"crypto/rand"
 	"testing"
+	"time"
 )
 
 const defaultInstanceTag = 0x00000100
@@ -91,44 +92,43 @@ func Test_fragment_returnsFragmentsForNeededFragmentationForV2(t *testing.T) {
 	})
 }
 
-func Test_receiveFragment_returnsANewFragmentationContextForANewMessage(t *testing.T) {
+func Test_receiveFragment_startsANewMessageForTheFirstFragment(t *testing.T) {
 	c := newConversation(otrV2{}, rand.Reader)
 	data := []byte("?OTR,00001,00004,one ,")
 
-	fctx, e := c.receiveFragment(fragmentationContext{}, data)
+	complete, e := c.receiveFragment(data)
 
-	assertDeepEquals(t, fctx.frag, []byte("one "))
+	assertNil(t, complete)
 	assertDeepEquals(t, e, nil)
-	assertEquals(t, fctx.currentIndex, uint16(1))
-	assertEquals(t, fctx.currentLen, uint16(4))
+	assertDeepEquals(t, c.fragmentationContext.messages[0].parts[0], []byte("one "))
+	assertEquals(t, c.fragmentationContext.messages[0].received, uint16(1))
+	assertEquals(t, len(c.fragmentationContext.messages[0].parts), 4)
 }
 
-func Test_receiveFragment_returnsANewFragmentationContextForANewV3Message(t *testing.T) {
+func Test_receiveFragment_startsANewMessageForTheFirstV3Fragment(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
 	c.ourInstanceTag = 0x102
 	c.theirInstanceTag = 0x100
 	data := []byte("?OTR|00000100|00000102,00001,00004,one ,")
 
-	fctx, e := c.receiveFragment(fragmentationContext{}, data)
+	complete, e := c.receiveFragment(data)
 
-	assertDeepEquals(t, fctx.frag, []byte("one "))
+	assertNil(t, complete)
 	assertDeepEquals(t, e, nil)
-	assertEquals(t, fctx.currentIndex, uint16(1))
-	assertEquals(t, fctx.currentLen, uint16(4))
+	assertDeepEquals(t, c.fragmentationContext.messages[0x100].parts[0], []byte("one "))
+	assertEquals(t, c.fragmentationContext.size, 4)
 }
 
-func Test_receiveFragment_returnsTheExistingContextIfTheInstanceTagsDoesNotMatch(t *testing.T) {
+func Test_receiveFragment_ignoresTheFragmentIfTheInstanceTagsDoesNotMatch(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
 	c.ourInstanceTag = 0x103
 	c.theirInstanceTag = 0x104
 
-	existingContext := fragmentationContext{frag: []byte("shouldn't change")}
+	c.receiveFragment([]byte("?OTR|00000204|00000103,00001,00004,one ,"))
+	assertEquals(t, len(c.fragmentationContext.messages), 0)
 
-	fctx, _ := c.receiveFragment(existingContext, []byte("?OTR|00000204|00000103,00001,00004,one ,"))
-	assertDeepEquals(t, fctx, existingContext)
-
-	fctx, _ = c.receiveFragment(existingContext, []byte("?OTR|00000104|00000203,00001,00004,one ,"))
-	assertDeepEquals(t, fctx, existingContext)
+	c.receiveFragment([]byte("?OTR|00000104|00000203,00001,00004,one ,"))
+	assertEquals(t, len(c.fragmentationContext.messages), 0)
 }
 
 func Test_receiveFragment_signalsMessageEventIfInstanceTagsDoesNotMatch(t *testing.T) {
@@ -136,10 +136,8 @@ func Test_receiveFragment_signalsMessageEventIfInstanceTagsDoesNotMatch(t *testi
 	c.ourInstanceTag = 0x103
 	c.theirInstanceTag = 0x104
 
-	existingContext := fragmentationContext{frag: []byte("shouldn't change")}
-
 	c.expectMessageEvent(t, func() {
-		c.receiveFragment(existingContext, []byte("?OTR|00000204|00000103,00001,00004,one ,"))
+		c.receiveFragment([]byte("?OTR|00000204|00000103,00001,00004,one ,"))
 	}, MessageEventReceivedMessageForOtherInstance, nil, nil)
 }
 
@@ -148,8 +146,6 @@ func Test_receiveFragment_sendsAnErrorMessageAboutMalformedIfHandlerExists(t *te
 	c.ourInstanceTag = 0x103
 	c.theirInstanceTag = 0x0A
 
-	existingContext := fragmentationContext{frag: []byte("shouldn't change")}
-
 	c.errorMessageHandler = dynamicErrorMessageHandler{
 		func(error ErrorCode) []byte {
 			if error == ErrorCodeMessageMalformed {
@@ -158,7 +154,7 @@ func Test_receiveFragment_sendsAnErrorMessageAboutMalformedIfHandlerExists(t *te
 			return []byte("white happened")
 		}}
 
-	c.receiveFragment(existingContext, []byte("?OTR|0000000A|00000103,00001,00004,one ,"))
+	c.receiveFragment([]byte("?OTR|0000000A|00000103,00001,00004,one ,"))
 	ts, _ := c.withInjections(nil, nil)
 	assertDeepEquals(t, string(ts[0]), "?OTR Error: black happened")
 }
@@ -168,69 +164,145 @@ func Test_receiveFragment_signalsMalformedMessageIfTheirInstanceTagIsBelowTheLim
 	c.ourInstanceTag = 0x103
 	c.theirInstanceTag = 0x0A
 
-	existingContext := fragmentationContext{frag: []byte("shouldn't change")}
-
 	c.expectMessageEvent(t, func() {
-		c.receiveFragment(existingContext, []byte("?OTR|0000000A|00000103,00001,00004,one ,"))
+		c.receiveFragment([]byte("?OTR|0000000A|00000103,00001,00004,one ,"))
 	}, MessageEventReceivedMessageMalformed, nil, nil)
 }
 
-func Test_receiveFragment_returnsTheSameContextIfMessageNumberIsZero(t *testing.T) {
+func Test_receiveFragment_ignoresTheFragmentIfMessageNumberIsZero(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	data := []byte("?OTR,00000,00004,one ,")
-	fctx, _ := c.receiveFragment(fragmentationContext{}, data)
-	assertDeepEquals(t, fctx, fragmentationContext{})
+	c.receiveFragment([]byte("?OTR,00000,00004,one ,"))
+	assertDeepEquals(t, c.fragmentationContext, fragmentationContext{})
 }
 
-func Test_receiveFragment_returnsTheSameContextIfMessageCountIsZero(t *testing.T) {
+func Test_receiveFragment_ignoresTheFragmentIfMessageCountIsZero(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	data := []byte("?OTR,00001,00000,one ,")
-	fctx, _ := c.receiveFragment(fragmentationContext{}, data)
-	assertDeepEquals(t, fctx, fragmentationContext{})
+	c.receiveFragment([]byte("?OTR,00001,00000,one ,"))
+	assertDeepEquals(t, c.fragmentationContext, fragmentationContext{})
 }
 
-func Test_receiveFragment_returnsTheSameContextIfMessageNumberIsAboveMessageCount(t *testing.T) {
+func Test_receiveFragment_ignoresTheFragmentIfMessageNumberIsAboveMessageCount(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	data := []byte("?OTR,00005,00004,one ,")
-	fctx, _ := c.receiveFragment(fragmentationContext{}, data)
-	assertDeepEquals(t, fctx, fragmentationContext{})
+	c.receiveFragment([]byte("?OTR,00005,00004,one ,"))
+	assertDeepEquals(t, c.fragmentationContext, fragmentationContext{})
+}
+
+func Test_receiveFragment_returnsTheMessageWhenAllFragmentsHaveArrived(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+
+	c.receiveFragment([]byte("?OTR,00001,00003,one ,"))
+	c.receiveFragment([]byte("?OTR,00002,00003,two ,"))
+	complete, _ := c.receiveFragment([]byte("?OTR,00003,00003,three,"))
+
+	assertDeepEquals(t, complete, []byte("one two three"))
+	assertEquals(t, len(c.fragmentationContext.messages), 0)
+	assertEquals(t, c.fragmentationContext.size, 0)
+}
+
+func Test_receiveFragment_acceptsFragmentsOutOfOrder(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+
+	c.receiveFragment([]byte("?OTR,00003,00003,three,"))
+	c.receiveFragment([]byte("?OTR,00001,00003,one ,"))
+	complete, _ := c.receiveFragment([]byte("?OTR,00002,00003,two ,"))
+
+	assertDeepEquals(t, complete, []byte("one two three"))
 }
 
-func Test_receiveFragment_returnsTheNextContextIfMessageNumberIsOneMoreThanThePreviousOne(t *testing.T) {
+func Test_receiveFragment_ignoresDuplicatedFragments(t *testing.T) {
 	c := newConversation(otrV2{}, rand.Reader)
-	data := []byte("?OTR,00003,00004, one,")
-	fctx, _ := c.receiveFragment(fragmentationContext{[]byte("blarg one two"), 2, 4}, data)
-	assertDeepEquals(t, fctx, fragmentationContext{[]byte("blarg one two one"), 3, 4})
+
+	c.receiveFragment([]byte("?OTR,00001,00003,one ,"))
+	c.receiveFragment([]byte("?OTR,00002,00003,two ,"))
+	c.receiveFragment([]byte("?OTR,00002,00003,owt ,"))
+	complete, _ := c.receiveFragment([]byte("?OTR,00003,00003,three,"))
+
+	assertDeepEquals(t, complete, []byte("one two three"))
 }
 
-func Test_receiveFragment_resetsTheContextIfTheMessageCountIsNotTheSame(t *testing.T) {
+func Test_receiveFragment_restartsTheMessageIfTheMessageCountIsNotTheSame(t *testing.T) {
 	c := newConversation(otrV2{}, rand.Reader)
-	data := []byte("?OTR,00003,00005, one,")
-	fctx, _ := c.receiveFragment(fragmentationContext{[]byte("blarg one two"), 2, 4}, data)
-	assertDeepEquals(t, fctx, fragmentationContext{})
+
+	c.receiveFragment([]byte("?OTR,00001,00003,one ,"))
+	c.receiveFragment([]byte("?OTR,00002,00002,two,"))
+
+	assertEquals(t, len(c.fragmentationContext.messages[0].parts), 2)
+	assertEquals(t, c.fragmentationContext.messages[0].received, uint16(1))
+	assertEquals(t, c.fragmentationContext.size, 3)
 }
 
-func Test_receiveFragment_resetsTheContextIfTheMessageNumberIsNotExactlyOnePlus(t *testing.T) {
+func Test_receiveFragment_restartsTheMessageIfTheFirstFragmentIsRepeated(t *testing.T) {
 	c := newConversation(otrV2{}, rand.Reader)
-	data := []byte("?OTR,00004,00005, one,")
-	fctx, _ := c.receiveFragment(fragmentationContext{[]byte("blarg one two"), 2, 5}, data)
-	assertDeepEquals(t, fctx, fragmentationContext{})
+
+	c.receiveFragment([]byte("?OTR,00001,00002,one ,"))
+	c.receiveFragment([]byte("?OTR,00001,00002,uno ,"))
+	complete, _ := c.receiveFragment([]byte("?OTR,00002,00002,dos,"))
+
+	assertDeepEquals(t, complete, []byte("uno dos"))
+}
+
+func Test_receiveFragment_keepsMessagesFromDifferentInstancesApart(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourInstanceTag = 0x103
+	c.theirInstanceTag = 0
+
+	c.receiveFragment([]byte("?OTR|00000104|00000103,00001,00002,one ,"))
+	c.receiveFragment([]byte("?OTR|00000105|00000103,00001,00002,uno ,"))
+	second, _ := c.receiveFragment([]byte("?OTR|00000105|00000103,00002,00002,dos,"))
+	first, _ := c.receiveFragment([]byte("?OTR|00000104|00000103,00002,00002,two,"))
+
+	assertDeepEquals(t, first, []byte("one two"))
+	assertDeepEquals(t, second, []byte("uno dos"))
 }
 
-func Test_fragmentFinished_isFalseIfThereAreNoFragments(t *testing.T) {
-	assertDeepEquals(t, fragmentsFinished(fragmentationContext{[]byte{}, 0, 0}), false)
+func Test_receiveFragment_dropsMessagesThatHaveExpired(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.receiveFragment([]byte("?OTR,00001,00002,one ,"))
+	c.fragmentationContext.messages[0].started = time.Now().Add(-fragmentExpiry - time.Second)
+
+	c.expectMessageEvent(t, func() {
+		c.receiveFragment([]byte("?OTR,00002,00002,two,"))
+	}, MessageEventReceivedFragmentsDropped, nil, errFragmentsExpired)
+
+	assertEquals(t, c.fragmentationContext.messages[0].received, uint16(1))
+	assertEquals(t, c.fragmentationContext.size, 3)
 }
 
-func Test_fragmentFinished_isFalseIfTheNumberOfFragmentsIsNotTheSame(t *testing.T) {
-	assertDeepEquals(t, fragmentsFinished(fragmentationContext{[]byte{}, 1, 2}), false)
+func Test_receiveFragment_dropsMessagesThatAreTooLarge(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.receiveFragment([]byte("?OTR,00001,00002,one ,"))
+	c.fragmentationContext.messages[0].size = DefaultLimits.MaxFragmentedMessageSize - 1
+	c.fragmentationContext.size = DefaultLimits.MaxFragmentedMessageSize - 1
+
+	c.expectMessageEvent(t, func() {
+		c.receiveFragment([]byte("?OTR,00002,00002,two,"))
+	}, MessageEventReceivedMessageExceedsLimits, nil, errFragmentedMessageTooLarge)
+
+	assertEquals(t, len(c.fragmentationContext.messages), 0)
+	assertEquals(t, c.fragmentationContext.size, 0)
 }
 
-func Test_fragmentFinished_isFalseIfTheNumberOfFragmentsIsNotTheSameWhereTheNumberIsHigher(t *testing.T) {
-	assertDeepEquals(t, fragmentsFinished(fragmentationContext{[]byte{}, 3, 2}), false)
+func Test_receiveFragment_dropsTheOldestMessageWhenTooMuchMemoryIsUsed(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourInstanceTag = 0x103
+	c.theirInstanceTag = 0
+
+	c.receiveFragment([]byte("?OTR|00000104|00000103,00001,00002,one ,"))
+	c.fragmentationContext.messages[0x104].started = time.Now().Add(-time.Second)
+	c.fragmentationContext.size = DefaultLimits.MaxFragmentBufferSize - 1
+
+	c.expectMessageEvent(t, func() {
+		c.receiveFragment([]byte("?OTR|00000105|00000103,00001,00002,uno ,"))
+	}, MessageEventReceivedFragmentsDropped, nil, errFragmentBufferFull)
+
+	assertNil(t, c.fragmentationContext.messages[0x104])
+	assertEquals(t, c.fragmentationContext.messages[0x105].received, uint16(1))
 }
 
-func Test_fragmentFinished_isTrueIfTheNumberIsTheSameAsTheCount(t *testing.T) {
-	assertDeepEquals(t, fragmentsFinished(fragmentationContext{[]byte{}, 3, 3}), true)
+func Test_fragmentInstanceTag_returnsTheSenderInstanceTag(t *testing.T) {
+	assertEquals(t, fragmentInstanceTag([]byte("?OTR|00000104|00000103,00001,00002,one ,")), uint32(0x104))
+	assertEquals(t, fragmentInstanceTag([]byte("?OTR,00001,00002,one ,")), uint32(0))
+	assertEquals(t, fragmentInstanceTag([]byte("?OTR|0000")), uint32(0))
 }
 
 func Test_parseFragment_returnsNotOKIfThereAreNotEnoughParts(t *testing.T) {
@@ -260,7 +332,7 @@ func Test_parseFragment_returnsOKIfThereAreExactlyTheRightAmountOfParts(t *testi
 
 func Test_receiveFragment_returnsErrorIfTheFragmentIsNotCorrect(t *testing.T) {
 	c := newConversation(otrV2{}, rand.Reader)
-	_, e := c.receiveFragment(fragmentationContext{}, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x30, 0x30, 0x30, 0x30, 0x29, 0x2C, 0x30, 0x30, 0x30, 0x30, 0x31, 0x2C, 0x01, 0x2C})
+	_, e := c.receiveFragment([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x30, 0x30, 0x30, 0x30, 0x29, 0x2C, 0x30, 0x30, 0x30, 0x30, 0x31, 0x2C, 0x01, 0x2C})
 	assertDeepEquals(t, e, newOtrError("invalid OTR fragment"))
 }
 
@@ -305,3 +377,45 @@ func Test_parseFragmentPrefix_rejectsVersion3IfNotAllowedByThePolicy(t *testing.
 	assertEquals(t, ignore, true)
 	assertEquals(t, c.version, nil)
 }
+
+func Test_Receive_reassemblesFragmentsFromSeveralInstancesOfThePeer(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.Policies = policies(allowV3)
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+
+	bobs := make([]*Conversation, 2)
+	answers := make([][]ValidMessage, 2)
+	for i := range bobs {
+		bobs[i] = &Conversation{Rand: rand.Reader}
+		bobs[i].Policies = policies(allowV3)
+		bobs[i].SetOurKeys([]PrivateKey{bobPrivateKey})
+		bobs[i].SetFragmentSize(100)
+		_, answers[i], _ = bobs[i].Receive(alice.QueryMessage())
+	}
+
+	// The second instance goes away after its first fragment, and the fragments of the first one arrive after it
+	_, toSend, err := alice.Receive(answers[1][0])
+	assertNil(t, err)
+	assertNil(t, toSend)
+
+	for _, f := range answers[0] {
+		_, toSend, err = alice.Receive(f)
+		assertNil(t, err)
+	}
+
+	for len(toSend) > 0 {
+		var next []ValidMessage
+		for _, m := range toSend {
+			_, ts, _ := bobs[0].Receive(m)
+			for _, mm := range ts {
+				_, reply, _ := alice.Receive(mm)
+				next = append(next, reply...)
+			}
+		}
+		toSend = next
+	}
+
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bobs[0].IsEncrypted())
+	assertFalse(t, bobs[1].IsEncrypted())
+}
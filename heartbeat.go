@@ -3,14 +3,28 @@ package otr3
 import "time"
 
 // How long after sending a packet should we wait to send a heartbeat?
-const heartbeatInterval = 60 * time.Second
+const defaultHeartbeatInterval = 60 * time.Second
 
 type heartbeatContext struct {
 	lastSent time.Time
+	interval time.Duration
+}
+
+// SetHeartbeatInterval sets how long after the last message sent a heartbeat should be sent in response to an incoming message.
+// A negative interval disables heartbeats, which can be useful on metered links. Zero restores the default of 60 seconds.
+func (c *Conversation) SetHeartbeatInterval(d time.Duration) {
+	c.heartbeat.interval = d
+}
+
+func (h *heartbeatContext) heartbeatInterval() time.Duration {
+	if h.interval == 0 {
+		return defaultHeartbeatInterval
+	}
+	return h.interval
 }
 
 func (c *Conversation) updateLastSent() {
-	c.heartbeat.lastSent = time.Now()
+	c.heartbeat.lastSent = c.now()
 }
 
 func (c *Conversation) maybeHeartbeat(plain MessagePlaintext, toSend messageWithHeader, err error) (MessagePlaintext, []messageWithHeader, error) {
@@ -22,12 +36,13 @@ func (c *Conversation) maybeHeartbeat(plain MessagePlaintext, toSend messageWith
 }
 
 func (c *Conversation) potentialHeartbeat(plain MessagePlaintext) (toSend messageWithHeader, err error) {
-	if plain == nil {
+	interval := c.heartbeat.heartbeatInterval()
+	if plain == nil || interval < 0 {
 		return
 	}
 
-	now := time.Now()
-	if !c.heartbeat.lastSent.Before(now.Add(-heartbeatInterval)) {
+	now := c.now()
+	if !c.heartbeat.lastSent.Before(now.Add(-interval)) {
 		return
 	}
 
@@ -81,3 +81,25 @@ func Test_potentialHeartbeat_returnsAnErrorIfWeCantPutTogetherAMessage(t *testin
 	_, err := c.potentialHeartbeat(plain)
 	assertDeepEquals(t, err, newOtrConflictError("invalid key id for local peer"))
 }
+
+func Test_potentialHeartbeat_usesTheHeartbeatIntervalSet(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetHeartbeatInterval(5 * time.Second)
+	c.heartbeat.lastSent = time.Now().Add(-10 * time.Second)
+
+	ret, err := c.potentialHeartbeat([]byte("Foo plain"))
+	assertNil(t, err)
+	assertTrue(t, ret != nil)
+}
+
+func Test_potentialHeartbeat_doesntSendHeartbeatsWhenDisabled(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetHeartbeatInterval(-1)
+	c.heartbeat.lastSent = time.Now().Add(-time.Hour)
+
+	ret, err := c.potentialHeartbeat([]byte("Foo plain"))
+	assertNil(t, ret)
+	assertNil(t, err)
+}
@@ -112,11 +112,15 @@ func newConversation(v otrVersion, rand io.Reader) *Conversation {
 	akeNotStarted := new(ake)
 	akeNotStarted.state = authStateNone{}
 
+	// The fixed test data doesn't look random, so it would fail the health tests
+	_, fixed := rand.(*fixedRandReader)
+
 	return &Conversation{
-		version: v,
-		Rand:    rand,
+		version:                       v,
+		Rand:                          rand,
+		randomnessHealthTestsDisabled: fixed,
 		smp: smp{
-			state: smpStateExpect1{},
+			SMP: SMP{state: smpStateExpect1{}},
 		},
 		ake:              akeNotStarted,
 		Policies:         policies(p),
@@ -12,6 +12,8 @@ import (
 type dhKeyPair struct {
 	pub  *big.Int
 	priv *big.Int
+	// privMemory holds the words of priv, if it could be allocated
+	privMemory *SecretBuffer
 }
 
 type akeKeys struct {
@@ -28,6 +30,8 @@ type sessionKeys struct {
 	sendingMACKey, receivingMACKey macKey
 	// SIZE: this will be the same size as version.hash2Length
 	extraKey []byte
+	// memory holds all the keys, if it could be allocated
+	memory *SecretBuffer
 }
 
 type macKeyUsage struct {
@@ -132,8 +136,16 @@ func (k *keyManagementContext) setTheirCurrentDHPubKey(key *big.Int) {
 }
 
 func (k *keyManagementContext) setOurCurrentDHKeys(priv *big.Int, pub *big.Int) {
-	k.ourCurrentDHKeys.priv = setBigInt(k.ourCurrentDHKeys.priv, priv)
-	k.ourCurrentDHKeys.pub = setBigInt(k.ourCurrentDHKeys.pub, pub)
+	keys := newDHKeyPair(new(big.Int).Set(priv), new(big.Int).Set(pub))
+	k.ourCurrentDHKeys.wipe()
+	k.ourCurrentDHKeys = keys
+}
+
+// newDHKeyPair returns a key pair with the private key moved into secret memory
+func newDHKeyPair(priv, pub *big.Int) dhKeyPair {
+	p := dhKeyPair{pub: pub}
+	p.priv, p.privMemory = newSecretInt(priv)
+	return p
 }
 
 func (k *keyManagementContext) checkMessageCounter(message dataMsg) error {
@@ -163,10 +175,7 @@ func (k *keyManagementContext) generateNewDHKeyPair(randomness io.Reader) error
 	k.ourPreviousDHKeys.wipe()
 	k.ourPreviousDHKeys = k.ourCurrentDHKeys
 
-	k.ourCurrentDHKeys = dhKeyPair{
-		priv: newPrivKey,
-		pub:  modExp(g1, newPrivKey),
-	}
+	k.ourCurrentDHKeys = newDHKeyPair(newPrivKey, modExp(g1, newPrivKey))
 	k.ourKeyID++
 	return nil
 }
@@ -222,7 +231,8 @@ func (k *keyManagementContext) calculateDHSessionKeys(ourKeyID, theirKeyID uint3
 	}
 
 	ret = calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey, v)
-	k.macKeyHistory.addKeys(ourKeyID, theirKeyID, ret.receivingMACKey)
+	// The receiving MAC key is revealed later, so the history keeps its own copy outside of secret memory
+	k.macKeyHistory.addKeys(ourKeyID, theirKeyID, makeCopy(ret.receivingMACKey))
 
 	return ret, nil
 }
@@ -239,22 +249,57 @@ func calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey *big.Int, v otrVe
 		sendbyte, recvbyte = 0x02, 0x01
 	}
 
-	s := new(big.Int).Exp(theirPubKey, ourPrivKey, p)
+	s := modExp(theirPubKey, ourPrivKey)
 	secbytes := gotrax.AppendMPI(nil, s)
+	defer wipeBigInt(s)
+	defer wipeBytes(secbytes)
 
 	sha := v.hashInstance()
 
-	ret.sendingAESKey = h(sendbyte, secbytes, sha)[:v.keyLength()]
-	ret.receivingAESKey = h(recvbyte, secbytes, sha)[:v.keyLength()]
-
-	ret.sendingMACKey = v.hash(ret.sendingAESKey)
-	ret.receivingMACKey = v.hash(ret.receivingAESKey)
+	sendingHash := h(sendbyte, secbytes, sha)
+	receivingHash := h(recvbyte, secbytes, sha)
+	defer wipeBytes(sendingHash)
+	defer wipeBytes(receivingHash)
+
+	sendingAESKey := sendingHash[:v.keyLength()]
+	receivingAESKey := receivingHash[:v.keyLength()]
+	sendingMACKey := v.hash(sendingAESKey)
+	receivingMACKey := v.hash(receivingAESKey)
+	extraKey := h(0xFF, secbytes, v.hash2Instance())
+
+	size := len(sendingAESKey) + len(receivingAESKey) + len(sendingMACKey) + len(receivingMACKey) + len(extraKey)
+	mem := make([]byte, size)
+	if b, err := NewSecretBuffer(size); err == nil {
+		ret.memory, mem = b, b.Bytes()
+	}
 
-	ret.extraKey = h(0xFF, secbytes, v.hash2Instance())
+	ret.sendingAESKey, mem = moveInto(mem, sendingAESKey)
+	ret.receivingAESKey, mem = moveInto(mem, receivingAESKey)
+	ret.sendingMACKey, mem = moveInto(mem, sendingMACKey)
+	ret.receivingMACKey, mem = moveInto(mem, receivingMACKey)
+	ret.extraKey, _ = moveInto(mem, extraKey)
 
 	return ret
 }
 
+// moveInto copies src to the start of mem and wipes it. It returns the copy and the rest of mem.
+func moveInto(mem, src []byte) ([]byte, []byte) {
+	n := copy(mem, src)
+	wipeBytes(src)
+	return mem[:n:n], mem[n:]
+}
+
+// destroy wipes the keys and frees the memory they are kept in
+func (k *sessionKeys) destroy() {
+	wipeBytes(k.sendingAESKey)
+	wipeBytes(k.receivingAESKey)
+	wipeBytes(k.sendingMACKey)
+	wipeBytes(k.receivingMACKey)
+	wipeBytes(k.extraKey)
+	k.memory.Destroy()
+	*k = sessionKeys{}
+}
+
 func (k *keyManagementContext) pickOurKeys(ourKeyID uint32) (privKey, pubKey *big.Int, err error) {
 	if ourKeyID == 0 || k.ourKeyID == 0 {
 		return nil, nil, newOtrConflictError("invalid key id for local peer")
@@ -70,6 +70,8 @@ type DSAPublicKey struct {
 type DSAPrivateKey struct {
 	DSAPublicKey
 	dsa.PrivateKey
+	// xMemory holds the words of X, once it has been moved into secret memory
+	xMemory *SecretBuffer
 }
 
 // Account is a holder for the private key associated with an account
@@ -231,6 +233,7 @@ func readPrivateKey(r *bufio.Reader) (PrivateKey, bool) {
 	if ok2 {
 		k.PrivateKey = *res
 		k.DSAPublicKey.PublicKey = k.PrivateKey.PublicKey
+		k.protectX()
 	}
 	ok3 := sexp.ReadListEnd(r)
 	return k, ok1 && ok2 && ok3
@@ -345,11 +348,32 @@ func (priv *DSAPrivateKey) Parse(in []byte) (index []byte, ok bool) {
 	}
 
 	priv.PrivateKey.PublicKey = priv.DSAPublicKey.PublicKey
-	index, priv.X, ok = gotrax.ExtractMPI(in)
+	if index, priv.X, ok = gotrax.ExtractMPI(in); ok {
+		priv.protectX()
+	}
 
 	return index, ok
 }
 
+// protectX moves the private part of the key into secret memory
+func (priv *DSAPrivateKey) protectX() {
+	if priv.X == nil {
+		return
+	}
+
+	x, mem := newSecretInt(priv.X)
+	priv.xMemory.Destroy()
+	priv.X, priv.xMemory = x, mem
+}
+
+// Destroy wipes the private part of the key and frees the secret memory it is kept in. The key can't be used to sign afterwards.
+func (priv *DSAPrivateKey) Destroy() {
+	wipeBigInt(priv.X)
+	priv.xMemory.Destroy()
+	priv.X = nil
+	priv.xMemory = nil
+}
+
 var dsaKeyType = []byte{0x00, 0x00}
 var dsaKeyTypeValue = uint16(0x0000)
 
@@ -477,7 +501,12 @@ func (priv *DSAPrivateKey) Import(in []byte) bool {
 	priv.DSAPublicKey.PublicKey = priv.PrivateKey.PublicKey
 
 	a := new(big.Int).Exp(priv.PrivateKey.G, priv.PrivateKey.X, priv.PrivateKey.P)
-	return a.Cmp(priv.PrivateKey.Y) == 0
+	if a.Cmp(priv.PrivateKey.Y) != 0 {
+		return false
+	}
+
+	priv.protectX()
+	return true
 }
 
 // Generate will generate a new DSA Private Key with the randomness provided. The parameter size used is 1024 and 160.
@@ -489,6 +518,7 @@ func (priv *DSAPrivateKey) Generate(rand io.Reader) error {
 		return err
 	}
 	priv.DSAPublicKey.PublicKey = priv.PrivateKey.PublicKey
+	priv.protectX()
 	return nil
 }
 
@@ -0,0 +1,139 @@
+package otr3
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/coyim/gotrax"
+)
+
+// Limits restricts the size of the input accepted from the peer, so that a malicious peer can't make us allocate
+// large amounts of memory or spend time on expensive computations. Input exceeding the limits is rejected with
+// a MessageEventReceivedMessageExceedsLimits event. A zero value in any field means the default limit is used.
+type Limits struct {
+	// MaxEncodedMessageSize is the largest base64 encoded OTR message accepted, after reassembling fragments
+	MaxEncodedMessageSize int
+	// MaxFragments is the largest number of fragments a message can be split in
+	MaxFragments int
+	// MaxFragmentedMessageSize is the largest total size of the fragments of a single message
+	MaxFragmentedMessageSize int
+	// MaxFragmentBufferSize is the largest amount of memory used by all incomplete fragmented messages together.
+	// When it is reached, the oldest incomplete messages are dropped to make room for new fragments.
+	MaxFragmentBufferSize int
+	// MaxTLVs is the largest number of TLVs accepted in a single data message. Decrypted data messages stop being
+	// parsed as soon as it is exceeded.
+	MaxTLVs int
+	// MaxSMPBits is the largest bit length accepted for the values in SMP messages
+	MaxSMPBits int
+	// MaxRetention is the longest retention accepted from the peer. Longer retentions are shortened to it.
+	MaxRetention time.Duration
+	// MaxPendingExpiries is the largest number of received messages waiting for their retention to elapse. Messages
+	// received beyond it are still returned, but their expiry is not reported and their ExpiresAt is left zero.
+	MaxPendingExpiries int
+}
+
+// DefaultLimits are the limits used unless others are set with SetLimits. Since all valid SMP values are smaller than
+// the 1536 bit prime of the group, the default bit length limit never rejects valid input. Diffie-Hellman values don't need
+// a limit, since they are rejected unless they are in the group before they are used.
+var DefaultLimits = Limits{
+	MaxEncodedMessageSize:    1024 * 1024,
+	MaxFragments:             4096,
+	MaxFragmentedMessageSize: 1024 * 1024,
+	MaxFragmentBufferSize:    4 * 1024 * 1024,
+	MaxTLVs:                  64,
+	MaxSMPBits:               1536,
+	MaxRetention:             30 * 24 * time.Hour,
+	MaxPendingExpiries:       4096,
+}
+
+var errEncodedMessageTooLarge = newOtrError("encoded message is too large")
+var errTooManyFragments = newOtrError("message has too many fragments")
+var errTooManyTLVs = newOtrError("data message has too many TLVs")
+var errMPITooLarge = newOtrError("MPI value is too large")
+var errTooManyPendingExpiries = newOtrError("too many received messages are waiting for their retention to elapse")
+
+// SetLimits sets the limits for the input accepted from the peer
+func (c *Conversation) SetLimits(l Limits) {
+	c.inputLimits = l
+}
+
+// limits returns the limits in use, with the defaults filled in for the ones not set
+func (c *Conversation) limits() Limits {
+	l := c.inputLimits
+	d := DefaultLimits
+
+	l.MaxEncodedMessageSize = limitOrDefault(l.MaxEncodedMessageSize, d.MaxEncodedMessageSize)
+	l.MaxFragments = limitOrDefault(l.MaxFragments, d.MaxFragments)
+	l.MaxFragmentedMessageSize = limitOrDefault(l.MaxFragmentedMessageSize, d.MaxFragmentedMessageSize)
+	l.MaxFragmentBufferSize = limitOrDefault(l.MaxFragmentBufferSize, d.MaxFragmentBufferSize)
+	l.MaxTLVs = limitOrDefault(l.MaxTLVs, d.MaxTLVs)
+	l.MaxSMPBits = limitOrDefault(l.MaxSMPBits, d.MaxSMPBits)
+	l.MaxPendingExpiries = limitOrDefault(l.MaxPendingExpiries, d.MaxPendingExpiries)
+	if l.MaxRetention <= 0 {
+		l.MaxRetention = d.MaxRetention
+	}
+
+	return l
+}
+
+func limitOrDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+func isLimitError(err error) bool {
+	switch err {
+	case errEncodedMessageTooLarge, errTooManyFragments, errFragmentedMessageTooLarge, errTooManyTLVs, errMPITooLarge, errTooManyPendingExpiries:
+		return true
+	}
+	return false
+}
+
+// exceededLimits notifies the application that input was rejected, and returns the error given
+func (c *Conversation) exceededLimits(err error) error {
+	c.messageEventWithError(MessageEventReceivedMessageExceedsLimits, err)
+	return err
+}
+
+// checkSMPLimits checks the values of an SMP message before it is parsed and used in any computation
+func (c *Conversation) checkSMPLimits(t tlv) error {
+	if err := checkSMPBits(t, c.limits().MaxSMPBits); err != nil {
+		return c.exceededLimits(err)
+	}
+	return nil
+}
+
+func checkSMPBits(t tlv, maxBits int) error {
+	value := t.tlvValue
+	if t.tlvType == tlvTypeSMP1WithQuestion {
+		nulPos := bytes.IndexByte(value, 0)
+		if nulPos == -1 {
+			return nil
+		}
+		value = value[nulPos+1:]
+	}
+
+	_, mpis, ok := extractMPIs(value)
+	if !ok {
+		return nil
+	}
+
+	for _, m := range mpis {
+		if m.BitLen() > maxBits {
+			return errMPITooLarge
+		}
+	}
+	return nil
+}
+
+func extractMPIs(d []byte) ([]byte, []*big.Int, bool) {
+	current, mpiCount, ok := gotrax.ExtractWord(d)
+	if !ok || int64(mpiCount)*4 > int64(len(current)) {
+		return nil, nil, false
+	}
+
+	return gotrax.ExtractMPIs(d)
+}
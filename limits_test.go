@@ -0,0 +1,102 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/coyim/gotrax"
+)
+
+func Test_limits_usesTheDefaultsForLimitsNotSet(t *testing.T) {
+	c := &Conversation{}
+	c.SetLimits(Limits{MaxTLVs: 3})
+
+	l := c.limits()
+
+	assertEquals(t, l.MaxTLVs, 3)
+	assertEquals(t, l.MaxEncodedMessageSize, DefaultLimits.MaxEncodedMessageSize)
+	assertEquals(t, l.MaxSMPBits, DefaultLimits.MaxSMPBits)
+}
+
+func Test_decode_rejectsMessagesLargerThanTheLimit(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.SetLimits(Limits{MaxEncodedMessageSize: 10})
+
+	c.expectMessageEvent(t, func() {
+		_, err := c.decode(encodedMessage("?OTR:AAMDAAAAAQ==."))
+		assertEquals(t, err, errEncodedMessageTooLarge)
+	}, MessageEventReceivedMessageExceedsLimits, nil, errEncodedMessageTooLarge)
+}
+
+func Test_receiveFragment_rejectsMessagesWithTooManyFragments(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetLimits(Limits{MaxFragments: 2})
+
+	c.expectMessageEvent(t, func() {
+		complete, err := c.receiveFragment([]byte("?OTR,00001,00003,one ,"))
+		assertNil(t, complete)
+		assertNil(t, err)
+	}, MessageEventReceivedMessageExceedsLimits, nil, errTooManyFragments)
+
+	assertEquals(t, len(c.fragmentationContext.messages), 0)
+}
+
+func Test_receiveFragment_usesTheFragmentedMessageSizeLimit(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetLimits(Limits{MaxFragmentedMessageSize: 6})
+	c.receiveFragment([]byte("?OTR,00001,00002,one ,"))
+
+	c.expectMessageEvent(t, func() {
+		c.receiveFragment([]byte("?OTR,00002,00002,two,"))
+	}, MessageEventReceivedMessageExceedsLimits, nil, errFragmentedMessageTooLarge)
+}
+
+func Test_processDataMessage_rejectsMessagesWithTooManyTLVs(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	bob.SetLimits(Limits{MaxTLVs: 1})
+
+	msg, _ := alice.SendWithTLVs(ValidMessage("hello"), []TLV{{Type: 0x1000}, {Type: 0x1001}})
+
+	bob.expectMessageEvent(t, func() {
+		plain, _, err := bob.Receive(msg[0])
+		assertNil(t, plain)
+		assertEquals(t, err, errTooManyTLVs)
+	}, MessageEventReceivedMessageExceedsLimits, nil, errTooManyTLVs)
+}
+
+func Test_processSMPTLV_rejectsValuesLargerThanTheLimit(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.SetLimits(Limits{MaxSMPBits: 8})
+
+	value := gotrax.AppendWord(nil, 1)
+	value = gotrax.AppendMPI(value, big.NewInt(0x100))
+
+	c.expectMessageEvent(t, func() {
+		_, err := c.processSMPTLV(tlv{tlvType: tlvTypeSMP4, tlvLength: uint16(len(value)), tlvValue: value}, dataMessageExtra{})
+		assertEquals(t, err, errMPITooLarge)
+	}, MessageEventReceivedMessageExceedsLimits, nil, errMPITooLarge)
+}
+
+func Test_plainDataMsg_deserializeWithTLVLimit_stopsAsSoonAsTheLimitIsExceeded(t *testing.T) {
+	msg := append([]byte("hi"), 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00)
+	// The third TLV is truncated, so it would fail to parse if it was reached
+	msg = append(msg, 0x00, 0x03, 0x00, 0x10)
+
+	p := plainDataMsg{}
+	assertEquals(t, p.deserializeWithTLVLimit(msg, 1), errTooManyTLVs)
+	assertEquals(t, len(p.tlvs), 1)
+
+	p = plainDataMsg{}
+	assertNil(t, p.deserializeWithTLVLimit(msg[:len(msg)-4], 2))
+	assertEquals(t, len(p.tlvs), 2)
+}
+
+func Test_extractMPIs_rejectsCountsLargerThanTheData(t *testing.T) {
+	_, _, ok := extractMPIs([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00})
+	assertFalse(t, ok)
+
+	_, mpis, ok := extractMPIs(gotrax.AppendMPI(gotrax.AppendWord(nil, 1), big.NewInt(5)))
+	assertTrue(t, ok)
+	assertDeepEquals(t, mpis, []*big.Int{big.NewInt(5)})
+}
@@ -43,7 +43,8 @@ const (
 	// MessageEventLogHeartbeatSent is triggered when we have sent a heartbeat.
 	MessageEventLogHeartbeatSent
 
-	// MessageEventReceivedMessageGeneralError will be signaled when we receive an OTR error from the peer.
+	// MessageEventReceivedMessageGeneralError will be signaled when we receive an OTR error from the peer that isn't one of
+	// the standard ones, which are signaled as MessageEventReceivedMessageKnownError instead.
 	// The message parameter will be passed, containing the error message
 	MessageEventReceivedMessageGeneralError
 
@@ -56,6 +57,32 @@ const (
 
 	// MessageEventReceivedMessageForOtherInstance is triggered when we receive and discard a message for another instance
 	MessageEventReceivedMessageForOtherInstance
+
+	// MessageEventReceivedSymmetricKeyForUnknownUsage is triggered when the peer asks us to use the extra symmetric key
+	// for a usage we have no handler for. The usage data will be passed as the message, and the usage as the trace.
+	MessageEventReceivedSymmetricKeyForUnknownUsage
+
+	// MessageEventReceivedFragmentsDropped is triggered when an incomplete fragmented message is discarded, either because it took
+	// too long for all fragments to arrive or because it used too much memory. The reason will be passed as the error.
+	MessageEventReceivedFragmentsDropped
+
+	// MessageEventReceivedMessageExceedsLimits is triggered when we receive a message that is rejected because it exceeds
+	// the limits set with SetLimits, or whose expiry can't be reported because of them. The limit exceeded will be described by the error.
+	MessageEventReceivedMessageExceedsLimits
+
+	// MessageEventRandomnessFailure is signaled when the random source fails its health tests. This is fatal: nothing that
+	// needs randomness, like starting an AKE or generating new keys, will work until Rand is set to a working source.
+	// The failure will be described by the error.
+	MessageEventRandomnessFailure
+
+	// MessageEventAuditLogFailure is signaled when the sink of the audit log fails to store a record. The record is
+	// missing from the log, and the error returned by the sink will be passed as the error.
+	MessageEventAuditLogFailure
+
+	// MessageEventReceivedMessageKnownError is signaled instead of MessageEventReceivedMessageGeneralError when we receive
+	// one of the standard OTR error messages sent by libotr based clients. The text will be passed as the message, and the
+	// ErrorCode it stands for as the trace. The PeerErrorHandler gets the same ErrorCode as a typed argument.
+	MessageEventReceivedMessageKnownError
 )
 
 // MessageEventHandler handles MessageEvents
@@ -73,20 +100,24 @@ func (d dynamicMessageEventHandler) HandleMessageEvent(event MessageEvent, messa
 }
 
 func (c *Conversation) messageEvent(e MessageEvent, trace ...interface{}) {
-	if c.messageEventHandler != nil {
-		c.messageEventHandler.HandleMessageEvent(e, nil, nil, trace...)
+	if h := c.messageEventHandler; h != nil {
+		c.callHandler(func() { h.HandleMessageEvent(e, nil, nil, trace...) })
 	}
 }
 
 func (c *Conversation) messageEventWithError(e MessageEvent, err error) {
-	if c.messageEventHandler != nil {
-		c.messageEventHandler.HandleMessageEvent(e, nil, err)
+	if h := c.messageEventHandler; h != nil {
+		c.callHandler(func() { h.HandleMessageEvent(e, nil, err) })
 	}
 }
 
-func (c *Conversation) messageEventWithMessage(e MessageEvent, msg []byte) {
-	if c.messageEventHandler != nil {
-		c.messageEventHandler.HandleMessageEvent(e, msg, nil)
+func (c *Conversation) messageEventWithMessage(e MessageEvent, msg []byte, trace ...interface{}) {
+	if h := c.messageEventHandler; h != nil {
+		// The message can be wiped before a delayed handler is called
+		if msg != nil {
+			msg = makeCopy(msg)
+		}
+		c.callHandler(func() { h.HandleMessageEvent(e, msg, nil, trace...) })
 	}
 }
 
@@ -125,6 +156,18 @@ func (s MessageEvent) String() string {
 		return "MessageEventReceivedMessageUnrecognized"
 	case MessageEventReceivedMessageForOtherInstance:
 		return "MessageEventReceivedMessageForOtherInstance"
+	case MessageEventReceivedSymmetricKeyForUnknownUsage:
+		return "MessageEventReceivedSymmetricKeyForUnknownUsage"
+	case MessageEventReceivedFragmentsDropped:
+		return "MessageEventReceivedFragmentsDropped"
+	case MessageEventReceivedMessageExceedsLimits:
+		return "MessageEventReceivedMessageExceedsLimits"
+	case MessageEventRandomnessFailure:
+		return "MessageEventRandomnessFailure"
+	case MessageEventAuditLogFailure:
+		return "MessageEventAuditLogFailure"
+	case MessageEventReceivedMessageKnownError:
+		return "MessageEventReceivedMessageKnownError"
 	default:
 		return "MESSAGE EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
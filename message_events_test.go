@@ -18,6 +18,12 @@ func Test_MessageEvent_hasValidStringImplementation(t *testing.T) {
 	assertEquals(t, MessageEventReceivedMessageUnencrypted.String(), "MessageEventReceivedMessageUnencrypted")
 	assertEquals(t, MessageEventReceivedMessageUnrecognized.String(), "MessageEventReceivedMessageUnrecognized")
 	assertEquals(t, MessageEventReceivedMessageForOtherInstance.String(), "MessageEventReceivedMessageForOtherInstance")
+	assertEquals(t, MessageEventReceivedSymmetricKeyForUnknownUsage.String(), "MessageEventReceivedSymmetricKeyForUnknownUsage")
+	assertEquals(t, MessageEventReceivedFragmentsDropped.String(), "MessageEventReceivedFragmentsDropped")
+	assertEquals(t, MessageEventReceivedMessageExceedsLimits.String(), "MessageEventReceivedMessageExceedsLimits")
+	assertEquals(t, MessageEventRandomnessFailure.String(), "MessageEventRandomnessFailure")
+	assertEquals(t, MessageEventAuditLogFailure.String(), "MessageEventAuditLogFailure")
+	assertEquals(t, MessageEventReceivedMessageKnownError.String(), "MessageEventReceivedMessageKnownError")
 	assertEquals(t, MessageEvent(20000).String(), "MESSAGE EVENT: (THIS SHOULD NEVER HAPPEN)")
 }
 
@@ -267,6 +267,12 @@ type plainDataMsg struct {
 }
 
 func (c *plainDataMsg) deserialize(msg []byte) error {
+	return c.deserializeWithTLVLimit(msg, 0)
+}
+
+// deserializeWithTLVLimit works like deserialize, but returns errTooManyTLVs as soon as more than maxTLVs TLVs are found,
+// without parsing the rest of them. Zero means there is no limit.
+func (c *plainDataMsg) deserializeWithTLVLimit(msg []byte, maxTLVs int) error {
 	nulPos := 0
 	for nulPos < len(msg) && msg[nulPos] != 0x00 {
 		nulPos++
@@ -281,6 +287,10 @@ func (c *plainDataMsg) deserialize(msg []byte) error {
 	}
 
 	for len(tlvsBytes) > 0 {
+		if maxTLVs > 0 && len(c.tlvs) == maxTLVs {
+			return errTooManyTLVs
+		}
+
 		atlv := tlv{}
 		if err := atlv.deserialize(tlvsBytes); err != nil {
 			return err
@@ -311,16 +321,22 @@ const (
 	nulByteLen         = 1
 )
 
-func (c plainDataMsg) pad() plainDataMsg {
-	padding := paddingGranularity - ((len(c.message) + tlvHeaderLen + nulByteLen) % paddingGranularity)
+func (c plainDataMsg) serializedLength() int {
+	l := len(c.message) + nulByteLen
+	for _, t := range c.tlvs {
+		l += tlvHeaderLen + len(t.tlvValue)
+	}
+	return l
+}
 
+func (c plainDataMsg) pad(padding int) plainDataMsg {
 	paddingTlv := tlv{
 		tlvType:   uint16(tlvTypePadding),
 		tlvLength: uint16(padding),
 		tlvValue:  make([]byte, padding),
 	}
 
-	c.tlvs = append(c.tlvs, paddingTlv)
+	c.tlvs = append(append([]tlv{}, c.tlvs...), paddingTlv)
 
 	return c
 }
@@ -329,13 +345,13 @@ func (c plainDataMsg) encrypt(key []byte, topHalfCtr [8]byte) []byte {
 	var iv [aes.BlockSize]byte
 	copy(iv[:], topHalfCtr[:])
 
-	data := c.pad().serialize()
+	data := c.serialize()
 	dst := make([]byte, len(data))
 	counterEncipher(key[:], iv[:], data, dst)
 	return dst
 }
 
-func (c *plainDataMsg) decrypt(key []byte, topHalfCtr [8]byte, src []byte) error {
+func (c *plainDataMsg) decrypt(key []byte, topHalfCtr [8]byte, src []byte, maxTLVs int) error {
 	var iv [aes.BlockSize]byte
 	copy(iv[:], topHalfCtr[:])
 
@@ -343,6 +359,9 @@ func (c *plainDataMsg) decrypt(key []byte, topHalfCtr [8]byte, src []byte) error
 		return err
 	}
 
-	c.deserialize(src)
+	// Malformed TLVs are ignored, like they always have been, but too many of them make the message be rejected
+	if err := c.deserializeWithTLVLimit(src, maxTLVs); err == errTooManyTLVs {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,289 @@
+package otr3
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// montgomeryLimbs is the number of 64 bit limbs needed for the numbers of the 1536 bit group
+const montgomeryLimbs = 24
+
+const montgomeryBytes = montgomeryLimbs * 8
+
+// montgomeryWindow is the number of exponent bits handled at a time by exp
+const montgomeryWindow = 4
+
+// montgomeryNat is a number of up to 1536 bits, with the least significant limb first
+type montgomeryNat [montgomeryLimbs]uint64
+
+// montgomeryField does arithmetic modulo an odd number of up to 1536 bits, in time that doesn't depend on the values
+// of the operands. The only thing that can be learned from the timing is the size of exponents, in 64 bit words.
+// Numbers larger than 1536 bits can't be secrets generated by this package, so they are handled with math/big.
+type montgomeryField struct {
+	modulus  *big.Int
+	minusTwo *big.Int
+	m        montgomeryNat
+	m0inv    uint64        // -m^-1 mod 2^64
+	rr       montgomeryNat // R^2 mod m, with R = 2^1536
+	one      montgomeryNat // R mod m, which is 1 in Montgomery form
+	plainOne montgomeryNat
+}
+
+var (
+	pField *montgomeryField
+	qField *montgomeryField
+)
+
+func newMontgomeryField(modulus *big.Int) *montgomeryField {
+	f := &montgomeryField{
+		modulus:  modulus,
+		minusTwo: sub(modulus, big.NewInt(2)),
+	}
+	f.m, _ = natFromBig(modulus)
+
+	// Newton's iteration doubles the number of correct bits every time
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - f.m[0]*inv
+	}
+	f.m0inv = -inv
+
+	r := new(big.Int).Lsh(big.NewInt(1), montgomeryLimbs*64)
+	f.one, _ = natFromBig(mod(r, modulus))
+	f.rr, _ = natFromBig(mod(mul(r, r), modulus))
+	f.plainOne[0] = 1
+
+	return f
+}
+
+// fieldFor returns the constant time implementation for the modulus, or nil if there is none
+func fieldFor(m *big.Int) *montgomeryField {
+	switch m {
+	case p:
+		return pField
+	case q:
+		return qField
+	}
+	return nil
+}
+
+func natFromBig(x *big.Int) (n montgomeryNat, ok bool) {
+	if x.Sign() < 0 || x.BitLen() > montgomeryLimbs*64 {
+		return n, false
+	}
+
+	var b [montgomeryBytes]byte
+	xb := x.Bytes()
+	copy(b[montgomeryBytes-len(xb):], xb)
+	wipeBytes(xb)
+	for i := range n {
+		n[i] = binary.BigEndian.Uint64(b[montgomeryBytes-8*(i+1):])
+	}
+	return n, true
+}
+
+func (n *montgomeryNat) toBig() *big.Int {
+	var b [montgomeryBytes]byte
+	for i := range n {
+		binary.BigEndian.PutUint64(b[montgomeryBytes-8*(i+1):], n[i])
+	}
+	return new(big.Int).SetBytes(b[:])
+}
+
+// wordLength returns the number of limbs up to the most significant limb that isn't zero
+func (n *montgomeryNat) wordLength() int {
+	for i := montgomeryLimbs - 1; i >= 0; i-- {
+		if n[i] != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// montMul returns a*b/R mod m. The result is correct as long as a*b < m*R, which is true when either a or b is smaller than m.
+// The multiplication and the reduction are interleaved, so every step only adds a limb of b times a, and a multiple of m
+// that makes the lowest limb zero, before shifting one limb.
+func (f *montgomeryField) montMul(a, b *montgomeryNat) montgomeryNat {
+	var t [montgomeryLimbs + 1]uint64
+
+	for i := 0; i < montgomeryLimbs; i++ {
+		bi := b[i]
+
+		hi, lo := mulWW(a[0], bi)
+		u, c := addWW(lo, t[0], 0)
+		carryA := hi + c
+
+		k := u * f.m0inv
+		hi, lo = mulWW(k, f.m[0])
+		_, c = addWW(lo, u, 0)
+		carryM := hi + c
+
+		for j := 1; j < montgomeryLimbs; j++ {
+			hi, lo = mulWW(a[j], bi)
+			lo, c = addWW(lo, t[j], 0)
+			hi += c
+			lo, c = addWW(lo, carryA, 0)
+			carryA = hi + c
+
+			hi, v := mulWW(k, f.m[j])
+			v, c = addWW(v, lo, 0)
+			hi += c
+			v, c = addWW(v, carryM, 0)
+			carryM = hi + c
+
+			t[j-1] = v
+		}
+
+		top, c1 := addWW(t[montgomeryLimbs], carryA, 0)
+		top, c2 := addWW(top, carryM, 0)
+		t[montgomeryLimbs-1] = top
+		t[montgomeryLimbs] = c1 + c2
+	}
+
+	var res, reduced montgomeryNat
+	copy(res[:], t[:montgomeryLimbs])
+
+	var borrow uint64
+	for i := range reduced {
+		reduced[i], borrow = subWW(res[i], f.m[i], borrow)
+	}
+
+	// The result is smaller than 2m, so m has to be subtracted once if there was an extra limb, or if the subtraction didn't borrow
+	ctSelect(&res, &reduced, t[montgomeryLimbs]|(borrow^1))
+	return res
+}
+
+// mulWW returns the 128 bit product of x and y, as its high and low 64 bits. It works with 32 bit half words, since
+// math/bits is not available in all the versions of Go supported.
+func mulWW(x, y uint64) (hi, lo uint64) {
+	const mask32 = 1<<32 - 1
+	x0, x1 := x&mask32, x>>32
+	y0, y1 := y&mask32, y>>32
+
+	w0 := x0 * y0
+	t := x1*y0 + w0>>32
+	w1 := t&mask32 + x0*y1
+	hi = x1*y1 + t>>32 + w1>>32
+	lo = x * y
+	return
+}
+
+// addWW returns x+y+carry and the carry out. The carries are 0 or 1, and are computed without branches.
+func addWW(x, y, carry uint64) (sum, carryOut uint64) {
+	sum = x + y + carry
+	carryOut = ((x & y) | ((x | y) &^ sum)) >> 63
+	return
+}
+
+// subWW returns x-y-borrow and the borrow out. The borrows are 0 or 1, and are computed without branches.
+func subWW(x, y, borrow uint64) (diff, borrowOut uint64) {
+	diff = x - y - borrow
+	borrowOut = ((^x & y) | (^(x ^ y) & diff)) >> 63
+	return
+}
+
+// ctSelect sets dst to src if choice is 1, and leaves it as it is if choice is 0
+func ctSelect(dst, src *montgomeryNat, choice uint64) {
+	mask := -choice
+	for i := range dst {
+		dst[i] ^= mask & (dst[i] ^ src[i])
+	}
+}
+
+// ctEq returns 1 if a and b are equal, and 0 otherwise
+func ctEq(a, b uint64) uint64 {
+	x := a ^ b
+	return ((x | -x) >> 63) ^ 1
+}
+
+// toMont returns a*R mod m, for any a that fits in 1536 bits
+func (f *montgomeryField) toMont(a *montgomeryNat) montgomeryNat {
+	return f.montMul(a, &f.rr)
+}
+
+func (f *montgomeryField) fromMont(a *montgomeryNat) montgomeryNat {
+	return f.montMul(a, &f.plainOne)
+}
+
+// exp returns base^e mod m
+func (f *montgomeryField) exp(base, e *big.Int) *big.Int {
+	b, ok1 := natFromBig(base)
+	en, ok2 := natFromBig(e)
+	if !ok1 || !ok2 {
+		return new(big.Int).Exp(base, e, f.modulus)
+	}
+
+	var table [1 << montgomeryWindow]montgomeryNat
+	table[0] = f.one
+	table[1] = f.toMont(&b)
+	for i := 2; i < len(table); i++ {
+		table[i] = f.montMul(&table[i-1], &table[1])
+	}
+
+	acc := f.one
+	for i := en.wordLength() - 1; i >= 0; i-- {
+		for j := 64 - montgomeryWindow; j >= 0; j -= montgomeryWindow {
+			for k := 0; k < montgomeryWindow; k++ {
+				acc = f.montMul(&acc, &acc)
+			}
+
+			w := (en[i] >> uint(j)) & (1<<montgomeryWindow - 1)
+			var v montgomeryNat
+			for k := range table {
+				ctSelect(&v, &table[k], ctEq(uint64(k), w))
+			}
+			acc = f.montMul(&acc, &v)
+		}
+	}
+
+	res := f.fromMont(&acc)
+	return res.toBig()
+}
+
+// mul returns l*r mod m
+func (f *montgomeryField) mul(l, r *big.Int) *big.Int {
+	a, ok1 := natFromBig(l)
+	b, ok2 := natFromBig(r)
+	if !ok1 || !ok2 {
+		return mod(mul(l, r), f.modulus)
+	}
+
+	bm := f.toMont(&b)
+	res := f.montMul(&a, &bm)
+	return res.toBig()
+}
+
+// sub returns l-r mod m
+func (f *montgomeryField) sub(l, r *big.Int) *big.Int {
+	a, ok1 := natFromBig(l)
+	b, ok2 := natFromBig(r)
+	if !ok1 || !ok2 {
+		return mod(sub(l, r), f.modulus)
+	}
+
+	a = f.reduce(&a)
+	b = f.reduce(&b)
+
+	var res, corrected montgomeryNat
+	var borrow, carry uint64
+	for i := range res {
+		res[i], borrow = subWW(a[i], b[i], borrow)
+	}
+	for i := range corrected {
+		corrected[i], carry = addWW(res[i], f.m[i], carry)
+	}
+
+	ctSelect(&res, &corrected, borrow)
+	return res.toBig()
+}
+
+// reduce returns a mod m, for any a that fits in 1536 bits
+func (f *montgomeryField) reduce(a *montgomeryNat) montgomeryNat {
+	am := f.toMont(a)
+	return f.fromMont(&am)
+}
+
+// div returns l/r mod m, which is only defined when m is prime
+func (f *montgomeryField) div(l, r *big.Int) *big.Int {
+	return f.mul(l, f.exp(r, f.minusTwo))
+}
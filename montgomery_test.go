@@ -0,0 +1,183 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func assertBigEquals(t *testing.T, actual, expected *big.Int) {
+	if actual.Cmp(expected) != 0 {
+		t.Errorf("Expected:\n%X\nto equal:\n%X\n", actual, expected)
+	}
+}
+
+func randomBelow(t testing.TB, max *big.Int) *big.Int {
+	x, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+// montgomeryEdgeValues are values that are likely to hit the edge cases of the carries and reductions
+func montgomeryEdgeValues() []*big.Int {
+	r := new(big.Int).Lsh(big.NewInt(1), montgomeryLimbs*64)
+	return []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(2),
+		sub(q, big.NewInt(1)),
+		q,
+		new(big.Int).Add(q, big.NewInt(1)),
+		pMinusTwo,
+		sub(p, big.NewInt(1)),
+		p,
+		new(big.Int).Add(p, big.NewInt(1)),
+		sub(r, big.NewInt(1)),
+	}
+}
+
+func montgomeryTestValues(t *testing.T) []*big.Int {
+	r := new(big.Int).Lsh(big.NewInt(1), montgomeryLimbs*64)
+	values := montgomeryEdgeValues()
+	for i := 0; i < 8; i++ {
+		values = append(values, randomBelow(t, p), randomBelow(t, r))
+	}
+	return values
+}
+
+func Test_montgomeryField_exp_givesTheSameResultAsMathBig(t *testing.T) {
+	values := montgomeryTestValues(t)
+	exponents := append(montgomeryTestValues(t), randomBelow(t, new(big.Int).Lsh(big.NewInt(1), 320)), big.NewInt(0x10001))
+
+	for _, f := range []*montgomeryField{pField, qField} {
+		for _, b := range values {
+			for _, e := range exponents {
+				assertBigEquals(t, f.exp(b, e), new(big.Int).Exp(b, e, f.modulus))
+			}
+		}
+	}
+}
+
+func Test_montgomeryField_mul_givesTheSameResultAsMathBig(t *testing.T) {
+	values := montgomeryTestValues(t)
+
+	for _, f := range []*montgomeryField{pField, qField} {
+		for _, l := range values {
+			for _, r := range values {
+				assertBigEquals(t, f.mul(l, r), new(big.Int).Mod(mul(l, r), f.modulus))
+			}
+		}
+	}
+}
+
+func Test_montgomeryField_sub_givesTheSameResultAsMathBig(t *testing.T) {
+	values := montgomeryTestValues(t)
+
+	for _, f := range []*montgomeryField{pField, qField} {
+		for _, l := range values {
+			for _, r := range values {
+				assertBigEquals(t, f.sub(l, r), new(big.Int).Mod(sub(l, r), f.modulus))
+			}
+		}
+	}
+}
+
+func Test_montgomeryField_div_givesTheSameResultAsMathBig(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		l := randomBelow(t, p)
+		r := new(big.Int).Add(randomBelow(t, pMinusTwo), big.NewInt(1))
+		assertBigEquals(t, pField.div(l, r), new(big.Int).Mod(mul(l, modInverse(r, p)), p))
+	}
+}
+
+func Test_montgomeryField_fallsBackToMathBigForValuesThatAreTooLarge(t *testing.T) {
+	large := new(big.Int).Lsh(big.NewInt(3), montgomeryLimbs*64)
+	x := randomBelow(t, p)
+
+	assertBigEquals(t, pField.exp(large, x), new(big.Int).Exp(large, x, p))
+	assertBigEquals(t, pField.exp(x, large), new(big.Int).Exp(x, large, p))
+	assertBigEquals(t, pField.mul(large, x), new(big.Int).Mod(mul(large, x), p))
+	assertBigEquals(t, pField.sub(x, large), new(big.Int).Mod(sub(x, large), p))
+}
+
+func Test_wordArithmetic_givesTheSameResultAsMathBig(t *testing.T) {
+	words := []uint64{0, 1, 0xFFFFFFFF, 0x100000000, 0xFFFFFFFFFFFFFFFF, 0x8000000000000000}
+	for i := 0; i < 20; i++ {
+		words = append(words, randomBelow(t, new(big.Int).Lsh(big.NewInt(1), 64)).Uint64())
+	}
+	two64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	toBig := func(hi, lo uint64) *big.Int {
+		return new(big.Int).Add(new(big.Int).Lsh(new(big.Int).SetUint64(hi), 64), new(big.Int).SetUint64(lo))
+	}
+
+	for _, x := range words {
+		for _, y := range words {
+			bx, by := new(big.Int).SetUint64(x), new(big.Int).SetUint64(y)
+
+			hi, lo := mulWW(x, y)
+			assertBigEquals(t, toBig(hi, lo), mul(bx, by))
+
+			for c := uint64(0); c < 2; c++ {
+				sum, carry := addWW(x, y, c)
+				assertBigEquals(t, toBig(carry, sum), new(big.Int).Add(new(big.Int).Add(bx, by), new(big.Int).SetUint64(c)))
+
+				diff, borrow := subWW(x, y, c)
+				expected := new(big.Int).Sub(new(big.Int).Sub(bx, by), new(big.Int).SetUint64(c))
+				assertEquals(t, borrow == 1, expected.Sign() < 0)
+				assertBigEquals(t, new(big.Int).SetUint64(diff), expected.Mod(expected, two64))
+			}
+		}
+	}
+}
+
+func Test_modExp_usesTheConstantTimeImplementation(t *testing.T) {
+	x := randomBelow(t, q)
+	assertBigEquals(t, modExp(g1, x), new(big.Int).Exp(g1, x, p))
+	assertEquals(t, fieldFor(p), pField)
+	assertEquals(t, fieldFor(q), qField)
+	assertNil(t, fieldFor(big.NewInt(7)))
+}
+
+func Benchmark_montgomeryField_exp_SMPExponent(b *testing.B) {
+	x := randomBelow(b, q)
+	for i := 0; i < b.N; i++ {
+		pField.exp(g1, x)
+	}
+}
+
+func Benchmark_bigInt_Exp_SMPExponent(b *testing.B) {
+	x := randomBelow(b, q)
+	for i := 0; i < b.N; i++ {
+		new(big.Int).Exp(g1, x, p)
+	}
+}
+
+func Benchmark_montgomeryField_exp_DHExponent(b *testing.B) {
+	x := randomBelow(b, new(big.Int).Lsh(big.NewInt(1), 320))
+	for i := 0; i < b.N; i++ {
+		pField.exp(g1, x)
+	}
+}
+
+func Benchmark_bigInt_Exp_DHExponent(b *testing.B) {
+	x := randomBelow(b, new(big.Int).Lsh(big.NewInt(1), 320))
+	for i := 0; i < b.N; i++ {
+		new(big.Int).Exp(g1, x, p)
+	}
+}
+
+func Benchmark_montgomeryField_mul(b *testing.B) {
+	l, r := randomBelow(b, p), randomBelow(b, p)
+	for i := 0; i < b.N; i++ {
+		pField.mul(l, r)
+	}
+}
+
+func Benchmark_bigInt_MulMod(b *testing.B) {
+	l, r := randomBelow(b, p), randomBelow(b, p)
+	for i := 0; i < b.N; i++ {
+		new(big.Int).Mod(mul(l, r), p)
+	}
+}
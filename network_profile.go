@@ -0,0 +1,136 @@
+package otr3
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// SizeUnit is the unit a transport measures the size of messages in
+type SizeUnit int
+
+const (
+	// SizeInBytes means the size limit applies to the number of bytes in a message
+	SizeInBytes SizeUnit = iota
+	// SizeInCharacters means the size limit applies to the number of characters in a message
+	SizeInCharacters
+)
+
+// NetworkProfile describes the message size limits of a transport, so that outgoing messages can be fragmented to fit them
+type NetworkProfile struct {
+	// Name is a human readable name for the transport
+	Name string
+	// MaxMessageSize is the largest message the transport can carry, or zero if it has no limit
+	MaxMessageSize int
+	// Unit is the unit MaxMessageSize is measured in
+	Unit SizeUnit
+	// Overhead is the part of MaxMessageSize that should be left for the transport itself, such as routing information or framing
+	Overhead int
+}
+
+// These profiles describe the limits of some common transports. The limits of specific servers
+// or gateways can be smaller, in which case a custom profile should be used.
+var (
+	// NetworkProfileIRC fits messages into the 512 byte IRC line, leaving room for the command, the target and the prefix added by the server
+	NetworkProfileIRC = NetworkProfile{Name: "IRC", MaxMessageSize: 512, Unit: SizeInBytes, Overhead: 95}
+	// NetworkProfileXMPP fits messages into the default stanza size limit of most XMPP servers
+	NetworkProfileXMPP = NetworkProfile{Name: "XMPP", MaxMessageSize: 65536, Unit: SizeInBytes, Overhead: 1024}
+	// NetworkProfileSMS fits messages into a single SMS, for gateways that don't concatenate messages
+	NetworkProfileSMS = NetworkProfile{Name: "SMS", MaxMessageSize: 160, Unit: SizeInCharacters}
+	// NetworkProfileMatrix fits messages into the Matrix event size limit, leaving room for the rest of the event
+	NetworkProfileMatrix = NetworkProfile{Name: "Matrix", MaxMessageSize: 65536, Unit: SizeInBytes, Overhead: 4096}
+)
+
+// minMessageSize is the smallest size limit honored. Below it, not even the fragment headers would fit.
+const minMessageSize = 64
+
+// MaxMessageSizeFunc returns the largest message that can be sent to the peer right now.
+// Returning zero or less means that the fragment size set with SetFragmentSize will be used.
+// It is called while the conversation is locked, so it must not call methods of the conversation.
+type MaxMessageSizeFunc func() int
+
+// SetMaxMessageSizeFunc sets a function that is called for every outgoing message to decide how to fragment it.
+// This works like the max_message_size callback in libotr. Messages that can't be fragmented, like query messages
+// and error messages, are shortened to fit instead. A nil function restores the use of the fragment size.
+func (c *Conversation) SetMaxMessageSizeFunc(f MaxMessageSizeFunc) {
+	c.maxMessageSize = f
+	c.messageSizeUnit = SizeInBytes
+}
+
+// SetNetworkProfile sizes outgoing messages according to the limits of the transport described by the profile
+func (c *Conversation) SetNetworkProfile(p NetworkProfile) {
+	size := p.MaxMessageSize - p.Overhead
+	c.maxMessageSize = func() int {
+		if p.MaxMessageSize <= 0 {
+			return 0
+		}
+		return size
+	}
+	c.messageSizeUnit = p.Unit
+}
+
+// messageSizeLimit returns the maximum size of the next message, or zero if there is no limit
+func (c *Conversation) messageSizeLimit() int {
+	if c.maxMessageSize != nil {
+		if size := c.maxMessageSize(); size > 0 {
+			if size < minMessageSize {
+				return minMessageSize
+			}
+			return size
+		}
+	}
+
+	return int(c.fragmentSize)
+}
+
+// fragmentSizeLimit returns the fragment size to use for the next message. Since encoded
+// OTR messages only contain ASCII characters, the unit of the limit doesn't matter here.
+func (c *Conversation) fragmentSizeLimit() uint16 {
+	size := c.messageSizeLimit()
+	if size > math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return uint16(size)
+}
+
+// trimToMessageSize shortens messages that can't be fragmented so that they fit in the message size limit.
+// The first keep bytes of the message will never be removed.
+func (c *Conversation) trimToMessageSize(msg []byte, keep int) []byte {
+	limit := c.messageSizeLimit()
+	if limit == 0 {
+		return msg
+	}
+
+	if c.messageSizeUnit == SizeInCharacters {
+		return trimCharacters(msg, limit, keep)
+	}
+	return trimBytes(msg, limit, keep)
+}
+
+func trimBytes(msg []byte, limit, keep int) []byte {
+	if len(msg) <= limit {
+		return msg
+	}
+
+	if limit < keep {
+		limit = keep
+	}
+
+	// Don't split a multi-byte character
+	for limit > keep && limit < len(msg) && !utf8.RuneStart(msg[limit]) {
+		limit--
+	}
+
+	return msg[:limit]
+}
+
+func trimCharacters(msg []byte, limit, keep int) []byte {
+	chars := 0
+	for i := range string(msg) {
+		if chars >= limit && i >= keep {
+			return msg[:i]
+		}
+		chars++
+	}
+
+	return msg
+}
@@ -0,0 +1,124 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func Test_messageSizeLimit_usesTheFragmentSizeWithoutAMaxMessageSizeFunc(t *testing.T) {
+	c := &Conversation{}
+	c.SetFragmentSize(300)
+
+	assertEquals(t, c.messageSizeLimit(), 300)
+}
+
+func Test_messageSizeLimit_prefersTheMaxMessageSizeFunc(t *testing.T) {
+	c := &Conversation{}
+	c.SetFragmentSize(300)
+	c.SetMaxMessageSizeFunc(func() int { return 200 })
+
+	assertEquals(t, c.messageSizeLimit(), 200)
+
+	c.SetMaxMessageSizeFunc(func() int { return 0 })
+	assertEquals(t, c.messageSizeLimit(), 300)
+
+	c.SetMaxMessageSizeFunc(func() int { return 10 })
+	assertEquals(t, c.messageSizeLimit(), minMessageSize)
+}
+
+func Test_fragmentSizeLimit_isCappedToTheLargestPossibleFragment(t *testing.T) {
+	c := &Conversation{}
+	c.SetMaxMessageSizeFunc(func() int { return 100000 })
+
+	assertEquals(t, c.fragmentSizeLimit(), uint16(65535))
+}
+
+func Test_SetNetworkProfile_reservesTheOverhead(t *testing.T) {
+	c := &Conversation{}
+	c.SetNetworkProfile(NetworkProfileIRC)
+
+	assertEquals(t, c.messageSizeLimit(), 417)
+	assertEquals(t, c.messageSizeUnit, SizeInBytes)
+
+	c.SetNetworkProfile(NetworkProfileSMS)
+	assertEquals(t, c.messageSizeLimit(), 160)
+	assertEquals(t, c.messageSizeUnit, SizeInCharacters)
+
+	c.SetNetworkProfile(NetworkProfile{})
+	assertEquals(t, c.messageSizeLimit(), 0)
+}
+
+func Test_MaxMessageSizeFunc_isConsultedForEveryOutgoingMessage(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	sizes := []int{200, 1000}
+	alice.SetMaxMessageSizeFunc(func() int {
+		s := sizes[0]
+		sizes = sizes[1:]
+		return s
+	})
+	alice.SetPaddingStrategy(NoPadding())
+
+	first, _ := alice.Send(ValidMessage("hello there, how are you doing?"))
+	second, _ := alice.Send(ValidMessage("hello there, how are you doing?"))
+
+	assertTrue(t, len(first) > 1)
+	for _, m := range first {
+		assertTrue(t, len(m) <= 200)
+	}
+	assertEquals(t, len(second), 1)
+}
+
+func Test_MaxMessageSizeFunc_isUsedForAKEMessages(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+	c.SetMaxMessageSizeFunc(func() int { return 100 })
+
+	_, toSend, _ := c.Receive(ValidMessage("?OTRv3?"))
+
+	assertTrue(t, len(toSend) > 1)
+	for _, m := range toSend {
+		assertTrue(t, len(m) <= 100)
+	}
+}
+
+func Test_QueryMessage_trimsTheFriendlyMessageToFit(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.SetFriendlyQueryMessage("This is a very long message explaining what OTR is, that will not fit in the limit set for this network")
+	c.SetMaxMessageSizeFunc(func() int { return 64 })
+
+	assertEquals(t, string(c.QueryMessage()), "?OTRv3? This is a very long message explaining what OTR is, that")
+}
+
+func Test_QueryMessage_neverTrimsTheQuery(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.fragmentSize = 3
+	c.SetFriendlyQueryMessage("Hello")
+
+	assertEquals(t, string(c.QueryMessage()), "?OTRv3?")
+}
+
+func Test_generatePotentialErrorMessage_trimsTheErrorToFit(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.SetNetworkProfile(NetworkProfile{MaxMessageSize: 64, Unit: SizeInCharacters})
+	c.errorMessageHandler = dynamicErrorMessageHandler{func(ErrorCode) []byte {
+		return []byte(strings.Repeat("ä", 100))
+	}}
+
+	c.generatePotentialErrorMessage(ErrorCodeMessageUnreadable)
+	ts, _ := c.withInjections(nil, nil)
+
+	assertEquals(t, string(ts[0]), "?OTR Error: "+strings.Repeat("ä", 52))
+}
+
+func Test_trimBytes_doesntSplitCharacters(t *testing.T) {
+	assertEquals(t, string(trimBytes([]byte("abäc"), 3, 0)), "ab")
+	assertEquals(t, string(trimBytes([]byte("abäc"), 4, 0)), "abä")
+	assertEquals(t, string(trimBytes([]byte("abäc"), 10, 0)), "abäc")
+}
+
+func Test_trimCharacters_countsCharactersInsteadOfBytes(t *testing.T) {
+	assertEquals(t, string(trimCharacters([]byte("abäcd"), 3, 0)), "abä")
+	assertEquals(t, string(trimCharacters([]byte("abäcd"), 3, 5)), "abäc")
+	assertEquals(t, string(trimCharacters([]byte("abäcd"), 10, 0)), "abäcd")
+}
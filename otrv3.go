@@ -66,7 +66,7 @@ func (v otrV3) parseFragmentPrefix(c *Conversation, data []byte) (rest []byte, i
 		return data, false, false
 	}
 
-	if err := v.verifyInstanceTags(c, senderInstanceTag, receiverInstanceTag); err != nil {
+	if err := v.checkInstanceTags(c, senderInstanceTag, receiverInstanceTag); err != nil {
 		switch err {
 		case errInvalidOTRMessage:
 			return data, false, false
@@ -124,15 +124,27 @@ func (c *Conversation) generateInstanceTag() error {
 }
 
 func malformedMessage(c *Conversation) {
+	c.auditWithDetail(AuditMessageMalformed, "")
 	c.messageEvent(MessageEventReceivedMessageMalformed)
 	c.generatePotentialErrorMessage(ErrorCodeMessageMalformed)
 }
 
+// verifyInstanceTags checks the instance tags of a complete message, and makes the conversation be with the
+// sender instance if it isn't with one yet
 func (v otrV3) verifyInstanceTags(c *Conversation, their, our uint32) error {
+	if err := v.checkInstanceTags(c, their, our); err != nil {
+		return err
+	}
+
 	if c.theirInstanceTag == 0 {
 		c.theirInstanceTag = their
 	}
+	return nil
+}
 
+// checkInstanceTags checks the instance tags of a message without choosing the instance the conversation is with.
+// Fragments are only checked, since fragments from several instances can arrive before one of them completes a message.
+func (v otrV3) checkInstanceTags(c *Conversation, their, our uint32) error {
 	if our > 0 && our < minValidInstanceTag {
 		malformedMessage(c)
 		return errInvalidOTRMessage
@@ -144,7 +156,7 @@ func (v otrV3) verifyInstanceTags(c *Conversation, their, our uint32) error {
 	}
 
 	if (our != 0 && c.ourInstanceTag != our) ||
-		(c.theirInstanceTag != their) {
+		(c.theirInstanceTag != 0 && c.theirInstanceTag != their) {
 		c.messageEvent(MessageEventReceivedMessageForOtherInstance)
 		return errReceivedMessageForOtherInstance
 	}
@@ -60,6 +60,24 @@ func Test_verifyInstanceTags_savesTheirInstanceTag(t *testing.T) {
 	assertEquals(t, c.theirInstanceTag, uint32(0x101))
 }
 
+func Test_checkInstanceTags_doesntSaveTheirInstanceTag(t *testing.T) {
+	v := otrV3{}
+	c := &Conversation{}
+
+	err := v.checkInstanceTags(c, 0x101, 0)
+	assertNil(t, err)
+	assertEquals(t, c.theirInstanceTag, uint32(0))
+}
+
+func Test_verifyInstanceTags_doesntSaveTheirInstanceTagForAnInvalidMessage(t *testing.T) {
+	v := otrV3{}
+	c := &Conversation{}
+
+	err := v.verifyInstanceTags(c, 0x101, 0x99)
+	assertEquals(t, err, errInvalidOTRMessage)
+	assertEquals(t, c.theirInstanceTag, uint32(0))
+}
+
 func Test_verifyInstanceTags_returnsErrorWhenTheirInstanceTagIsLesserThan0x100(t *testing.T) {
 	v := otrV3{}
 	c := &Conversation{version: v}
@@ -1,5 +1,190 @@
 package otr3
 
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// PaddingStrategy decides how much padding is added to the plaintext of encrypted data messages, in order to hide its length.
+// The padding is added as a padding TLV, which is applied to user messages, heartbeats and messages only containing TLVs.
+type PaddingStrategy interface {
+	// PaddedLength returns the length the serialized plaintext of the given length should be padded to.
+	// Returning the same length means no padding will be added. Padding always needs at least the
+	// four bytes of a TLV header, so lengths smaller than that will not be honored exactly.
+	// It is called while the conversation is locked, so it must not call methods of the conversation.
+	PaddedLength(length int, r io.Reader) (int, error)
+}
+
+type fixedPadding struct {
+	granularity int
+}
+
+type powerOfTwoPadding struct {
+	minimum int
+}
+
+type randomPadding struct {
+	min, max int
+}
+
+type noPadding struct{}
+
+// FixedPadding returns a PaddingStrategy that pads every plaintext up to the next multiple of the granularity given.
+// This is the strategy used by default, with a granularity of 256 bytes.
+func FixedPadding(granularity int) PaddingStrategy {
+	return fixedPadding{granularity}
+}
+
+// PowerOfTwoPadding returns a PaddingStrategy that pads every plaintext up to the next power of two, but never to less than minimum bytes.
+// This hides the length of long messages better than fixed granularity, at the cost of more overhead.
+func PowerOfTwoPadding(minimum int) PaddingStrategy {
+	return powerOfTwoPadding{minimum}
+}
+
+// RandomPadding returns a PaddingStrategy that adds a random amount of padding between min and max bytes, inclusive.
+// The randomness used comes from the Rand of the Conversation.
+func RandomPadding(min, max int) PaddingStrategy {
+	return randomPadding{min, max}
+}
+
+// NoPadding returns a PaddingStrategy that never adds padding. This is useful for bandwidth constrained transports, but will leak the length of all messages.
+func NoPadding() PaddingStrategy {
+	return noPadding{}
+}
+
+var defaultPaddingStrategy = FixedPadding(paddingGranularity)
+
+func (p fixedPadding) PaddedLength(length int, r io.Reader) (int, error) {
+	if p.granularity <= 0 {
+		return length, nil
+	}
+
+	withHeader := length + tlvHeaderLen
+	return withHeader + (p.granularity-withHeader%p.granularity)%p.granularity, nil
+}
+
+func (p powerOfTwoPadding) PaddedLength(length int, r io.Reader) (int, error) {
+	target := 1
+	for target < length+tlvHeaderLen || target < p.minimum {
+		target <<= 1
+	}
+	return target, nil
+}
+
+func (p randomPadding) PaddedLength(length int, r io.Reader) (int, error) {
+	if p.max < p.min || p.max <= 0 {
+		return length, nil
+	}
+
+	extra, err := randomUpTo(r, uint64(p.max-p.min+1))
+	if err != nil {
+		return 0, err
+	}
+
+	return length + tlvHeaderLen + p.min + int(extra), nil
+}
+
+// randomUpTo returns a uniformly distributed number from zero up to, but not including, n, which must be at most 2^32.
+// Random values from the incomplete multiple of n at the top of the range are discarded, since taking them modulo n
+// would make the smaller results more likely.
+func randomUpTo(r io.Reader, n uint64) (uint64, error) {
+	bound := (1 << 32) - (1<<32)%n
+
+	var b [4]byte
+	for {
+		if err := randomInto(r, b[:]); err != nil {
+			return 0, err
+		}
+
+		if v := uint64(binary.BigEndian.Uint32(b[:])); v < bound {
+			return v % n, nil
+		}
+	}
+}
+
+func (noPadding) PaddedLength(length int, r io.Reader) (int, error) {
+	return length, nil
+}
+
+// SetPaddingStrategy sets the strategy used to pad encrypted data messages.
+// A nil strategy restores the default of padding to multiples of 256 bytes.
+func (c *Conversation) SetPaddingStrategy(s PaddingStrategy) {
+	c.paddingStrategy = s
+}
+
+func (c *Conversation) padding() PaddingStrategy {
+	if c.paddingStrategy == nil {
+		return defaultPaddingStrategy
+	}
+	return c.paddingStrategy
+}
+
+// padDataMessage adds padding to the plaintext according to the padding strategy. The overhead is the number of bytes the rest of the
+// data message adds to the plaintext before encoding. If possible, the padding will be reduced so that the encoded message doesn't need
+// more fragments than it would without padding.
+func (c *Conversation) padDataMessage(plain plainDataMsg, overhead int) (plainDataMsg, error) {
+	length := plain.serializedLength()
+
+	target, err := c.padding().PaddedLength(length, c.rand())
+	if err != nil {
+		return plain, err
+	}
+
+	if target <= length {
+		return plain, nil
+	}
+
+	padding := target - length - tlvHeaderLen
+	if padding < 0 {
+		padding = 0
+	}
+	if padding > math.MaxUint16 {
+		padding = math.MaxUint16
+	}
+
+	padding = c.paddingFittingFragments(overhead+length, padding)
+	if padding < 0 {
+		return plain, nil
+	}
+
+	return plain.pad(padding), nil
+}
+
+// paddingFittingFragments returns the largest amount of padding up to the amount given that doesn't
+// increase the number of fragments needed for the message. It returns -1 if not even an empty padding TLV fits.
+func (c *Conversation) paddingFittingFragments(unpadded, padding int) int {
+	fragmentSize := c.fragmentSizeLimit()
+	if fragmentSize == 0 {
+		return padding
+	}
+
+	fragments := c.fragmentCount(encodedLength(unpadded), fragmentSize)
+	fits := func(p int) bool {
+		return c.fragmentCount(encodedLength(unpadded+tlvHeaderLen+p), fragmentSize) <= fragments
+	}
+
+	if fits(padding) {
+		return padding
+	}
+
+	if !fits(0) {
+		return -1
+	}
+
+	low, high := 0, padding
+	for low < high {
+		mid := (low + high + 1) / 2
+		if fits(mid) {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+
+	return low
+}
+
 func (c *Conversation) processPaddingTLV(tlv, dataMessageExtra) (toSend *tlv, err error) {
 	return nil, nil
 }
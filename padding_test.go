@@ -0,0 +1,136 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func Test_FixedPadding_padsToTheNextMultipleOfTheGranularity(t *testing.T) {
+	l, _ := FixedPadding(256).PaddedLength(11, nil)
+	assertEquals(t, l, 256)
+
+	l, _ = FixedPadding(256).PaddedLength(252, nil)
+	assertEquals(t, l, 256)
+
+	l, _ = FixedPadding(256).PaddedLength(253, nil)
+	assertEquals(t, l, 512)
+
+	l, _ = FixedPadding(16).PaddedLength(100, nil)
+	assertEquals(t, l, 112)
+}
+
+func Test_PowerOfTwoPadding_padsToTheNextPowerOfTwo(t *testing.T) {
+	l, _ := PowerOfTwoPadding(64).PaddedLength(11, nil)
+	assertEquals(t, l, 64)
+
+	l, _ = PowerOfTwoPadding(64).PaddedLength(300, nil)
+	assertEquals(t, l, 512)
+
+	l, _ = PowerOfTwoPadding(64).PaddedLength(1020, nil)
+	assertEquals(t, l, 1024)
+}
+
+func Test_RandomPadding_addsPaddingWithinTheBounds(t *testing.T) {
+	l, err := RandomPadding(10, 20).PaddedLength(100, fixedRand([]string{"0000000F"}))
+	assertNil(t, err)
+	assertEquals(t, l, 100+tlvHeaderLen+10+4)
+
+	for i := 0; i < 50; i++ {
+		l, _ = RandomPadding(10, 20).PaddedLength(100, rand.Reader)
+		assertTrue(t, l >= 100+tlvHeaderLen+10 && l <= 100+tlvHeaderLen+20)
+	}
+}
+
+func Test_RandomPadding_discardsRandomValuesThatWouldMakeSmallPaddingMoreLikely(t *testing.T) {
+	// 2^32 isn't a multiple of 3, so the largest value would make a padding of min more likely than the others
+	l, err := RandomPadding(10, 12).PaddedLength(100, fixedRand([]string{"FFFFFFFF", "00000002"}))
+	assertNil(t, err)
+	assertEquals(t, l, 100+tlvHeaderLen+10+2)
+}
+
+func Test_randomUpTo_isUniform(t *testing.T) {
+	counts := make([]int, 3)
+	for i := 0; i < 3000; i++ {
+		v, _ := randomUpTo(rand.Reader, 3)
+		counts[v]++
+	}
+
+	for _, c := range counts {
+		assertTrue(t, c > 850 && c < 1150)
+	}
+}
+
+func Test_RandomPadding_returnsErrorIfRandomnessFails(t *testing.T) {
+	_, err := RandomPadding(10, 20).PaddedLength(100, fixedRand([]string{"00"}))
+	assertEquals(t, err, errShortRandomRead)
+}
+
+func Test_NoPadding_neverPads(t *testing.T) {
+	l, _ := NoPadding().PaddedLength(100, nil)
+	assertEquals(t, l, 100)
+}
+
+func Test_padDataMessage_usesTheDefaultStrategyIfNoneIsSet(t *testing.T) {
+	c := &Conversation{}
+	padded, _ := c.padDataMessage(plainDataMsg{message: []byte("hello")}, 0)
+	assertEquals(t, padded.serializedLength(), 256)
+}
+
+func Test_padDataMessage_doesntAddAPaddingTLVWithNoPadding(t *testing.T) {
+	c := &Conversation{}
+	c.SetPaddingStrategy(NoPadding())
+	plain := plainDataMsg{message: []byte("hello"), tlvs: []tlv{smpMessageAbort{}.tlv()}}
+
+	padded, _ := c.padDataMessage(plain, 0)
+	assertDeepEquals(t, padded, plain)
+}
+
+func Test_padDataMessage_reducesPaddingToFitTheSameNumberOfFragments(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.SetPaddingStrategy(FixedPadding(4096))
+	c.fragmentSize = 200
+	plain := plainDataMsg{message: []byte("hello")}
+
+	unpadded := encodedLength(100 + plain.serializedLength())
+	padded, _ := c.padDataMessage(plain, 100)
+
+	assertEquals(t, len(padded.tlvs), 1)
+	assertEquals(t, c.fragmentCount(encodedLength(100+padded.serializedLength()), c.fragmentSize), c.fragmentCount(unpadded, c.fragmentSize))
+	assertTrue(t, c.fragmentCount(encodedLength(100+padded.serializedLength()+3), c.fragmentSize) > c.fragmentCount(unpadded, c.fragmentSize))
+}
+
+func Test_padDataMessage_doesntPadIfEvenAnEmptyPaddingTLVNeedsAnotherFragment(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.fragmentSize = 100
+	plain := plainDataMsg{message: []byte("hello")}
+
+	overhead := 0
+	for c.fragmentCount(encodedLength(overhead+plain.serializedLength()+tlvHeaderLen), c.fragmentSize) == c.fragmentCount(encodedLength(overhead+plain.serializedLength()), c.fragmentSize) {
+		overhead++
+	}
+
+	padded, _ := c.padDataMessage(plain, overhead)
+	assertEquals(t, len(padded.tlvs), 0)
+}
+
+func Test_genDataMsg_appliesThePaddingStrategyToHeartbeats(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetPaddingStrategy(NoPadding())
+
+	dataMsg, _, err := c.genDataMsgWithFlag(nil, messageFlagIgnoreUnreadable)
+
+	assertNil(t, err)
+	assertEquals(t, len(dataMsg.encryptedMsg), 1)
+}
+
+func Test_genDataMsg_padsTheWholePlaintextIncludingTLVs(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetPaddingStrategy(FixedPadding(512))
+
+	dataMsg, _, err := c.genDataMsgWithFlag([]byte("hi"), messageFlagNormal, tlv{tlvType: 0x4242, tlvLength: 300, tlvValue: make([]byte, 300)})
+
+	assertNil(t, err)
+	assertEquals(t, len(dataMsg.encryptedMsg), 512)
+}
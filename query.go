@@ -51,11 +51,22 @@ func extractVersionsFromQueryMessage(p policies, msg ValidMessage) int {
 	return versions
 }
 
-var timeoutLength = time.Duration(1) * time.Minute
+const defaultQueryIgnoreWindow = time.Duration(1) * time.Minute
 
-func isWithinTimeToIgnoreQueryMessage(t time.Time) bool {
-	return t.Add(timeoutLength).After(time.Now())
+// SetQueryMessageIgnoreWindow sets how long after an AKE has started or finished repeated query messages from the peer
+// are ignored, instead of starting a new AKE. A negative window means query messages will never be ignored.
+// Zero restores the default of one minute.
+func (c *Conversation) SetQueryMessageIgnoreWindow(d time.Duration) {
+	c.queryIgnoreWindow = d
+}
+
+func (c *Conversation) isWithinTimeToIgnoreQueryMessage(t time.Time) bool {
+	window := c.queryIgnoreWindow
+	if window == 0 {
+		window = defaultQueryIgnoreWindow
+	}
 
+	return window > 0 && t.Add(window).After(c.now())
 }
 
 func (c *Conversation) receiveQueryMessage(msg ValidMessage) ([]messageWithHeader, error) {
@@ -65,8 +76,8 @@ func (c *Conversation) receiveQueryMessage(msg ValidMessage) ([]messageWithHeade
 		return nil, err
 	}
 
-	if dontIgnoreFastRepeatQueryMessage != "true" && ((c.msgState == encrypted && isWithinTimeToIgnoreQueryMessage(c.lastMessageStateChange)) ||
-		(c.ake != nil && isWithinTimeToIgnoreQueryMessage(c.ake.lastStateChange))) {
+	if dontIgnoreFastRepeatQueryMessage != "true" && ((c.msgState == encrypted && c.isWithinTimeToIgnoreQueryMessage(c.lastMessageStateChange)) ||
+		(c.ake != nil && c.isWithinTimeToIgnoreQueryMessage(c.ake.lastStateChange))) {
 		return nil, nil
 	}
 
@@ -75,7 +86,7 @@ func (c *Conversation) receiveQueryMessage(msg ValidMessage) ([]messageWithHeade
 }
 
 //QueryMessage will return a QueryMessage determined by Conversation Policies
-func (c Conversation) QueryMessage() ValidMessage {
+func (c *Conversation) QueryMessage() ValidMessage {
 	queryMessage := []byte("?OTRv")
 
 	if c.Policies.has(allowV2) {
@@ -86,12 +97,12 @@ func (c Conversation) QueryMessage() ValidMessage {
 		queryMessage = append(queryMessage, '3')
 	}
 
-	suffix := "?"
-	if c.friendlyQueryMessage != "" {
-		suffix = "? " + c.friendlyQueryMessage
+	queryMessage = append(queryMessage, '?')
+	if c.friendlyQueryMessage == "" {
+		return queryMessage
 	}
 
-	return append(queryMessage, suffix...)
+	return c.trimToMessageSize(append(queryMessage, " "+c.friendlyQueryMessage...), len(queryMessage))
 }
 
 //SetFriendlyQueryMessage will set a new message as query message
@@ -2,6 +2,7 @@ package otr3
 
 import (
 	"testing"
+	"time"
 )
 
 func Test_receiveQueryMessage_ignoreVersion1(t *testing.T) {
@@ -98,8 +99,9 @@ func Test_receiveQueryMessage_StoresRAndXAndGx(t *testing.T) {
 	fixture.dhCommitMessage()
 
 	cxt := &Conversation{
-		version: otrV3{},
-		Rand:    fixtureRand(),
+		version:                       otrV3{},
+		Rand:                          fixtureRand(),
+		randomnessHealthTestsDisabled: true,
 	}
 	cxt.SetOurKeys([]PrivateKey{bobPrivateKey})
 
@@ -190,3 +192,16 @@ func Test_QueryMessage_returnsAQueryMessageWithExtraMessage(t *testing.T) {
 	c.SetFriendlyQueryMessage("hello foobarium")
 	assertEquals(t, string(c.QueryMessage()), "?OTRv3? hello foobarium")
 }
+
+func Test_isWithinTimeToIgnoreQueryMessage_usesTheIgnoreWindowSet(t *testing.T) {
+	c := &Conversation{}
+	changed := time.Now().Add(-2 * time.Minute)
+
+	assertFalse(t, c.isWithinTimeToIgnoreQueryMessage(changed))
+
+	c.SetQueryMessageIgnoreWindow(5 * time.Minute)
+	assertTrue(t, c.isWithinTimeToIgnoreQueryMessage(changed))
+
+	c.SetQueryMessageIgnoreWindow(-1)
+	assertFalse(t, c.isWithinTimeToIgnoreQueryMessage(time.Now()))
+}
@@ -0,0 +1,166 @@
+package otr3
+
+import "time"
+
+// QueuedMessageID identifies a message in the outbound queue of a conversation
+type QueuedMessageID uint64
+
+// QueuedMessageStatus is the delivery status of a message in the outbound queue
+type QueuedMessageStatus int
+
+const (
+	// QueuedMessageQueued means the message is waiting for a secure conversation to be established before it can be sent
+	QueuedMessageQueued QueuedMessageStatus = iota
+	// QueuedMessageSent means the message has been encrypted and sent, and is no longer in the queue. It is still kept for the
+	// resend interval, and resent with a prefix if the peer reports that it lost the conversation in that time.
+	QueuedMessageSent
+	// QueuedMessageResent means the message has been sent again, after the peer reported that it couldn't read it
+	QueuedMessageResent
+	// QueuedMessageExpired means the message was queued for too long, and will not be sent
+	QueuedMessageExpired
+	// QueuedMessageDropped means the message was removed from the queue without being sent, because the conversation ended or the queue was full
+	QueuedMessageDropped
+)
+
+// QueuedMessage is a message in the outbound queue
+type QueuedMessage struct {
+	// ID identifies the message in the queue
+	ID QueuedMessageID
+	// Message is the plain text of the message
+	Message MessagePlaintext
+	// Status is the current delivery status of the message
+	Status QueuedMessageStatus
+	// Queued is when the message was added to the queue
+	Queued time.Time
+	// Options are the options given to SendWithOptions for this message, except for the TLVs, which are not sent again
+	Options SendOptions
+	// Trace is the trace given to Send for this message. It is not needed to restore the message.
+	Trace []interface{}
+}
+
+// QueuedMessageHandler is an interface that will be invoked when the delivery status of a queued message changes
+type QueuedMessageHandler interface {
+	// QueuedMessageStatusChanged is called with a copy of the message, with the new status set
+	QueuedMessageStatusChanged(m QueuedMessage)
+}
+
+type dynamicQueuedMessageHandler struct {
+	eh func(m QueuedMessage)
+}
+
+func (d dynamicQueuedMessageHandler) QueuedMessageStatusChanged(m QueuedMessage) {
+	d.eh(m)
+}
+
+// SetQueuedMessageHandler assigns the handler for status changes of queued messages. Messages that are sent while
+// the conversation is not encrypted and encryption is required will be reported as queued, with the ID they got in the queue.
+func (c *Conversation) SetQueuedMessageHandler(handler QueuedMessageHandler) {
+	c.queuedMessageHandler = handler
+}
+
+// QueuedMessages returns a copy of the messages in the outbound queue that are waiting for a secure conversation,
+// for example to store them and restore them later
+func (c *Conversation) QueuedMessages() []QueuedMessage {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	var result []QueuedMessage
+	for _, m := range c.resend.pending() {
+		if m.Status == QueuedMessageQueued {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// CancelQueuedMessage removes the message with the given ID from the queue, so it will not be sent or resent.
+// It returns false if there is no such message in the queue.
+func (c *Conversation) CancelQueuedMessage(id QueuedMessageID) bool {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	_, ok := c.resend.remove(id)
+	return ok
+}
+
+// RestoreQueuedMessages adds messages previously returned by QueuedMessages to the queue, keeping their IDs.
+// Messages still waiting for a secure conversation will be sent when one is established, and the resend interval for them
+// is counted from when they are restored.
+func (c *Conversation) RestoreQueuedMessages(msgs []QueuedMessage) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	waiting := false
+	for _, m := range msgs {
+		m.Message = makeCopy(m.Message)
+		_, dropped := c.resend.add(m)
+		c.queuedMessagesDropped(dropped)
+		waiting = waiting || m.Status == QueuedMessageQueued
+	}
+
+	if waiting {
+		c.updateLastSent()
+		c.updateMayRetransmitTo(retransmitExact)
+	}
+}
+
+func (c *Conversation) queueMessage(msg MessagePlaintext, opts SendOptions, trace ...interface{}) {
+	m, dropped := c.resend.add(QueuedMessage{Message: makeCopy(msg), Status: QueuedMessageQueued, Queued: c.now(), Options: opts, Trace: trace})
+	c.sentMetadata.QueuedID = m.ID
+	c.queuedMessagesDropped(dropped)
+	c.queuedMessageStatusChanged(m, QueuedMessageQueued)
+}
+
+// queuedMessagesDropped reports the messages removed from the queue that were still waiting to be sent
+func (c *Conversation) queuedMessagesDropped(msgs []QueuedMessage) {
+	for _, m := range msgs {
+		if m.Status == QueuedMessageQueued {
+			c.queuedMessageStatusChanged(m, QueuedMessageDropped)
+		}
+	}
+}
+
+func (c *Conversation) queuedMessageStatusChanged(m QueuedMessage, status QueuedMessageStatus) {
+	if c.queuedMessageHandler == nil {
+		return
+	}
+
+	m.Status = status
+	h := c.queuedMessageHandler
+	c.callHandler(func() { h.QueuedMessageStatusChanged(m) })
+}
+
+// expireQueuedMessages removes the messages waiting for a secure conversation, since they can no longer be sent
+func (c *Conversation) expireQueuedMessages() {
+	for _, m := range c.resend.pending() {
+		if m.Status == QueuedMessageQueued {
+			c.resend.remove(m.ID)
+			c.queuedMessageStatusChanged(m, QueuedMessageExpired)
+		}
+	}
+}
+
+// dropQueuedMessages empties the queue when the conversation ends, so no message will be sent or resent in a later conversation
+func (c *Conversation) dropQueuedMessages() {
+	msgs := c.resend.pending()
+	c.resend.clear()
+	c.queuedMessagesDropped(msgs)
+}
+
+// String returns the string representation of the QueuedMessageStatus
+func (s QueuedMessageStatus) String() string {
+	switch s {
+	case QueuedMessageQueued:
+		return "QueuedMessageQueued"
+	case QueuedMessageSent:
+		return "QueuedMessageSent"
+	case QueuedMessageResent:
+		return "QueuedMessageResent"
+	case QueuedMessageExpired:
+		return "QueuedMessageExpired"
+	case QueuedMessageDropped:
+		return "QueuedMessageDropped"
+	default:
+		return "QUEUED MESSAGE STATUS: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
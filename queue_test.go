@@ -0,0 +1,212 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func withoutQueuedTimes(msgs []QueuedMessage) []QueuedMessage {
+	for i := range msgs {
+		msgs[i].Queued = time.Time{}
+	}
+	return msgs
+}
+
+func fixtureQueuedMessageStatuses(c *Conversation) *[]QueuedMessage {
+	var reported []QueuedMessage
+	c.SetQueuedMessageHandler(dynamicQueuedMessageHandler{func(m QueuedMessage) {
+		reported = append(reported, m)
+	}})
+	return &reported
+}
+
+func Test_Send_reportsMessagesQueuedUntilEncryptionIsEstablished(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = plainText
+	c.Policies = policies(allowV3 | requireEncryption)
+	reported := fixtureQueuedMessageStatuses(c)
+
+	c.Send(ValidMessage("hello"), 42)
+
+	assertEquals(t, len(*reported), 1)
+	assertEquals(t, (*reported)[0].ID, QueuedMessageID(1))
+	assertEquals(t, (*reported)[0].Status, QueuedMessageQueued)
+	assertDeepEquals(t, (*reported)[0].Trace, []interface{}{42})
+}
+
+func Test_queuedMessages_areReportedAsSentWhenTheAKEFinishes(t *testing.T) {
+	alice := &Conversation{Rand: rand.Reader}
+	alice.Policies = policies(allowV3 | requireEncryption)
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+	bob := &Conversation{Rand: rand.Reader}
+	bob.Policies = policies(allowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+	reported := fixtureQueuedMessageStatuses(alice)
+
+	query, _ := alice.Send(ValidMessage("hello"))
+	_, toSend, _ := bob.Receive(query[0])
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, toSend, _ = alice.Receive(toSend[0])
+
+	assertEquals(t, len(*reported), 2)
+	assertEquals(t, (*reported)[1].Status, QueuedMessageSent)
+	assertEquals(t, (*reported)[1].ID, (*reported)[0].ID)
+
+	bob.Receive(toSend[0])
+	plain, _, _ := bob.Receive(toSend[1])
+	assertEquals(t, string(plain), "hello")
+}
+
+func Test_maybeRetransmit_expiresMessagesQueuedForTooLong(t *testing.T) {
+	c := &Conversation{}
+	reported := fixtureQueuedMessageStatuses(c)
+	c.queueMessage(MessagePlaintext("hello"), SendOptions{})
+	c.updateMayRetransmitTo(retransmitExact)
+	c.heartbeat.lastSent = time.Now().Add(-61 * time.Second)
+
+	res, err := c.maybeRetransmit()
+
+	assertNil(t, res)
+	assertNil(t, err)
+	assertEquals(t, len(c.resend.pending()), 0)
+	assertEquals(t, (*reported)[1].Status, QueuedMessageExpired)
+}
+
+func Test_End_dropsQueuedMessages(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	reported := fixtureQueuedMessageStatuses(c)
+	c.queueMessage(MessagePlaintext("hello"), SendOptions{})
+	c.lastMessage(MessagePlaintext("sent before"), SendOptions{})
+
+	c.End()
+
+	assertEquals(t, len(c.QueuedMessages()), 0)
+	assertEquals(t, len(*reported), 2)
+	assertEquals(t, (*reported)[1].Status, QueuedMessageDropped)
+}
+
+func Test_SetMaxQueuedMessages_reportsQueuedMessagesDroppedWhenTheQueueIsFull(t *testing.T) {
+	c := &Conversation{}
+	c.SetMaxQueuedMessages(1)
+	reported := fixtureQueuedMessageStatuses(c)
+
+	c.queueMessage(MessagePlaintext("one"), SendOptions{})
+	c.queueMessage(MessagePlaintext("two"), SendOptions{})
+
+	assertEquals(t, len(*reported), 3)
+	assertDeepEquals(t, (*reported)[1].Message, MessagePlaintext("one"))
+	assertEquals(t, (*reported)[1].Status, QueuedMessageDropped)
+}
+
+func Test_CancelQueuedMessage_removesTheMessage(t *testing.T) {
+	c := &Conversation{}
+	c.queueMessage(MessagePlaintext("one"), SendOptions{})
+	c.queueMessage(MessagePlaintext("two"), SendOptions{})
+
+	assertTrue(t, c.CancelQueuedMessage(1))
+	assertFalse(t, c.CancelQueuedMessage(1))
+
+	msgs := c.QueuedMessages()
+	assertEquals(t, len(msgs), 1)
+	assertEquals(t, msgs[0].ID, QueuedMessageID(2))
+}
+
+func Test_RestoreQueuedMessages_keepsTheIDsOfTheMessages(t *testing.T) {
+	c := &Conversation{}
+	c.queueMessage(MessagePlaintext("one"), SendOptions{})
+	c.queueMessage(MessagePlaintext("two"), SendOptions{})
+	saved := c.QueuedMessages()
+
+	c2 := &Conversation{}
+	c2.RestoreQueuedMessages(saved)
+	c2.queueMessage(MessagePlaintext("three"), SendOptions{})
+
+	msgs := c2.QueuedMessages()
+	assertEquals(t, len(msgs), 3)
+	assertEquals(t, msgs[1].ID, QueuedMessageID(2))
+	assertEquals(t, msgs[2].ID, QueuedMessageID(3))
+	assertTrue(t, c2.shouldRetransmit())
+}
+
+func Test_QueuedMessageStatus_String(t *testing.T) {
+	assertEquals(t, QueuedMessageQueued.String(), "QueuedMessageQueued")
+	assertEquals(t, QueuedMessageSent.String(), "QueuedMessageSent")
+	assertEquals(t, QueuedMessageResent.String(), "QueuedMessageResent")
+	assertEquals(t, QueuedMessageExpired.String(), "QueuedMessageExpired")
+	assertEquals(t, QueuedMessageDropped.String(), "QueuedMessageDropped")
+	assertEquals(t, QueuedMessageStatus(20000).String(), "QUEUED MESSAGE STATUS: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_SendWithMetadata_returnsTheIDOfAQueuedMessage(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = plainText
+	c.Policies = policies(allowV3 | requireEncryption)
+	reported := fixtureQueuedMessageStatuses(c)
+
+	_, meta, err := c.SendWithMetadata(ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertTrue(t, meta.Outgoing)
+	assertEquals(t, meta.QueuedID, (*reported)[0].ID)
+}
+
+func Test_SendWithMetadata_returnsTheIDOfAMessageSentRightAway(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	reported := fixtureQueuedMessageStatuses(alice)
+
+	toSend, meta, err := alice.SendWithMetadata(ValidMessage("hello"))
+	assertNil(t, err)
+	assertFalse(t, meta.QueuedID == 0)
+
+	_, _, err = alice.Receive(ValidMessage("?OTR Error: You transmitted an unreadable encrypted message."))
+	assertNil(t, err)
+
+	// Bob restarts the conversation, and Alice resends the message
+	toSend, _ = bob.StartAKE()
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, toSend, _ = alice.Receive(toSend[0])
+
+	assertEquals(t, len(*reported), 1)
+	assertEquals(t, (*reported)[0].ID, meta.QueuedID)
+	assertEquals(t, (*reported)[0].Status, QueuedMessageResent)
+}
+
+func Test_QueuedMessages_onlyReturnsMessagesWaitingForASecureConversation(t *testing.T) {
+	c := &Conversation{}
+	c.queueMessage(MessagePlaintext("waiting"), SendOptions{})
+	c.lastMessage(MessagePlaintext("sent"), SendOptions{})
+
+	msgs := c.QueuedMessages()
+	assertEquals(t, len(msgs), 1)
+	assertDeepEquals(t, msgs[0].Message, MessagePlaintext("waiting"))
+}
+
+func Test_Send_doesntKeepHeartbeatsOrSMPMessagesToResend(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	alice.Send(ValidMessage("hello"))
+	alice.StartAuthenticate("", []byte("secret"))
+	alice.AbortAuthentication()
+
+	msgs := alice.resend.pending()
+	assertEquals(t, len(msgs), 1)
+	assertDeepEquals(t, msgs[0].Message, MessagePlaintext("hello"))
+}
+
+func Test_lastMessage_forgetsMessagesSentBeforeTheResendInterval(t *testing.T) {
+	clock := &fixedClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := &Conversation{}
+	c.SetClock(clock)
+	c.lastMessage(MessagePlaintext("old"), SendOptions{})
+	assertEquals(t, c.resend.messages.m[0].Queued, clock.t)
+
+	clock.t = clock.t.Add(61 * time.Second)
+	c.lastMessage(MessagePlaintext("new"), SendOptions{})
+
+	msgs := c.resend.pending()
+	assertEquals(t, len(msgs), 1)
+	assertDeepEquals(t, msgs[0].Message, MessagePlaintext("new"))
+}
@@ -4,17 +4,51 @@ import (
 	"crypto/rand"
 	"io"
 	"math/big"
+	"reflect"
 )
 
+// rand returns the random source of the conversation, with health tests run on it unless they have been turned off
 func (c *Conversation) rand() io.Reader {
-	if c.Rand != nil {
-		return c.Rand
+	source := c.Rand
+	if source == nil {
+		source = rand.Reader
 	}
-	return rand.Reader
+
+	if c.randomnessHealthTestsDisabled {
+		return source
+	}
+
+	if c.randomness == nil || !sameReader(c.randomness.source, source) {
+		c.randomness = newHealthTestedRandom(source, c.randomnessFailed)
+	}
+	return c.randomness
+}
+
+// sameReader returns true if the health tests of a can be kept for b. Readers that can't be compared, like functions
+// or slices, are the same if they share their data, and other values of the same type are treated as the same reader,
+// so that the tests keep running from one read to the next instead of starting over every time.
+func sameReader(a, b io.Reader) bool {
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) {
+		return false
+	}
+	if t.Comparable() {
+		return a == b
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch va.Kind() {
+	case reflect.Func, reflect.Map, reflect.Slice:
+		return va.Pointer() == vb.Pointer()
+	}
+	return true
 }
 
 func randomInto(r io.Reader, b []byte) error {
 	if _, err := io.ReadFull(r, b); err != nil {
+		if err == errRandomnessFailedHealthTests {
+			return err
+		}
 		return errShortRandomRead
 	}
 	return nil
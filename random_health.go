@@ -0,0 +1,104 @@
+package otr3
+
+import "io"
+
+// The health tests are the repetition count test and the adaptive proportion test from NIST SP 800-90B, section 4.4,
+// applied to bytes. They assume the source has full entropy, and a false positive rate of 2^-40.
+const (
+	// repetitionCountCutoff is 1 + ceil(40 / 8)
+	repetitionCountCutoff = 6
+	// adaptiveProportionWindow is the window size used for non-binary sources
+	adaptiveProportionWindow = 512
+	// adaptiveProportionCutoff is the smallest count of the first byte of a window, including itself,
+	// that has a probability of at most 2^-40 for a source with full entropy
+	adaptiveProportionCutoff = 20
+)
+
+var errRandomnessFailedHealthTests = newOtrError("random source failed health tests")
+
+// healthTestedRandom runs continuous health tests on the bytes read from a source of randomness. Once a test has failed,
+// every read fails, since keys and nonces can't be safely generated anymore.
+type healthTestedRandom struct {
+	source    io.Reader
+	onFailure func(error)
+	failed    bool
+
+	last       byte
+	repetition int
+
+	windowFirst byte
+	windowCount int
+	windowSeen  int
+}
+
+func newHealthTestedRandom(source io.Reader, onFailure func(error)) *healthTestedRandom {
+	return &healthTestedRandom{source: source, onFailure: onFailure}
+}
+
+func (r *healthTestedRandom) Read(p []byte) (int, error) {
+	if r.failed {
+		return 0, errRandomnessFailedHealthTests
+	}
+
+	n, err := r.source.Read(p)
+	for _, b := range p[:n] {
+		if !r.test(b) {
+			r.fail()
+			wipeBytes(p[:n])
+			return 0, errRandomnessFailedHealthTests
+		}
+	}
+
+	return n, err
+}
+
+// test runs both tests on the next byte, and returns false if either of them fails
+func (r *healthTestedRandom) test(b byte) bool {
+	return r.repetitionCountTest(b) && r.adaptiveProportionTest(b)
+}
+
+func (r *healthTestedRandom) repetitionCountTest(b byte) bool {
+	if r.repetition > 0 && b == r.last {
+		r.repetition++
+	} else {
+		r.last, r.repetition = b, 1
+	}
+
+	return r.repetition < repetitionCountCutoff
+}
+
+func (r *healthTestedRandom) adaptiveProportionTest(b byte) bool {
+	if r.windowSeen == 0 {
+		r.windowFirst, r.windowCount = b, 1
+	} else if b == r.windowFirst {
+		r.windowCount++
+	}
+
+	r.windowSeen++
+	if r.windowSeen == adaptiveProportionWindow {
+		r.windowSeen = 0
+	}
+
+	return r.windowCount < adaptiveProportionCutoff
+}
+
+func (r *healthTestedRandom) fail() {
+	r.failed = true
+	if r.onFailure != nil {
+		r.onFailure(errRandomnessFailedHealthTests)
+	}
+}
+
+// randomnessFailed signals that the random source of the conversation can't be used anymore
+func (c *Conversation) randomnessFailed(err error) {
+	c.messageEventWithError(MessageEventRandomnessFailure, err)
+}
+
+// SetRandomnessHealthTests turns the health tests on the random source on or off. They are on by default, and should
+// only be turned off when the source is known not to look random, as with fixed test data.
+func (c *Conversation) SetRandomnessHealthTests(enabled bool) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	c.randomnessHealthTestsDisabled = !enabled
+}
@@ -0,0 +1,92 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func Test_healthTestedRandom_acceptsARealRandomSource(t *testing.T) {
+	r := newHealthTestedRandom(rand.Reader, nil)
+	buf := make([]byte, 1<<16)
+
+	_, err := io.ReadFull(r, buf)
+
+	assertNil(t, err)
+}
+
+func Test_healthTestedRandom_failsTheRepetitionCountTestOnAConstantSource(t *testing.T) {
+	var failure error
+	r := newHealthTestedRandom(bytes.NewReader(make([]byte, 100)), func(e error) { failure = e })
+	buf := make([]byte, 100)
+
+	n, err := r.Read(buf)
+
+	assertEquals(t, n, 0)
+	assertEquals(t, err, errRandomnessFailedHealthTests)
+	assertEquals(t, failure, errRandomnessFailedHealthTests)
+}
+
+func Test_healthTestedRandom_allowsShortRepetitions(t *testing.T) {
+	r := newHealthTestedRandom(bytes.NewReader([]byte{1, 1, 1, 1, 1, 2}), nil)
+	buf := make([]byte, 6)
+
+	_, err := r.Read(buf)
+
+	assertNil(t, err)
+}
+
+func Test_healthTestedRandom_failsTheAdaptiveProportionTestOnALowEntropySource(t *testing.T) {
+	data := bytes.Repeat([]byte{0xAB, 0xCD, 0x01, 0x02}, 100)
+	r := newHealthTestedRandom(bytes.NewReader(data), nil)
+
+	_, err := io.ReadFull(r, make([]byte, len(data)))
+
+	assertEquals(t, err, errRandomnessFailedHealthTests)
+}
+
+func Test_healthTestedRandom_keepsFailingOnceATestHasFailed(t *testing.T) {
+	calls := 0
+	r := newHealthTestedRandom(io.MultiReader(bytes.NewReader(make([]byte, 10)), rand.Reader), func(error) { calls++ })
+	r.Read(make([]byte, 10))
+
+	_, err := r.Read(make([]byte, 10))
+
+	assertEquals(t, err, errRandomnessFailedHealthTests)
+	assertEquals(t, calls, 1)
+}
+
+func Test_healthTestedRandom_wipesTheBytesReadWhenATestFails(t *testing.T) {
+	data := []byte{9, 8, 7, 7, 7, 7, 7, 7}
+	r := newHealthTestedRandom(bytes.NewReader(data), nil)
+	buf := make([]byte, len(data))
+
+	r.Read(buf)
+
+	assertBytesWiped(t, buf)
+}
+
+func Test_conversation_signalsARandomnessFailure(t *testing.T) {
+	c := &Conversation{Rand: bytes.NewReader(make([]byte, 1000))}
+	var event MessageEvent
+	var eventErr error
+	c.messageEventHandler = dynamicMessageEventHandler{func(e MessageEvent, message []byte, err error, trace ...interface{}) {
+		event, eventErr = e, err
+	}}
+
+	err := c.randomInto(make([]byte, 40))
+
+	assertEquals(t, err, errRandomnessFailedHealthTests)
+	assertEquals(t, event, MessageEventRandomnessFailure)
+	assertEquals(t, eventErr, errRandomnessFailedHealthTests)
+}
+
+func Test_conversation_cantStartAnAKEWithABrokenRandomSource(t *testing.T) {
+	c := &Conversation{Rand: bytes.NewReader(make([]byte, 1000))}
+	c.Policies.add(allowV3)
+
+	_, err := c.sendDHCommit()
+
+	assertEquals(t, err, errRandomnessFailedHealthTests)
+}
@@ -8,12 +8,55 @@ import (
 func Test_conversation_rand_returnsTheSetRandomIfThereIsOne(t *testing.T) {
 	r := fixtureRand()
 	c := &Conversation{Rand: r}
-	assertEquals(t, c.rand(), r)
+	assertEquals(t, c.rand().(*healthTestedRandom).source, r)
 }
 
 func Test_conversation_rand_returnsRandReaderIfNoRandomnessIsSet(t *testing.T) {
 	c := &Conversation{}
-	assertEquals(t, c.rand(), rand.Reader)
+	assertEquals(t, c.rand().(*healthTestedRandom).source, rand.Reader)
+}
+
+func Test_conversation_rand_returnsTheSetRandomWhenHealthTestsAreOff(t *testing.T) {
+	r := fixtureRand()
+	c := &Conversation{Rand: r}
+	c.SetRandomnessHealthTests(false)
+	assertEquals(t, c.rand(), r)
+}
+
+func Test_conversation_rand_keepsTheHealthTestsWhileTheSourceIsTheSame(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	r := c.rand()
+	assertEquals(t, c.rand(), r)
+
+	c.Rand = fixtureRand()
+	assertFalse(t, c.rand() == r)
+}
+
+// constantReader is a reader that can't be compared
+type constantReader []byte
+
+func (r constantReader) Read(p []byte) (int, error) {
+	return copy(p, r), nil
+}
+
+func Test_conversation_rand_keepsTheHealthTestsForAReaderThatCantBeCompared(t *testing.T) {
+	c := &Conversation{Rand: constantReader{0x42}}
+
+	var err error
+	for i := 0; i < repetitionCountCutoff && err == nil; i++ {
+		err = c.randomInto(make([]byte, 1))
+	}
+
+	assertEquals(t, err, errRandomnessFailedHealthTests)
+}
+
+func Test_sameReader_comparesReadersThatCantBeComparedByTheirData(t *testing.T) {
+	r := constantReader{1}
+
+	assertTrue(t, sameReader(r, r))
+	assertFalse(t, sameReader(r, constantReader{1}))
+	assertFalse(t, sameReader(r, rand.Reader))
+	assertTrue(t, sameReader(rand.Reader, rand.Reader))
 }
 
 func Test_randMPI_returnsNilForARealRead(t *testing.T) {
@@ -0,0 +1,149 @@
+package otr3
+
+import "time"
+
+// MessageID identifies a message for receipts. To ask the peer for receipts, give it as the ID in the SendOptions of SendWithOptions.
+// The receipts will be reported to the ReceiptHandler with the same ID. Peers that don't support receipts will ignore the request.
+type MessageID string
+
+// maxMessageIDLength is the longest message ID that can be used
+const maxMessageIDLength = 255
+
+var errMessageIDTooLong = newOtrErrorf("message ID can't be longer than %d bytes", maxMessageIDLength)
+
+// ReceiptType is the kind of receipt received from the peer
+type ReceiptType int
+
+const (
+	// DeliveryReceipt means the peer has received and decrypted the message
+	DeliveryReceipt ReceiptType = iota
+	// ReadReceipt means the user of the peer has read the message
+	ReadReceipt
+)
+
+// ReceiptHandler is an interface that will be invoked when the peer sends a receipt for one of our messages
+type ReceiptHandler interface {
+	// ReceivedReceipt is called with the ID of the message the receipt is for
+	ReceivedReceipt(id MessageID, receipt ReceiptType)
+}
+
+type dynamicReceiptHandler struct {
+	eh func(id MessageID, receipt ReceiptType)
+}
+
+func (d dynamicReceiptHandler) ReceivedReceipt(id MessageID, receipt ReceiptType) {
+	d.eh(id, receipt)
+}
+
+// MessageMetadata contains information about a message that is not part of its plain text
+type MessageMetadata struct {
+	// ID is the ID given to the message when asking for receipts, or empty if no receipts were requested
+	ID MessageID
+	// Retention is how long the sender asked for the message to be kept, or zero if there is no limit
+	Retention time.Duration
+	// ExpiresAt is when the retention of the message will have elapsed, if it has one
+	ExpiresAt time.Time
+	// LocalID identifies the message among the messages with a retention in this conversation
+	LocalID uint64
+	// Outgoing is true if the message was sent by us
+	Outgoing bool
+	// QueuedID is the ID a message sent by us got in the outbound queue, or zero if it was sent in the clear
+	QueuedID QueuedMessageID
+}
+
+// SetReceiptHandler assigns the handler for receipts sent by the peer
+func (c *Conversation) SetReceiptHandler(handler ReceiptHandler) {
+	c.receiptHandler = handler
+}
+
+// SetSendDeliveryReceipts decides whether delivery receipts will be sent automatically for messages that ask for them.
+// This is disabled by default, since it lets the peer know when we are online.
+func (c *Conversation) SetSendDeliveryReceipts(enabled bool) {
+	c.receipts.sendDelivery = enabled
+}
+
+// PeerSupportsReceipts returns true if the peer has sent us any receipt, or asked us for one, during this conversation
+func (c *Conversation) PeerSupportsReceipts() bool {
+	return c.receipts.peerSupports
+}
+
+// SendReadReceipt returns the messages to let the peer know the message with the given ID has been read.
+// The ID is available in the metadata returned by ReceiveWithMetadata.
+func (c *Conversation) SendReadReceipt(id MessageID) ([]ValidMessage, error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	if len(id) > maxMessageIDLength {
+		return nil, errMessageIDTooLong
+	}
+
+	if c.msgState != encrypted {
+		return nil, errCannotSendUnencrypted
+	}
+
+	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{receiptTLV(tlvTypeReadReceipt, id)})
+	return msgs, err
+}
+
+type receiptsContext struct {
+	sendDelivery bool
+	peerSupports bool
+}
+
+func receiptTLV(tlvType uint16, id MessageID) tlv {
+	return tlv{
+		tlvType:   tlvType,
+		tlvLength: uint16(len(id)),
+		tlvValue:  []byte(id),
+	}
+}
+
+func (c tlv) isReceiptMessage() bool {
+	return c.tlvType >= tlvTypeReceiptRequest && c.tlvType <= tlvTypeReadReceipt
+}
+
+// receiptRequestFor returns the TLV asking for receipts for the message with the given ID, if there is one
+func receiptRequestFor(id MessageID) []tlv {
+	if id == "" {
+		return nil
+	}
+	return []tlv{receiptTLV(tlvTypeReceiptRequest, id)}
+}
+
+func (c *Conversation) processReceiptTLV(t tlv, x dataMessageExtra) (*tlv, error) {
+	c.receipts.peerSupports = true
+	id := MessageID(t.tlvValue)
+
+	switch t.tlvType {
+	case tlvTypeReceiptRequest:
+		c.receivedMetadata.ID = id
+		if c.receipts.sendDelivery {
+			r := receiptTLV(tlvTypeDeliveryReceipt, id)
+			return &r, nil
+		}
+	case tlvTypeDeliveryReceipt:
+		c.receivedReceipt(id, DeliveryReceipt)
+	case tlvTypeReadReceipt:
+		c.receivedReceipt(id, ReadReceipt)
+	}
+
+	return nil, nil
+}
+
+func (c *Conversation) receivedReceipt(id MessageID, receipt ReceiptType) {
+	if h := c.receiptHandler; h != nil {
+		c.callHandler(func() { h.ReceivedReceipt(id, receipt) })
+	}
+}
+
+// String returns the string representation of the ReceiptType
+func (r ReceiptType) String() string {
+	switch r {
+	case DeliveryReceipt:
+		return "DeliveryReceipt"
+	case ReadReceipt:
+		return "ReadReceipt"
+	default:
+		return "RECEIPT TYPE: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
@@ -0,0 +1,128 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func Test_Send_asksForAReceiptWhenGivenAMessageID(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	bob.SetHeartbeatInterval(-1)
+
+	msg, _, err := alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: "msg-1"})
+	assertNil(t, err)
+
+	plain, meta, toSend, err := bob.ReceiveWithMetadata(msg[0])
+	assertNil(t, err)
+	assertEquals(t, string(plain), "hello")
+	assertEquals(t, meta.ID, MessageID("msg-1"))
+	assertEquals(t, len(toSend), 0)
+	assertTrue(t, bob.PeerSupportsReceipts())
+}
+
+func Test_Receive_sendsADeliveryReceiptWhenEnabled(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	bob.SetSendDeliveryReceipts(true)
+	bob.SetHeartbeatInterval(-1)
+
+	var receipts []ReceiptType
+	var ids []MessageID
+	alice.SetReceiptHandler(dynamicReceiptHandler{func(id MessageID, r ReceiptType) {
+		ids = append(ids, id)
+		receipts = append(receipts, r)
+	}})
+
+	msg, _, _ := alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: "msg-1"})
+	_, toSend, _ := bob.Receive(msg[0])
+	assertEquals(t, len(toSend), 1)
+
+	plain, _, err := alice.Receive(toSend[0])
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertDeepEquals(t, ids, []MessageID{"msg-1"})
+	assertDeepEquals(t, receipts, []ReceiptType{DeliveryReceipt})
+	assertTrue(t, alice.PeerSupportsReceipts())
+}
+
+func Test_SendReadReceipt_reportsTheReceiptToThePeer(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+
+	var received ReceiptType = -1
+	alice.SetReceiptHandler(dynamicReceiptHandler{func(id MessageID, r ReceiptType) {
+		assertEquals(t, id, MessageID("msg-2"))
+		received = r
+	}})
+
+	toSend, err := bob.SendReadReceipt(MessageID("msg-2"))
+	assertNil(t, err)
+
+	alice.Receive(toSend[0])
+	assertEquals(t, received, ReadReceipt)
+}
+
+func Test_SendReadReceipt_returnsErrorIfTheConversationIsNotEncrypted(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+
+	_, err := c.SendReadReceipt(MessageID("msg-2"))
+	assertEquals(t, err, errCannotSendUnencrypted)
+}
+
+func Test_Send_returnsErrorForMessageIDsThatAreTooLong(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	id := make([]byte, maxMessageIDLength+1)
+
+	_, _, err := alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: MessageID(id)})
+	assertEquals(t, err, errMessageIDTooLong)
+}
+
+func Test_Send_receiptRequestsAreIgnoredByPeersThatDontSupportThem(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	bob.SetHeartbeatInterval(-1)
+	delete(tlvHandlers, tlvTypeReceiptRequest)
+	defer initTLVHandlers()
+
+	msg, _, _ := alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: "msg-1"})
+	plain, toSend, err := bob.Receive(msg[0])
+
+	assertNil(t, err)
+	assertEquals(t, string(plain), "hello")
+	assertEquals(t, len(toSend), 0)
+	assertFalse(t, bob.PeerSupportsReceipts())
+}
+
+func Test_Send_doesNotAskForAReceiptForAMessageIDInTheTrace(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	bob.SetHeartbeatInterval(-1)
+
+	msg, _ := alice.Send(ValidMessage("hello"), MessageID("msg-1"))
+	_, meta, _, err := bob.ReceiveWithMetadata(msg[0])
+
+	assertNil(t, err)
+	assertEquals(t, meta.ID, MessageID(""))
+	assertFalse(t, bob.PeerSupportsReceipts())
+}
+
+func Test_SendWithOptions_asksForAReceiptWhenAQueuedMessageIsSent(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	bob.SetHeartbeatInterval(-1)
+	alice.msgState = plainText
+	alice.Policies.RequireEncryption()
+
+	_, meta, err := alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: "msg-1"})
+	assertNil(t, err)
+	assertEquals(t, meta.QueuedID, QueuedMessageID(1))
+
+	alice.msgState = encrypted
+	toSend, err := alice.retransmit()
+	assertNil(t, err)
+
+	_, received, _, err := bob.ReceiveWithMetadata(alice.encodeAndCombine(toSend)[0])
+	assertNil(t, err)
+	assertEquals(t, received.ID, MessageID("msg-1"))
+}
+
+func Test_ReceiptType_String(t *testing.T) {
+	assertEquals(t, DeliveryReceipt.String(), "DeliveryReceipt")
+	assertEquals(t, ReadReceipt.String(), "ReadReceipt")
+	assertEquals(t, ReceiptType(20000).String(), "RECEIPT TYPE: (THIS SHOULD NEVER HAPPEN)")
+}
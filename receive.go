@@ -2,11 +2,26 @@ package otr3
 
 // Receive handles a message from a peer. It returns a human readable message and zero or more messages to send back to the peer.
 func (c *Conversation) Receive(m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
-	return c.receiveUnit(m, true)
+	plain, _, toSend, err = c.ReceiveWithMetadata(m)
+	return
+}
+
+// ReceiveWithMetadata works like Receive, but also returns information about the received message that is not part of its plain text
+func (c *Conversation) ReceiveWithMetadata(m ValidMessage) (plain MessagePlaintext, meta MessageMetadata, toSend []ValidMessage, err error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	c.receivedMetadata = MessageMetadata{}
+	plain, toSend, err = c.receiveUnit(m)
+	if plain != nil {
+		c.scheduleExpiry(&c.receivedMetadata, c.now())
+	}
+	meta = c.receivedMetadata
+	return
 }
 
 // Receive handles a message from a peer. It returns a human readable message and zero or more messages to send back to the peer.
-func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+func (c *Conversation) receiveUnit(m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
 	message := makeCopy(m)
 	defer wipeBytes(message)
 
@@ -16,7 +31,6 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 
 	msgType := guessMessageType(message)
 	var messagesToSend []messageWithHeader
-	shouldForgetFragment := true
 	switch msgType {
 	case msgGuessError:
 		return c.withInjectionsPlain(c.receiveErrorMessage(message))
@@ -29,10 +43,10 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 	case msgGuessV1KeyExch:
 		return nil, nil, errUnsupportedOTRVersion
 	case msgGuessFragment:
-		shouldForgetFragment = false
-		c.fragmentationContext, err = c.receiveFragment(c.fragmentationContext, message)
-		if fragmentsFinished(c.fragmentationContext) {
-			return c.withInjectionsPlain(c.receiveUnit(c.fragmentationContext.frag, false))
+		var complete []byte
+		complete, err = c.receiveFragment(message)
+		if complete != nil {
+			return c.withInjectionsPlain(c.receiveUnit(complete))
 		}
 	case msgGuessUnknown:
 		c.messageEvent(MessageEventReceivedMessageUnrecognized)
@@ -40,10 +54,6 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 		plain, messagesToSend, err = c.receiveEncoded(encodedMessage(message))
 	}
 
-	if shouldForgetFragment && forgetFragments {
-		c.fragmentationContext = forgetFragment()
-	}
-
 	return c.withInjectionsPlain(c.toSendEncoded(plain, messagesToSend, err))
 }
 
@@ -59,9 +69,11 @@ func withoutPotentialSpaceStart(msg []byte) []byte {
 }
 
 func (c *Conversation) receiveErrorMessage(message ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
-	msg := MessagePlaintext(makeCopy(message[len(errorMarker):]))
+	msg := withoutPotentialSpaceStart(makeCopy(message[len(errorMarker):]))
+	code, known := ParseErrorMessage(msg)
 
-	if c.Policies.has(errorStartAKE) {
+	// An error we don't recognize might still mean the peer has lost our keys, so it restarts the AKE as before
+	if c.Policies.has(errorStartAKE) && (!known || code.shouldRestartAKE()) {
 		toSend = []ValidMessage{c.QueryMessage()}
 	}
 
@@ -69,7 +81,12 @@ func (c *Conversation) receiveErrorMessage(message ValidMessage) (plain MessageP
 		c.updateMayRetransmitTo(retransmitWithPrefix)
 	}
 
-	c.messageEventWithMessage(MessageEventReceivedMessageGeneralError, withoutPotentialSpaceStart(msg))
+	if known {
+		c.messageEventWithMessage(MessageEventReceivedMessageKnownError, msg, code)
+		c.peerError(code, msg)
+	} else {
+		c.messageEventWithMessage(MessageEventReceivedMessageGeneralError, msg)
+	}
 	return
 }
 
@@ -127,6 +144,10 @@ func removeOTRMsgEnvelope(msg encodedMessage) []byte {
 }
 
 func (c *Conversation) decode(encoded encodedMessage) (messageWithHeader, error) {
+	if len(encoded) > c.limits().MaxEncodedMessageSize {
+		return nil, c.exceededLimits(errEncodedMessageTooLarge)
+	}
+
 	encoded = removeOTRMsgEnvelope(encoded)
 	msg, err := b64decode(encoded)
 
@@ -176,14 +197,16 @@ func (c *Conversation) receiveDataMessage(messageHeader, messageBody []byte) (pl
 func (c *Conversation) notifyDataMessageError(err error) {
 	var e ErrorCode
 
-	if err == errMessageNotInPrivate {
+	if err == errMessageNotInPrivate || isLimitError(err) {
 		return
 	}
 
 	if isConflict(err) {
+		c.auditWithDetail(AuditMessageUnreadable, err.Error())
 		c.messageEvent(MessageEventReceivedMessageUnreadable)
 		e = ErrorCodeMessageUnreadable
 	} else {
+		c.auditWithDetail(AuditMessageMalformed, err.Error())
 		c.messageEvent(MessageEventReceivedMessageMalformed)
 		e = ErrorCodeMessageMalformed
 	}
@@ -225,6 +225,75 @@ func Test_receiveErrorMessage_willSignalAnEventWithTheErrorMessageWithoutLeading
 	}, MessageEventReceivedMessageGeneralError, []byte("an error msg"), nil)
 }
 
+func Test_receiveErrorMessage_willSignalAnEventWithTheErrorCodeOfAKnownErrorMessage(t *testing.T) {
+	c := aliceContextAfterAKE()
+	c.msgState = encrypted
+	m := []byte("?OTR Error: You transmitted an unreadable encrypted message.")
+
+	var ev MessageEvent
+	var msg []byte
+	var trace []interface{}
+	c.messageEventHandler = dynamicMessageEventHandler{func(event MessageEvent, message []byte, err error, tr ...interface{}) {
+		ev, msg, trace = event, message, tr
+	}}
+	c.receiveErrorMessage(m)
+
+	assertEquals(t, ev, MessageEventReceivedMessageKnownError)
+	assertDeepEquals(t, msg, []byte("You transmitted an unreadable encrypted message."))
+	assertDeepEquals(t, trace, []interface{}{ErrorCodeMessageUnreadable})
+}
+
+func Test_Receive_givesTheErrorCodeOfAKnownErrorMessageToThePeerErrorHandler(t *testing.T) {
+	c := aliceContextAfterAKE()
+	c.msgState = encrypted
+
+	var codes []ErrorCode
+	var msgs [][]byte
+	c.SetPeerErrorHandler(dynamicPeerErrorHandler{func(code ErrorCode, message []byte) {
+		codes = append(codes, code)
+		msgs = append(msgs, message)
+	}})
+
+	c.Receive(ValidMessage("?OTR Error: You sent encrypted data to bob@example.org, who wasn't expecting it."))
+	c.Receive(ValidMessage("?OTR Error: an error msg"))
+
+	assertDeepEquals(t, codes, []ErrorCode{ErrorCodeMessageNotInPrivate})
+	assertDeepEquals(t, msgs, [][]byte{[]byte("You sent encrypted data to bob@example.org, who wasn't expecting it.")})
+}
+
+func Test_receiveErrorMessage_restartsAKEForAnUnreadableMessage(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.add(allowV3)
+	c.Policies.add(errorStartAKE)
+
+	_, toSend, err := c.receiveErrorMessage([]byte("?OTR Error: You transmitted an unreadable encrypted message."))
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("?OTRv3?")})
+}
+
+func Test_receiveErrorMessage_doesntRestartAKEForAMalformedMessage(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.add(allowV3)
+	c.Policies.add(errorStartAKE)
+
+	_, toSend, err := c.receiveErrorMessage([]byte("?OTR Error: You transmitted a malformed data message."))
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+}
+
+func Test_receiveErrorMessage_doesntRestartAKEForAnEncryptionError(t *testing.T) {
+	c := &Conversation{}
+	c.Policies.add(allowV3)
+	c.Policies.add(errorStartAKE)
+
+	_, toSend, err := c.receiveErrorMessage([]byte("?OTR Error: Error occurred encrypting message."))
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+}
+
 func Test_Receive_returnsAnErrorIfWeReceiveARequestToStartAVersion1KeyExchange(t *testing.T) {
 	c := &Conversation{}
 	c.Policies = policies(allowV3)
@@ -234,12 +303,11 @@ func Test_Receive_returnsAnErrorIfWeReceiveARequestToStartAVersion1KeyExchange(t
 	assertEquals(t, err, errUnsupportedOTRVersion)
 }
 
-func Test_Receive_willResetFragmentationContextIfWeReceiveAnUnfragmentedMessage(t *testing.T) {
+func Test_Receive_keepsTheFragmentationContextIfWeReceiveAnUnfragmentedMessage(t *testing.T) {
 	c := aliceContextAfterAKE()
-	c.fragmentationContext = fragmentationContext{[]byte("hello"), 2, 5}
+	c.receiveFragment(append(c.version.fragmentPrefix(0, 2, c.theirInstanceTag, c.ourInstanceTag), []byte("hello,")...))
 	c.Receive(ValidMessage("Hello World"))
 
-	assertNil(t, c.fragmentationContext.frag)
-	assertEquals(t, c.fragmentationContext.currentIndex, uint16(0))
-	assertEquals(t, c.fragmentationContext.currentLen, uint16(0))
+	assertEquals(t, c.fragmentationContext.messages[c.theirInstanceTag].received, uint16(1))
+	assertEquals(t, c.fragmentationContext.size, 5)
 }
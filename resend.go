@@ -5,7 +5,7 @@ import (
 	"time"
 )
 
-const resendInterval = 60 * time.Second
+const defaultResendInterval = 60 * time.Second
 
 type retransmitFlag int
 
@@ -17,41 +17,90 @@ const (
 	retransmitExact
 )
 
-type messageToResend struct {
-	m      MessagePlaintext
-	opaque []interface{}
-}
-
 type resendContext struct {
 	mayRetransmit    retransmitFlag
 	messageTransform func([]byte) []byte
-	retransmitting   bool
+	interval         time.Duration
+	maxMessages      int
+	lastID           QueuedMessageID
 
 	messages struct {
-		m []messageToResend
+		m []QueuedMessage
 		sync.RWMutex
 	}
 }
 
-func (r *resendContext) later(msg MessagePlaintext, opaque ...interface{}) {
-	if r.retransmitting {
-		return
+// later keeps a message that has been sent, so it can be resent if the peer loses it. Messages sent longer ago
+// than the resend interval are forgotten first, since they would not be resent anymore.
+// It returns the message as kept, and the messages dropped to make room for it.
+func (r *resendContext) later(now time.Time, msg MessagePlaintext, opts SendOptions, opaque ...interface{}) (QueuedMessage, []QueuedMessage) {
+	r.forgetSentBefore(now.Add(-r.resendInterval()))
+	// Application TLVs are not sent again, so they don't need to be kept
+	opts.TLVs = nil
+	return r.add(QueuedMessage{Message: makeCopy(msg), Status: QueuedMessageSent, Queued: now, Options: opts, Trace: opaque})
+}
+
+// forgetSentBefore removes the messages that were sent before the given time
+func (r *resendContext) forgetSentBefore(t time.Time) {
+	r.messages.Lock()
+	defer r.messages.Unlock()
+
+	kept := r.messages.m[:0]
+	for _, m := range r.messages.m {
+		if m.Status == QueuedMessageQueued || !m.Queued.Before(t) {
+			kept = append(kept, m)
+		}
 	}
+	r.messages.m = kept
+}
 
+// add puts the message at the end of the queue, assigning it an ID if it doesn't have one.
+// It returns the message as queued, and the messages dropped to make room for it.
+func (r *resendContext) add(m QueuedMessage) (QueuedMessage, []QueuedMessage) {
 	r.messages.Lock()
 	defer r.messages.Unlock()
 
+	if m.ID == 0 {
+		m.ID = r.lastID + 1
+	}
+	if m.ID > r.lastID {
+		r.lastID = m.ID
+	}
+
 	if r.messages.m == nil {
-		r.messages.m = make([]messageToResend, 0, 5)
+		r.messages.m = make([]QueuedMessage, 0, 5)
+	}
+	r.messages.m = append(r.messages.m, m)
+
+	var dropped []QueuedMessage
+	if r.maxMessages > 0 && len(r.messages.m) > r.maxMessages {
+		excess := len(r.messages.m) - r.maxMessages
+		dropped = append(dropped, r.messages.m[:excess]...)
+		r.messages.m = r.messages.m[excess:]
+	}
+
+	return m, dropped
+}
+
+func (r *resendContext) remove(id QueuedMessageID) (QueuedMessage, bool) {
+	r.messages.Lock()
+	defer r.messages.Unlock()
+
+	for i, m := range r.messages.m {
+		if m.ID == id {
+			r.messages.m = append(r.messages.m[:i:i], r.messages.m[i+1:]...)
+			return m, true
+		}
 	}
-	r.messages.m = append(r.messages.m, messageToResend{makeCopy(msg), opaque})
+
+	return QueuedMessage{}, false
 }
 
-func (r *resendContext) pending() []messageToResend {
+func (r *resendContext) pending() []QueuedMessage {
 	r.messages.RLock()
 	defer r.messages.RUnlock()
 
-	ret := make([]messageToResend, len(r.messages.m))
+	ret := make([]QueuedMessage, len(r.messages.m))
 	copy(ret, r.messages.m)
 
 	return ret
@@ -68,16 +117,44 @@ func (r *resendContext) shouldRetransmit() bool {
 	return len(r.messages.m) > 0 && r.mayRetransmit != noRetransmit
 }
 
-func (r *resendContext) startRetransmitting() {
-	r.retransmitting = true
+func defaultResendMessageTransform(msg []byte) []byte {
+	return append(defaultResentPrefix, msg...)
+}
+
+// SetResendInterval sets how long after the last message sent, messages that were queued while the conversation
+// wasn't encrypted will still be resent once it is. Slow transports might need a longer window. A negative interval
+// means queued messages will never be resent. Zero restores the default of 60 seconds.
+func (c *Conversation) SetResendInterval(d time.Duration) {
+	c.resend.interval = d
 }
 
-func (r *resendContext) endRetransmitting() {
-	r.retransmitting = false
+// SetMaxQueuedMessages sets the largest number of messages queued to be resent. When more messages are queued,
+// the oldest ones are dropped. Zero means there is no limit, which is the default.
+func (c *Conversation) SetMaxQueuedMessages(n int) {
+	c.resend.maxMessages = n
 }
 
-func defaultResendMessageTransform(msg []byte) []byte {
-	return append(defaultResentPrefix, msg...)
+// SetResendMessageTransform sets the function used to change messages that are resent after the peer has restarted
+// the conversation, so the user knows they might have seen them before. A nil function restores the default, which adds
+// the prefix "[resent] ".
+func (c *Conversation) SetResendMessageTransform(f func([]byte) []byte) {
+	c.resend.messageTransform = f
+}
+
+// SetResendPrefix sets the prefix added to messages that are resent after the peer has restarted the conversation.
+// An empty prefix means resent messages will not be changed.
+func (c *Conversation) SetResendPrefix(prefix string) {
+	p := []byte(prefix)
+	c.resend.messageTransform = func(msg []byte) []byte {
+		return append(makeCopy(p), msg...)
+	}
+}
+
+func (r *resendContext) resendInterval() time.Duration {
+	if r.interval == 0 {
+		return defaultResendInterval
+	}
+	return r.interval
 }
 
 func (c *Conversation) resendMessageTransformer() func([]byte) []byte {
@@ -87,8 +164,12 @@ func (c *Conversation) resendMessageTransformer() func([]byte) []byte {
 	return c.resend.messageTransform
 }
 
-func (c *Conversation) lastMessage(msg MessagePlaintext, opaque ...interface{}) {
-	c.resend.later(msg, opaque...)
+// lastMessage keeps a message the user has sent, and returns the ID it got. Other data messages, like heartbeats,
+// SMP messages and stream chunks, are never kept, since resending them would make no sense.
+func (c *Conversation) lastMessage(msg MessagePlaintext, opts SendOptions, opaque ...interface{}) QueuedMessageID {
+	m, dropped := c.resend.later(c.now(), msg, opts, opaque...)
+	c.queuedMessagesDropped(dropped)
+	return m.ID
 }
 
 func (c *Conversation) updateMayRetransmitTo(f retransmitFlag) {
@@ -96,12 +177,16 @@ func (c *Conversation) updateMayRetransmitTo(f retransmitFlag) {
 }
 
 func (c *Conversation) shouldRetransmit() bool {
-	return c.resend.shouldRetransmit() &&
-		c.heartbeat.lastSent.After(time.Now().Add(-resendInterval))
+	interval := c.resend.resendInterval()
+	return c.resend.shouldRetransmit() && interval > 0 &&
+		c.heartbeat.lastSent.After(c.now().Add(-interval))
 }
 
 func (c *Conversation) maybeRetransmit() ([]messageWithHeader, error) {
 	if !c.shouldRetransmit() {
+		if c.resend.shouldRetransmit() {
+			c.expireQueuedMessages()
+		}
 		return nil, nil
 	}
 
@@ -115,18 +200,18 @@ func (c *Conversation) retransmit() ([]messageWithHeader, error) {
 
 	resending := c.resend.mayRetransmit == retransmitWithPrefix
 
-	c.resend.startRetransmitting()
-	defer c.resend.endRetransmitting()
-
 	for _, msgx := range msgs {
-		msg := msgx.m
+		msg := msgx.Message
 		if resending {
 			msg = c.resendMessageTransformer()(msg)
 		}
-		dataMsg, _, err := c.genDataMsg(msg)
+		dataMsg, _, err := c.genDataMsg(msg, c.outgoingTLVsFor(msgx.Options)...)
 		if err != nil {
 			return nil, err
 		}
+		if msgx.Status == QueuedMessageQueued {
+			c.sentWithRetention(msgx.ID, msgx.Options)
+		}
 
 		// It is actually safe to ignore this error, since the only possible error
 		// here is a problem with generating the instance tags for the message header,
@@ -135,12 +220,13 @@ func (c *Conversation) retransmit() ([]messageWithHeader, error) {
 		ret = append(ret, toSend)
 	}
 
-	ev := MessageEventMessageSent
+	ev, status := MessageEventMessageSent, QueuedMessageSent
 	if resending {
-		ev = MessageEventMessageResent
+		ev, status = MessageEventMessageResent, QueuedMessageResent
 	}
 	for _, msgx := range msgs {
-		c.messageEvent(ev, msgx.opaque...)
+		c.messageEvent(ev, msgx.Trace...)
+		c.queuedMessageStatusChanged(msgx, status)
 	}
 
 	c.updateLastSent()
@@ -7,7 +7,7 @@ import (
 )
 
 func fixtureCorrectResend(c *Conversation) {
-	c.resend.later(MessagePlaintext("hello"))
+	c.resend.later(time.Now(), MessagePlaintext("hello"), SendOptions{})
 	c.resend.mayRetransmit = retransmitExact
 	c.updateLastSent()
 }
@@ -78,7 +78,7 @@ func Test_maybeRetransmit_createsADataMessageWithTheExactMessageWhenAskedToRetra
 
 	fixtureCorrectResend(c)
 	c.resend.clear()
-	c.resend.later(MessagePlaintext("Something else to think about"))
+	c.resend.later(time.Now(), MessagePlaintext("Something else to think about"), SendOptions{})
 
 	res, err := c.maybeRetransmit()
 	assertNil(t, err)
@@ -106,7 +106,7 @@ func Test_maybeRetransmit_createsADataMessageWithTheResendPrefixAndMessageWhenAs
 	fixtureCorrectResend(c)
 	c.resend.clear()
 	c.resend.mayRetransmit = retransmitWithPrefix
-	c.resend.later(MessagePlaintext("Something else to think about"))
+	c.resend.later(time.Now(), MessagePlaintext("Something else to think about"), SendOptions{})
 
 	res, err := c.maybeRetransmit()
 	dec := fixtureDecryptDataMsg(res[0])
@@ -134,7 +134,7 @@ func Test_maybeRetransmit_createsADataMessageWithTheCustomResendPrefixAndMessage
 	fixtureCorrectResend(c)
 	c.resend.clear()
 	c.resend.mayRetransmit = retransmitWithPrefix
-	c.resend.later(MessagePlaintext("Something much more to think about"))
+	c.resend.later(time.Now(), MessagePlaintext("Something much more to think about"), SendOptions{})
 	c.resend.messageTransform = func(msg []byte) []byte {
 		return append(append([]byte("<resend>"), msg...), []byte("</resend>")...)
 	}
@@ -234,3 +234,38 @@ func Test_maybeRetransmit_signalMessageEventWhenSendingMessageExact(t *testing.T
 		c.maybeRetransmit()
 	}, MessageEventMessageSent, nil, nil)
 }
+
+func Test_shouldRetransmit_usesTheResendIntervalSet(t *testing.T) {
+	c := &Conversation{}
+	fixtureCorrectResend(c)
+	c.heartbeat.lastSent = time.Now().Add(-61 * time.Second)
+	c.SetResendInterval(5 * time.Minute)
+
+	assertEquals(t, c.shouldRetransmit(), true)
+
+	c.SetResendInterval(-1)
+	assertEquals(t, c.shouldRetransmit(), false)
+}
+
+func Test_later_dropsTheOldestMessagesWhenTheQueueIsFull(t *testing.T) {
+	c := &Conversation{}
+	c.SetMaxQueuedMessages(2)
+
+	c.resend.later(time.Now(), MessagePlaintext("one"), SendOptions{})
+	c.resend.later(time.Now(), MessagePlaintext("two"), SendOptions{})
+	c.resend.later(time.Now(), MessagePlaintext("three"), SendOptions{})
+
+	pending := c.resend.pending()
+	assertEquals(t, len(pending), 2)
+	assertDeepEquals(t, pending[0].Message, MessagePlaintext("two"))
+	assertDeepEquals(t, pending[1].Message, MessagePlaintext("three"))
+}
+
+func Test_SetResendPrefix_changesThePrefixOfResentMessages(t *testing.T) {
+	c := &Conversation{}
+	c.SetResendPrefix("(again) ")
+	assertDeepEquals(t, c.resendMessageTransformer()([]byte("hello")), []byte("(again) hello"))
+
+	c.SetResendMessageTransform(nil)
+	assertDeepEquals(t, c.resendMessageTransformer()([]byte("hello")), []byte("[resent] hello"))
+}
@@ -0,0 +1,135 @@
+package otr3
+
+import (
+	"time"
+
+	"github.com/coyim/gotrax"
+)
+
+// maxRetention is the longest retention that can be sent
+const maxRetention = time.Duration(0xFFFFFFFF) * time.Second
+
+// ExpiredMessageHandler is an interface that will be invoked when the retention of a message has elapsed,
+// so that the application can delete its copy of the message
+type ExpiredMessageHandler interface {
+	// MessageExpired is called with the metadata of the message, as returned by ReceiveWithMetadata for received messages
+	MessageExpired(meta MessageMetadata)
+}
+
+type dynamicExpiredMessageHandler struct {
+	eh func(meta MessageMetadata)
+}
+
+func (d dynamicExpiredMessageHandler) MessageExpired(meta MessageMetadata) {
+	d.eh(meta)
+}
+
+// SetExpiredMessageHandler assigns the handler that is called when the retention of a sent or received message has elapsed.
+// The handler is called from Poll, so the application has to call it as described by NextTimer.
+func (c *Conversation) SetExpiredMessageHandler(handler ExpiredMessageHandler) {
+	c.expiredMessageHandler = handler
+}
+
+// SetDefaultRetention sets the retention requested for all messages sent in this conversation, unless another
+// retention is given in the SendOptions. Zero means no retention is requested, which is the default.
+func (c *Conversation) SetDefaultRetention(d time.Duration) {
+	c.retention.defaultRetention = d
+}
+
+type retentionContext struct {
+	defaultRetention time.Duration
+	lastLocalID      uint64
+	pendingReceived  int
+}
+
+func retentionTLV(d time.Duration) tlv {
+	if d > maxRetention {
+		d = maxRetention
+	}
+
+	seconds := uint32((d + time.Second - 1) / time.Second)
+	value := gotrax.AppendWord(nil, seconds)
+
+	return tlv{
+		tlvType:   tlvTypeRetention,
+		tlvLength: uint16(len(value)),
+		tlvValue:  value,
+	}
+}
+
+// retentionFor returns the retention to ask for a message sent with the given options
+func (c *Conversation) retentionFor(opts SendOptions) time.Duration {
+	switch {
+	case opts.Retention < 0:
+		return 0
+	case opts.Retention == 0:
+		return c.retention.defaultRetention
+	}
+	return opts.Retention
+}
+
+// outgoingTLVsFor returns the TLVs that should be sent with a message, according to the options it is sent with
+func (c *Conversation) outgoingTLVsFor(opts SendOptions) []tlv {
+	tlvs := receiptRequestFor(opts.ID)
+
+	if r := c.retentionFor(opts); r > 0 {
+		tlvs = append(tlvs, retentionTLV(r))
+	}
+
+	return tlvs
+}
+
+func (c *Conversation) processRetentionTLV(t tlv, x dataMessageExtra) (*tlv, error) {
+	_, seconds, ok := gotrax.ExtractWord(t.tlvValue)
+	if !ok {
+		return nil, newOtrError("corrupt data message")
+	}
+
+	retention := time.Duration(seconds) * time.Second
+	if max := c.limits().MaxRetention; retention > max {
+		retention = max
+	}
+
+	c.receivedMetadata.Retention = retention
+	return nil, nil
+}
+
+// scheduleExpiry makes the handler be called when the retention of the message has elapsed. Since the peer decides
+// how many received messages have a retention, their expiries are only scheduled up to MaxPendingExpiries.
+func (c *Conversation) scheduleExpiry(meta *MessageMetadata, now time.Time) {
+	if meta.Retention <= 0 {
+		return
+	}
+
+	received := !meta.Outgoing
+	if received {
+		if c.retention.pendingReceived >= c.limits().MaxPendingExpiries {
+			c.exceededLimits(errTooManyPendingExpiries)
+			return
+		}
+		c.retention.pendingReceived++
+	}
+
+	c.retention.lastLocalID++
+	meta.LocalID = c.retention.lastLocalID
+	meta.ExpiresAt = now.Add(meta.Retention)
+
+	expired := *meta
+	c.schedule(meta.ExpiresAt, func() []ValidMessage {
+		if received {
+			c.retention.pendingReceived--
+		}
+		if h := c.expiredMessageHandler; h != nil {
+			c.callHandler(func() { h.MessageExpired(expired) })
+		}
+		return nil
+	})
+}
+
+// sentWithRetention schedules the expiry of a message we sent, and returns the metadata of the message.
+// It must only be called when the message is sent for the first time, not when it is resent.
+func (c *Conversation) sentWithRetention(id QueuedMessageID, opts SendOptions) MessageMetadata {
+	meta := MessageMetadata{ID: opts.ID, Retention: c.retentionFor(opts), Outgoing: true, QueuedID: id}
+	c.scheduleExpiry(&meta, c.now())
+	return meta
+}
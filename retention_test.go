@@ -0,0 +1,191 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_SendWithOptions_includesTheRetentionGiven(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+
+	msg, _, _ := alice.SendWithOptions(ValidMessage("hello"), SendOptions{Retention: 90 * time.Second})
+	plain, meta, _, err := bob.ReceiveWithMetadata(msg[0])
+
+	assertNil(t, err)
+	assertEquals(t, string(plain), "hello")
+	assertEquals(t, meta.Retention, 90*time.Second)
+	assertEquals(t, meta.LocalID, uint64(1))
+	assertFalse(t, meta.Outgoing)
+	assertTrue(t, meta.ExpiresAt.After(time.Now()))
+}
+
+func Test_Send_usesTheDefaultRetention(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetDefaultRetention(1500 * time.Millisecond)
+
+	msg, _ := alice.Send(ValidMessage("hello"))
+	_, meta, _, _ := bob.ReceiveWithMetadata(msg[0])
+	assertEquals(t, meta.Retention, 2*time.Second)
+
+	msg, _, _ = alice.SendWithOptions(ValidMessage("hello"), SendOptions{Retention: -1})
+	_, meta, _, _ = bob.ReceiveWithMetadata(msg[0])
+	assertEquals(t, meta.Retention, time.Duration(0))
+
+	msg, _ = alice.Send(ValidMessage("hello"), 90*time.Second)
+	_, meta, _, _ = bob.ReceiveWithMetadata(msg[0])
+	assertEquals(t, meta.Retention, 2*time.Second)
+}
+
+func Test_Poll_reportsReceivedMessagesWhenTheirRetentionHasElapsed(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	var expired []MessageMetadata
+	bob.SetExpiredMessageHandler(dynamicExpiredMessageHandler{func(meta MessageMetadata) {
+		expired = append(expired, meta)
+	}})
+
+	msg, _, _ := alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: "msg-1", Retention: time.Minute})
+	_, meta, _, _ := bob.ReceiveWithMetadata(msg[0])
+
+	next, ok := bob.NextTimer()
+	assertTrue(t, ok)
+	assertEquals(t, next, meta.ExpiresAt)
+
+	bob.pollAt(meta.ExpiresAt.Add(-time.Second))
+	assertEquals(t, len(expired), 0)
+
+	bob.pollAt(meta.ExpiresAt)
+	assertDeepEquals(t, expired, []MessageMetadata{meta})
+	assertEquals(t, expired[0].ID, MessageID("msg-1"))
+
+	_, ok = bob.NextTimer()
+	assertFalse(t, ok)
+}
+
+func Test_Poll_reportsSentMessagesWhenTheirRetentionHasElapsed(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	var expired []MessageMetadata
+	alice.SetExpiredMessageHandler(dynamicExpiredMessageHandler{func(meta MessageMetadata) {
+		expired = append(expired, meta)
+	}})
+
+	alice.SendWithOptions(ValidMessage("hello"), SendOptions{ID: "msg-1", Retention: time.Minute})
+	alice.pollAt(time.Now().Add(time.Minute + time.Second))
+
+	assertEquals(t, len(expired), 1)
+	assertEquals(t, expired[0].ID, MessageID("msg-1"))
+	assertTrue(t, expired[0].Outgoing)
+}
+
+func Test_retentionTLV_roundsUpToWholeSecondsAndCapsTheRetention(t *testing.T) {
+	assertDeepEquals(t, retentionTLV(1500*time.Millisecond).tlvValue, []byte{0x00, 0x00, 0x00, 0x02})
+	assertDeepEquals(t, retentionTLV(maxRetention+time.Hour).tlvValue, []byte{0xFF, 0xFF, 0xFF, 0xFF})
+}
+
+func Test_processRetentionTLV_returnsErrorForCorruptTLVs(t *testing.T) {
+	c := &Conversation{}
+
+	_, err := c.processRetentionTLV(tlv{tlvType: tlvTypeRetention, tlvLength: 1, tlvValue: []byte{0x01}}, dataMessageExtra{})
+	assertDeepEquals(t, err, newOtrError("corrupt data message"))
+}
+
+func Test_SendWithOptions_returnsTheLocalIDOfTheSentMessage(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	var expired []MessageMetadata
+	alice.SetExpiredMessageHandler(dynamicExpiredMessageHandler{func(meta MessageMetadata) {
+		expired = append(expired, meta)
+	}})
+
+	_, meta, err := alice.SendWithOptions(ValidMessage("hello"), SendOptions{Retention: time.Minute})
+	assertNil(t, err)
+	assertEquals(t, meta.LocalID, uint64(1))
+	assertEquals(t, meta.Retention, time.Minute)
+
+	alice.pollAt(meta.ExpiresAt)
+	assertDeepEquals(t, expired, []MessageMetadata{meta})
+}
+
+func Test_Poll_reportsAResentMessageOnlyOnce(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	var expired []MessageMetadata
+	alice.SetExpiredMessageHandler(dynamicExpiredMessageHandler{func(meta MessageMetadata) {
+		expired = append(expired, meta)
+	}})
+
+	alice.SendWithOptions(ValidMessage("hello"), SendOptions{Retention: time.Minute})
+	alice.Receive(ValidMessage("?OTR Error: You transmitted an unreadable encrypted message."))
+
+	toSend, _ := bob.StartAKE()
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, toSend, _ = alice.Receive(toSend[0])
+	assertEquals(t, len(toSend), 2)
+
+	alice.pollAt(time.Now().Add(time.Minute + time.Second))
+	assertEquals(t, len(expired), 1)
+}
+
+func Test_SendWithOptions_includesTheRetentionWithTLVsAndReportsItsExpiry(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	var expired []MessageMetadata
+	alice.SetExpiredMessageHandler(dynamicExpiredMessageHandler{func(meta MessageMetadata) {
+		expired = append(expired, meta)
+	}})
+	alice.SetDefaultRetention(time.Minute)
+
+	msg, _, err := alice.SendWithOptions(ValidMessage("hello"), SendOptions{TLVs: []TLV{TLV{Type: 0x4242}}, Retention: 90 * time.Second})
+	assertNil(t, err)
+
+	_, meta, _, _ := bob.ReceiveWithMetadata(msg[0])
+	assertEquals(t, meta.Retention, 90*time.Second)
+
+	alice.pollAt(time.Now().Add(91 * time.Second))
+	assertEquals(t, len(expired), 1)
+	assertTrue(t, expired[0].Outgoing)
+}
+
+func Test_processRetentionTLV_shortensRetentionsLongerThanTheLimit(t *testing.T) {
+	c := &Conversation{}
+	c.SetLimits(Limits{MaxRetention: time.Hour})
+
+	c.processRetentionTLV(retentionTLV(2*time.Hour), dataMessageExtra{})
+	assertEquals(t, c.receivedMetadata.Retention, time.Hour)
+
+	c.processRetentionTLV(retentionTLV(time.Minute), dataMessageExtra{})
+	assertEquals(t, c.receivedMetadata.Retention, time.Minute)
+}
+
+func Test_Receive_doesNotScheduleMoreExpiriesThanTheLimit(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	bob.SetLimits(Limits{MaxPendingExpiries: 2})
+	var expired []MessageMetadata
+	bob.SetExpiredMessageHandler(dynamicExpiredMessageHandler{func(meta MessageMetadata) {
+		expired = append(expired, meta)
+	}})
+
+	var metas []MessageMetadata
+	for i := 0; i < 3; i++ {
+		msg, _, _ := alice.SendWithOptions(ValidMessage("hello"), SendOptions{Retention: time.Minute})
+		var plain MessagePlaintext
+		var meta MessageMetadata
+		if i == 2 {
+			bob.expectMessageEvent(t, func() {
+				plain, meta, _, _ = bob.ReceiveWithMetadata(msg[0])
+			}, MessageEventReceivedMessageExceedsLimits, nil, errTooManyPendingExpiries)
+		} else {
+			plain, meta, _, _ = bob.ReceiveWithMetadata(msg[0])
+		}
+		assertEquals(t, string(plain), "hello")
+		metas = append(metas, meta)
+	}
+
+	assertEquals(t, len(bob.timers.pending), 2)
+	assertTrue(t, metas[2].ExpiresAt.IsZero())
+	assertEquals(t, metas[2].Retention, time.Minute)
+
+	bob.pollAt(time.Now().Add(time.Minute + time.Second))
+	assertEquals(t, len(expired), 2)
+
+	msg, _, _ := alice.SendWithOptions(ValidMessage("hello"), SendOptions{Retention: time.Minute})
+	_, meta, _, _ := bob.ReceiveWithMetadata(msg[0])
+	assertFalse(t, meta.ExpiresAt.IsZero())
+}
@@ -0,0 +1,113 @@
+package otr3
+
+import (
+	"math/big"
+	"runtime"
+	"unsafe"
+)
+
+// secretAlignment is the alignment of the data in a SecretBuffer, which is enough to keep big.Word values in it
+const secretAlignment = 16
+
+// SecretBuffer is memory for secret values that the garbage collector never moves or copies.
+// On Linux it is locked into RAM so it isn't written to swap, left out of core dumps, and surrounded by guard pages
+// that can't be read or written, so that a buffer overflow crashes instead of leaking or corrupting the secret.
+// On other systems it is ordinary memory that is wiped when it is destroyed.
+// A SecretBuffer should be destroyed with Destroy as soon as the secret isn't needed anymore.
+type SecretBuffer struct {
+	data   []byte
+	locked bool
+}
+
+// NewSecretBuffer returns a zeroed SecretBuffer of the given size
+func NewSecretBuffer(size int) (*SecretBuffer, error) {
+	if size < 0 {
+		return nil, newOtrError("negative secret buffer size")
+	}
+
+	data, locked, err := allocSecretMemory(size)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &SecretBuffer{data: data, locked: locked}
+	// The finalizer only catches buffers that were never destroyed - it can run long after the secret stopped being used
+	runtime.SetFinalizer(b, (*SecretBuffer).Destroy)
+	return b, nil
+}
+
+// Bytes returns the memory of the buffer. It must not be used after the buffer has been destroyed.
+func (b *SecretBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Locked returns true if the memory of the buffer is locked into RAM. Locking can fail when the
+// limit on locked memory for the process has been reached, in which case the buffer is still usable.
+func (b *SecretBuffer) Locked() bool {
+	return b != nil && b.locked
+}
+
+// Destroy wipes the buffer and gives its memory back to the system. It is safe to call more than once.
+func (b *SecretBuffer) Destroy() {
+	if b == nil || b.data == nil {
+		return
+	}
+
+	wipeBytes(b.data)
+	freeSecretMemory(b.data, b.locked)
+
+	b.data = nil
+	b.locked = false
+	runtime.SetFinalizer(b, nil)
+}
+
+// words returns the memory of the buffer as big.Words
+func (b *SecretBuffer) words() []big.Word {
+	n := len(b.data) / int(unsafe.Sizeof(big.Word(0)))
+	if n == 0 {
+		return nil
+	}
+	return (*[1 << 27]big.Word)(unsafe.Pointer(&b.data[0]))[:n:n]
+}
+
+// newSecretBytes returns a copy of src kept in a SecretBuffer, and wipes src.
+// If no SecretBuffer can be allocated, it returns src and a nil buffer.
+func newSecretBytes(src []byte) ([]byte, *SecretBuffer) {
+	b, err := NewSecretBuffer(len(src))
+	if err != nil {
+		return src, nil
+	}
+
+	copy(b.data, src)
+	wipeBytes(src)
+	return b.data, b
+}
+
+// newSecretInt returns a copy of x whose words are kept in a SecretBuffer, and wipes x.
+// If no SecretBuffer can be allocated, it returns x and a nil buffer.
+// The buffer has to be kept together with the number, and the number must only be used for reading,
+// since operations that make it larger would move it out of the buffer.
+func newSecretInt(x *big.Int) (*big.Int, *SecretBuffer) {
+	n := len(x.Bits())
+	if n == 0 {
+		n = 1
+	}
+
+	b, err := NewSecretBuffer(n * int(unsafe.Sizeof(big.Word(0))))
+	if err != nil {
+		return x, nil
+	}
+
+	ret := new(big.Int).SetBits(b.words()[:0])
+	ret.Set(x)
+	wipeBigInt(x)
+	return ret, b
+}
+
+// roundUp rounds n up to a multiple of m, which has to be a power of two
+func roundUp(n, m int) int {
+	return (n + m - 1) &^ (m - 1)
+}
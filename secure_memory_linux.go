@@ -0,0 +1,72 @@
+//go:build linux
+// +build linux
+
+package otr3
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"unsafe"
+)
+
+// madvDontDump is MADV_DONTDUMP, which isn't defined by the syscall package
+const madvDontDump = 0x10
+
+// allocSecretMemory maps the data pages for a secret with a guard page on each side. The data is placed at the end of
+// the data pages, so that reading or writing past its end hits the guard page after it.
+// The mapping can be found again from the data alone, so the buffer doesn't have to keep a slice of the guard pages.
+func allocSecretMemory(size int) (data []byte, locked bool, err error) {
+	// An empty buffer has no memory to protect, and no address freeSecretMemory could find the mapping from
+	if size == 0 {
+		return []byte{}, false, nil
+	}
+
+	page := os.Getpagesize()
+	dataSize := secretDataPages(size, page)
+
+	region, err := syscall.Mmap(-1, 0, dataSize+2*page, syscall.PROT_NONE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, false, err
+	}
+
+	inner := region[page : page+dataSize]
+	if err = syscall.Mprotect(inner, syscall.PROT_READ|syscall.PROT_WRITE); err != nil {
+		syscall.Munmap(region)
+		return nil, false, err
+	}
+
+	// Locking and leaving out of core dumps are best effort - the limit on locked memory is often small
+	locked = syscall.Mlock(inner) == nil
+	syscall.Madvise(inner, madvDontDump)
+
+	start := dataSize - roundUp(size, secretAlignment)
+	return inner[start : start+size : start+size], locked, nil
+}
+
+func freeSecretMemory(data []byte, locked bool) {
+	if len(data) == 0 {
+		return
+	}
+
+	page := os.Getpagesize()
+	dataSize := secretDataPages(len(data), page)
+
+	// The region starts one guard page before the data pages, which end where the aligned data ends. The slice is made
+	// from a header, since slicing an array pointer checks it isn't nil by reading from the guard page.
+	var region []byte
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&region))
+	h.Data = uintptr(unsafe.Pointer(&data[0])) + uintptr(roundUp(len(data), secretAlignment)) - uintptr(dataSize+page)
+	h.Len = dataSize + 2*page
+	h.Cap = h.Len
+
+	if locked {
+		syscall.Munlock(region[page : page+dataSize])
+	}
+	syscall.Munmap(region)
+}
+
+// secretDataPages returns the size of the readable pages needed for a secret of the given size
+func secretDataPages(size, page int) int {
+	return roundUp(roundUp(size, secretAlignment), page)
+}
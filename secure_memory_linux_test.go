@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package otr3
+
+import (
+	"runtime/debug"
+	"testing"
+	"unsafe"
+)
+
+func assertFaults(t *testing.T, f func()) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		assertNotNil(t, recover())
+	}()
+	f()
+}
+
+func Test_SecretBuffer_hasAGuardPageAfterTheData(t *testing.T) {
+	b, _ := NewSecretBuffer(16)
+	defer b.Destroy()
+
+	end := unsafe.Pointer(uintptr(unsafe.Pointer(&b.Bytes()[0])) + 16)
+	assertFaults(t, func() {
+		*(*byte)(end) = 1
+	})
+}
+
+func Test_SecretBuffer_hasAGuardPageBeforeTheData(t *testing.T) {
+	b, _ := NewSecretBuffer(16)
+	defer b.Destroy()
+
+	data := b.Bytes()
+	start := unsafe.Pointer(uintptr(unsafe.Pointer(&data[0])) - uintptr(len(data)+4096))
+	assertFaults(t, func() {
+		_ = *(*byte)(start)
+	})
+}
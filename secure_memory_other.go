@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package otr3
+
+// allocSecretMemory returns ordinary memory, which is only protected by being wiped when it is freed
+func allocSecretMemory(size int) (data []byte, locked bool, err error) {
+	return make([]byte, roundUp(size, secretAlignment))[:size:size], false, nil
+}
+
+func freeSecretMemory(data []byte, locked bool) {}
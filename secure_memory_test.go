@@ -0,0 +1,139 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func Test_NewSecretBuffer_returnsZeroedMemoryOfTheGivenSize(t *testing.T) {
+	b, err := NewSecretBuffer(37)
+	assertNil(t, err)
+	defer b.Destroy()
+
+	assertDeepEquals(t, b.Bytes(), zeroes(37))
+	assertEquals(t, cap(b.Bytes()), 37)
+}
+
+func Test_NewSecretBuffer_returnsAnErrorForANegativeSize(t *testing.T) {
+	_, err := NewSecretBuffer(-1)
+	assertEquals(t, err, newOtrError("negative secret buffer size"))
+}
+
+func Test_NewSecretBuffer_canBeEmpty(t *testing.T) {
+	b, err := NewSecretBuffer(0)
+	assertNil(t, err)
+	assertEquals(t, len(b.Bytes()), 0)
+
+	b.Destroy()
+}
+
+func Test_SecretBuffer_Destroy_releasesTheMemory(t *testing.T) {
+	b, _ := NewSecretBuffer(16)
+	copy(b.Bytes(), []byte{1, 2, 3})
+
+	b.Destroy()
+
+	assertNil(t, b.Bytes())
+	assertFalse(t, b.Locked())
+}
+
+func Test_SecretBuffer_Destroy_canBeCalledMoreThanOnce(t *testing.T) {
+	b, _ := NewSecretBuffer(16)
+	b.Destroy()
+	b.Destroy()
+}
+
+func Test_SecretBuffer_handlesNilWell(t *testing.T) {
+	var b *SecretBuffer
+	b.Destroy()
+	assertNil(t, b.Bytes())
+	assertFalse(t, b.Locked())
+}
+
+func Test_newSecretBytes_movesTheValueIntoSecretMemory(t *testing.T) {
+	src := []byte{1, 2, 3, 4}
+
+	res, b := newSecretBytes(src)
+	defer b.Destroy()
+
+	assertDeepEquals(t, res, []byte{1, 2, 3, 4})
+	assertDeepEquals(t, b.Bytes(), res)
+	assertBytesWiped(t, src)
+}
+
+func Test_newSecretInt_movesTheValueIntoSecretMemory(t *testing.T) {
+	x := fixedX()
+
+	res, b := newSecretInt(x)
+	defer b.Destroy()
+
+	assertBigEquals(t, res, fixedX())
+	assertBigIntWiped(t, x)
+	assertEquals(t, &res.Bits()[0], &b.words()[0])
+}
+
+func Test_newSecretInt_keepsZero(t *testing.T) {
+	res, b := newSecretInt(new(big.Int))
+	defer b.Destroy()
+
+	assertEquals(t, res.Sign(), 0)
+}
+
+func Test_newSecretInt_isWipedInPlace(t *testing.T) {
+	res, b := newSecretInt(fixedX())
+	defer b.Destroy()
+
+	wipeBigInt(res)
+
+	assertBytesWiped(t, b.Bytes())
+}
+
+func Test_calculateDHSessionKeys_keepsTheKeysInSecretMemory(t *testing.T) {
+	keys := calculateDHSessionKeys(fixedX(), fixedGX(), fixedGY(), otrV3{})
+	defer keys.destroy()
+
+	mem := keys.memory.Bytes()
+	assertEquals(t, len(mem), 16+16+20+20+32)
+	assertEquals(t, &keys.sendingAESKey[0], &mem[0])
+	assertEquals(t, &keys.extraKey[0], &mem[len(mem)-32])
+}
+
+func Test_calculateDHSessionKeys_historyKeepsACopyOfTheReceivingMACKey(t *testing.T) {
+	c := keyManagementContext{
+		ourKeyID:             1,
+		theirKeyID:           1,
+		theirCurrentDHPubKey: fixedGY(),
+		ourCurrentDHKeys:     newDHKeyPair(fixedX(), fixedGX()),
+	}
+
+	keys, _ := c.calculateDHSessionKeys(1, 1, otrV3{})
+	expected := makeCopy(keys.receivingMACKey)
+	keys.destroy()
+
+	assertDeepEquals(t, []byte(c.macKeyHistory.items[0].receivingKey), expected)
+}
+
+func Test_DSAPrivateKey_Parse_keepsXInSecretMemory(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	defer priv.Destroy()
+
+	assertNotNil(t, priv.xMemory)
+	assertEquals(t, &priv.X.Bits()[0], &priv.xMemory.words()[0])
+}
+
+func Test_DSAPrivateKey_Generate_canSignWithXInSecretMemory(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	assertNil(t, priv.Generate(rand.Reader))
+	defer priv.Destroy()
+
+	assertNotNil(t, priv.xMemory)
+
+	hashed := []byte("hello world, this is a hash")
+	sig, err := priv.Sign(rand.Reader, hashed)
+	assertNil(t, err)
+
+	_, ok := priv.PublicKey().Verify(hashed, sig)
+	assertTrue(t, ok)
+}
@@ -29,8 +29,8 @@ func (d dynamicSecurityEventHandler) HandleSecurityEvent(event SecurityEvent) {
 }
 
 func (c *Conversation) securityEvent(e SecurityEvent) {
-	if c.securityEventHandler != nil {
-		c.securityEventHandler.HandleSecurityEvent(e)
+	if h := c.securityEventHandler; h != nil {
+		c.callHandler(func() { h.HandleSecurityEvent(e) })
 	}
 }
 
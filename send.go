@@ -3,11 +3,56 @@ package otr3
 import (
 	"bufio"
 	"bytes"
+	"time"
 )
 
 // Send takes a human readable message from the local user, possibly encrypts
 // it and returns zero or more messages to send to the peer.
 func (c *Conversation) Send(m ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
+	toSend, _, err := c.SendWithOptions(m, SendOptions{}, trace...)
+	return toSend, err
+}
+
+// SendWithMetadata works like Send, but also returns information about the sent message, like the ID it got
+// in the outbound queue, which is used when its delivery status is reported to the QueuedMessageHandler
+func (c *Conversation) SendWithMetadata(m ValidMessage, trace ...interface{}) ([]ValidMessage, MessageMetadata, error) {
+	return c.SendWithOptions(m, SendOptions{}, trace...)
+}
+
+// SendOptions changes how a single message is sent. The zero value sends the message like Send does.
+type SendOptions struct {
+	// ID asks the peer for receipts for the message, which will be reported to the ReceiptHandler with this ID.
+	// Peers that don't support receipts ignore the request. If it is empty, no receipts are asked for.
+	ID MessageID
+	// TLVs are application defined TLVs attached to the data message, as described for SendWithTLVs
+	TLVs []TLV
+	// Retention asks the peer to delete the message after the given time. It is only a request, and the peer can't
+	// be forced to honor it. The retention is sent in whole seconds, rounded up. Zero uses the retention set with
+	// SetDefaultRetention, and a negative retention asks for no retention at all.
+	Retention time.Duration
+}
+
+// SendWithOptions works like SendWithMetadata, but sends the message with the options given.
+// The trace is only passed on to the events about the message, and never changes what is sent.
+func (c *Conversation) SendWithOptions(m ValidMessage, opts SendOptions, trace ...interface{}) (toSend []ValidMessage, meta MessageMetadata, err error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	if len(opts.ID) > maxMessageIDLength {
+		return nil, MessageMetadata{}, errMessageIDTooLong
+	}
+
+	c.sentMetadata = MessageMetadata{Outgoing: true}
+	if len(opts.TLVs) > 0 {
+		toSend, err = c.sendWithTLVs(m, opts, trace...)
+	} else {
+		toSend, err = c.send(m, opts, trace...)
+	}
+	meta = c.sentMetadata
+	return
+}
+
+func (c *Conversation) send(m ValidMessage, opts SendOptions, trace ...interface{}) ([]ValidMessage, error) {
 	message := makeCopy(m)
 	defer wipeBytes(message)
 
@@ -22,9 +67,9 @@ func (c *Conversation) Send(m ValidMessage, trace ...interface{}) ([]ValidMessag
 
 	switch c.msgState {
 	case plainText:
-		return c.withInjections(c.sendMessageOnPlaintext(message, trace...))
+		return c.withInjections(c.sendMessageOnPlaintext(message, opts, trace...))
 	case encrypted:
-		return c.withInjections(c.sendMessageOnEncrypted(message))
+		return c.withInjections(c.sendMessageOnEncrypted(message, opts, trace...))
 	case finished:
 		c.messageEvent(MessageEventConnectionEnded)
 		return c.withInjections(nil, newOtrError("cannot send message because secure conversation has finished"))
@@ -33,25 +78,28 @@ func (c *Conversation) Send(m ValidMessage, trace ...interface{}) ([]ValidMessag
 	return c.withInjections(nil, newOtrError("cannot send message in current state"))
 }
 
-func (c *Conversation) sendMessageOnPlaintext(message ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
+func (c *Conversation) sendMessageOnPlaintext(message ValidMessage, opts SendOptions, trace ...interface{}) ([]ValidMessage, error) {
 	if c.Policies.has(requireEncryption) {
 		c.messageEvent(MessageEventEncryptionRequired, trace...)
 		c.updateLastSent()
 		c.updateMayRetransmitTo(retransmitExact)
-		c.lastMessage(MessagePlaintext(makeCopy(message)), trace...)
+		c.queueMessage(MessagePlaintext(message), opts, trace...)
 		return []ValidMessage{c.QueryMessage()}, nil
 	}
 
 	return []ValidMessage{makeCopy(c.appendWhitespaceTag(message))}, nil
 }
 
-func (c *Conversation) sendMessageOnEncrypted(message ValidMessage) ([]ValidMessage, error) {
-	result, _, err := c.createSerializedDataMessage(message, messageFlagNormal, []tlv{})
+func (c *Conversation) sendMessageOnEncrypted(message ValidMessage, opts SendOptions, trace ...interface{}) ([]ValidMessage, error) {
+	result, _, err := c.createSerializedDataMessage(message, messageFlagNormal, c.outgoingTLVsFor(opts))
 	if err != nil {
 		c.messageEvent(MessageEventEncryptionError)
 		c.generatePotentialErrorMessage(ErrorCodeEncryptionError)
+		return result, err
 	}
 
+	c.sentMetadata = c.sentWithRetention(c.lastMessage(MessagePlaintext(message), opts, trace...), opts)
+
 	return result, err
 }
 
@@ -70,6 +118,7 @@ func (c *Conversation) sendDHCommit() (toSend messageWithHeader, err error) {
 	}
 
 	c.ake.state = authStateAwaitingDHKey{}
+	c.auditWithDetail(AuditAKEStarted, "initiated")
 
 	return
 }
@@ -77,9 +77,9 @@ func Test_Send_saveLastMessageWhenMsgIsPlainTextAndEncryptedIsExpected(t *testin
 
 	c.Send(m)
 
-	assertDeepEquals(t, c.resend.pending(),
-		[]messageToResend{
-			messageToResend{MessagePlaintext(m), nil},
+	assertDeepEquals(t, withoutQueuedTimes(c.resend.pending()),
+		[]QueuedMessage{
+			QueuedMessage{ID: 1, Message: MessagePlaintext(m), Status: QueuedMessageQueued},
 		})
 }
 
@@ -93,10 +93,10 @@ func Test_Send_saveLastMessageWhenMsgIsPlainTextAndEncryptedIsExpected_AndAddsAn
 	c.Send(m, 42, "hello")
 	c.Send(m2, 15, "something")
 
-	assertDeepEquals(t, c.resend.pending(),
-		[]messageToResend{
-			messageToResend{MessagePlaintext(m), []interface{}{42, "hello"}},
-			messageToResend{MessagePlaintext(m2), []interface{}{15, "something"}},
+	assertDeepEquals(t, withoutQueuedTimes(c.resend.pending()),
+		[]QueuedMessage{
+			QueuedMessage{ID: 1, Message: MessagePlaintext(m), Status: QueuedMessageQueued, Trace: []interface{}{42, "hello"}},
+			QueuedMessage{ID: 2, Message: MessagePlaintext(m2), Status: QueuedMessageQueued, Trace: []interface{}{15, "something"}},
 		})
 }
 
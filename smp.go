@@ -2,37 +2,39 @@ package otr3
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/coyim/gotrax"
 )
 
+// smp is the SMP state of a conversation. The protocol itself is run by the embedded engine.
 type smp struct {
-	state    smpState
-	question *string
-	secret   *big.Int
-	s1       *smp1State
-	s2       *smp2State
-	s3       *smp3State
+	SMP
+	timeout time.Duration
+
+	ourNormalization  SecretNormalization
+	normalization     SecretNormalization
+	nextNormalization SecretNormalization
+
+	// offeredNormalization and normalizedSecret are kept by the side starting the exchange until the peer has replied
+	offeredNormalization SecretNormalization
+	normalizedSecret     []byte
+
+	authentication *Authentication
 }
 
 const smpVersion = 1
 
 func (s *smp) wipe() {
-	s.state = nil
-	s.question = nil
-	wipeBigInt(s.secret)
-	s.secret = nil
-	s.s1 = nil
-	s.s2 = nil
-	s.s3 = nil
+	s.SMP.wipe()
+	s.normalization = 0
+	s.forgetNormalizedSecret()
 }
 
-func (s *smp) ensureSMP() {
-	if s.state != nil {
-		return
-	}
-
-	s.state = smpStateExpect1{}
+func (s *smp) forgetNormalizedSecret() {
+	wipeBytes(s.normalizedSecret)
+	s.normalizedSecret = nil
+	s.offeredNormalization = 0
 }
 
 // SMPQuestion returns the current SMP question and ok if there is one, and not ok if there isn't one.
@@ -43,34 +45,36 @@ func (c *Conversation) SMPQuestion() (string, bool) {
 	return *c.smp.question, true
 }
 
-func generateSMPSecret(initiatorFingerprint, recipientFingerprint, ssid, secret []byte, v otrVersion) *big.Int {
+func generateSMPSecret(initiatorFingerprint, recipientFingerprint, ssid, secret []byte, v smpParameters) *big.Int {
 	h := v.hash2Instance()
 	h.Write([]byte{smpVersion})
 	h.Write(initiatorFingerprint)
 	h.Write(recipientFingerprint)
 	h.Write(ssid)
 	h.Write(secret)
-	return new(big.Int).SetBytes(h.Sum(nil))
+	sum := h.Sum(nil)
+	defer wipeBytes(sum)
+	return new(big.Int).SetBytes(sum)
 }
 
 func generateDZKP(r, a, c *big.Int) *big.Int {
-	return subMod(r, mul(a, c), q)
+	return subMod(r, mulMod(a, c, q), q)
 }
 
-func generateZKP(r, a *big.Int, ix byte, v otrVersion) (c, d *big.Int) {
+func generateZKP(r, a *big.Int, ix byte, v smpParameters) (c, d *big.Int) {
 	c = hashMPIsBN(v.hash2Instance(), ix, modExp(g1, r))
 	d = generateDZKP(r, a, c)
 	return
 }
 
-func verifyZKP(d, gen, c *big.Int, ix byte, v otrVersion) bool {
+func verifyZKP(d, gen, c *big.Int, ix byte, v smpParameters) bool {
 	r := modExp(g1, d)
 	s := modExp(gen, c)
 	t := hashMPIsBN(v.hash2Instance(), ix, mulMod(r, s, p))
 	return eq(c, t)
 }
 
-func verifyZKP2(g2, g3, d5, d6, pb, qb, cp *big.Int, ix byte, v otrVersion) bool {
+func verifyZKP2(g2, g3, d5, d6, pb, qb, cp *big.Int, ix byte, v smpParameters) bool {
 	l := mulMod(
 		modExp(g3, d5),
 		modExp(pb, cp),
@@ -83,14 +87,14 @@ func verifyZKP2(g2, g3, d5, d6, pb, qb, cp *big.Int, ix byte, v otrVersion) bool
 	return eq(cp, t)
 }
 
-func verifyZKP3(cp, g2, g3, d5, d6, pa, qa *big.Int, ix byte, v otrVersion) bool {
+func verifyZKP3(cp, g2, g3, d5, d6, pa, qa *big.Int, ix byte, v smpParameters) bool {
 	l := mulMod(modExp(g3, d5), modExp(pa, cp), p)
 	r := mulMod(mul(modExp(g1, d5), modExp(g2, d6)), modExp(qa, cp), p)
 	t := hashMPIsBN(v.hash2Instance(), ix, l, r)
 	return eq(cp, t)
 }
 
-func verifyZKP4(cr, g3a, d7, qaqb, ra *big.Int, ix byte, v otrVersion) bool {
+func verifyZKP4(cr, g3a, d7, qaqb, ra *big.Int, ix byte, v smpParameters) bool {
 	l := mulMod(modExp(g1, d7), modExp(g3a, cr), p)
 	r := mulMod(modExp(qaqb, d7), modExp(ra, cr), p)
 	t := hashMPIsBN(v.hash2Instance(), ix, l, r)
@@ -0,0 +1,182 @@
+package otr3
+
+import (
+	"sync"
+	"time"
+)
+
+// maxSMPBackOffShift limits how many times the back-off can be doubled
+const maxSMPBackOffShift = 16
+
+// SMPAttempts counts the SMP exchanges with a peer, so they can be shown to the user
+type SMPAttempts struct {
+	// Attempts is the number of SMP exchanges started, by either side
+	Attempts int
+	// Failures is the number of exchanges that failed since the last successful one
+	Failures int
+	// LastFailure is when the last failure happened
+	LastFailure time.Time
+}
+
+// SMPAttemptLimit limits how many times the peer can try to guess the SMP secret.
+// After MaxFailures failed exchanges, SMP exchanges started by the peer are refused for BackOff.
+// The back-off doubles with every further failure. A MaxFailures of zero means there is no limit, which is the default.
+type SMPAttemptLimit struct {
+	MaxFailures int
+	BackOff     time.Duration
+}
+
+// blockedUntil returns until when SMP exchanges started by the peer will be refused, and false if they are not refused
+func (l SMPAttemptLimit) blockedUntil(a SMPAttempts, now time.Time) (time.Time, bool) {
+	if l.MaxFailures <= 0 || a.Failures < l.MaxFailures {
+		return time.Time{}, false
+	}
+
+	shift := uint(a.Failures - l.MaxFailures)
+	if shift > maxSMPBackOffShift {
+		shift = maxSMPBackOffShift
+	}
+
+	until := a.LastFailure.Add(l.BackOff << shift)
+	return until, now.Before(until)
+}
+
+func (a *SMPAttempts) started() {
+	a.Attempts++
+}
+
+func (a *SMPAttempts) failed(now time.Time) {
+	a.Failures++
+	a.LastFailure = now
+}
+
+func (a *SMPAttempts) succeeded() {
+	a.Failures = 0
+}
+
+// SMPAttemptTracker counts SMP exchanges per fingerprint, so that the limit also applies when a peer
+// starts new conversations. The same tracker should be given to all conversations. It is safe for concurrent use.
+type SMPAttemptTracker struct {
+	sync.Mutex
+	attempts map[string]*SMPAttempts
+}
+
+// NewSMPAttemptTracker returns a new, empty tracker
+func NewSMPAttemptTracker() *SMPAttemptTracker {
+	return &SMPAttemptTracker{attempts: make(map[string]*SMPAttempts)}
+}
+
+// AttemptsFor returns the SMP exchanges counted for the peer with the given fingerprint
+func (t *SMPAttemptTracker) AttemptsFor(fingerprint []byte) SMPAttempts {
+	t.Lock()
+	defer t.Unlock()
+
+	if a, ok := t.attempts[string(fingerprint)]; ok {
+		return *a
+	}
+	return SMPAttempts{}
+}
+
+// Reset forgets the SMP exchanges counted for the peer with the given fingerprint
+func (t *SMPAttemptTracker) Reset(fingerprint []byte) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.attempts, string(fingerprint))
+}
+
+func (t *SMPAttemptTracker) update(fingerprint []byte, f func(*SMPAttempts)) {
+	t.Lock()
+	defer t.Unlock()
+
+	a, ok := t.attempts[string(fingerprint)]
+	if !ok {
+		a = &SMPAttempts{}
+		t.attempts[string(fingerprint)] = a
+	}
+	f(a)
+}
+
+// SetSMPAttemptLimit sets how many failed SMP exchanges are allowed before exchanges started by the peer are refused
+func (c *Conversation) SetSMPAttemptLimit(l SMPAttemptLimit) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	c.smpAttemptLimit = l
+}
+
+// SetSMPAttemptTracker sets the tracker used to count SMP exchanges per fingerprint
+func (c *Conversation) SetSMPAttemptTracker(t *SMPAttemptTracker) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	c.smpAttemptTracker = t
+}
+
+// SMPAttempts returns the SMP exchanges counted in this conversation
+func (c *Conversation) SMPAttempts() SMPAttempts {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	return c.smpAttempts
+}
+
+// SMPBlockedUntil returns until when SMP exchanges started by the peer will be refused, and false if they are not refused
+func (c *Conversation) SMPBlockedUntil() (time.Time, bool) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	return c.smpBlockedUntil()
+}
+
+func (c *Conversation) smpBlockedUntil() (time.Time, bool) {
+	now := c.now()
+	until, blocked := c.smpAttemptLimit.blockedUntil(c.smpAttempts, now)
+
+	if fp, ok := c.theirFingerprint(); ok && c.smpAttemptTracker != nil {
+		if u, b := c.smpAttemptLimit.blockedUntil(c.smpAttemptTracker.AttemptsFor(fp), now); b && u.After(until) {
+			until, blocked = u, true
+		}
+	}
+
+	return until, blocked
+}
+
+func (c *Conversation) theirFingerprint() ([]byte, bool) {
+	if c.theirKey == nil {
+		return nil, false
+	}
+	return c.theirKey.Fingerprint(), true
+}
+
+func (c *Conversation) updateSMPAttempts(f func(*SMPAttempts)) {
+	f(&c.smpAttempts)
+
+	if fp, ok := c.theirFingerprint(); ok && c.smpAttemptTracker != nil {
+		c.smpAttemptTracker.update(fp, f)
+	}
+}
+
+func (c *Conversation) smpAttemptStarted() {
+	c.updateSMPAttempts((*SMPAttempts).started)
+}
+
+func (c *Conversation) smpAttemptFailed() {
+	now := c.now()
+	c.updateSMPAttempts(func(a *SMPAttempts) { a.failed(now) })
+}
+
+func (c *Conversation) smpAttemptSucceeded() {
+	c.updateSMPAttempts((*SMPAttempts).succeeded)
+}
+
+// refuseSMPIfBlocked returns the abort message to send if the peer has failed too many times to be allowed to start another exchange
+func (c *Conversation) refuseSMPIfBlocked() (*tlv, bool) {
+	if _, blocked := c.smpBlockedUntil(); !blocked {
+		return nil, false
+	}
+
+	c.smpEvent(SMPEventAttemptsExceeded, 0)
+	t := c.smp.restartSMP()
+	return &t, true
+}
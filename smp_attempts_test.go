@@ -0,0 +1,92 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_SMPAttempts_countsExchangesAndFailures(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	clock := &fixedClock{time.Now()}
+	bob.SetClock(clock)
+
+	fixtureSMPWithSecrets(t, alice, bob, "one", "two")
+	fixtureSMPWithSecrets(t, alice, bob, "one", "three")
+
+	assertEquals(t, bob.SMPAttempts(), SMPAttempts{Attempts: 2, Failures: 2, LastFailure: clock.t})
+	assertEquals(t, alice.SMPAttempts().Attempts, 2)
+
+	fixtureSMPWithSecrets(t, alice, bob, "one", "one")
+	assertEquals(t, bob.SMPAttempts(), SMPAttempts{Attempts: 3, Failures: 0, LastFailure: clock.t})
+}
+
+func Test_SMPAttempts_refusesExchangesStartedByThePeerAfterTooManyFailures(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	clock := &fixedClock{time.Now()}
+	bob.SetClock(clock)
+	bob.SetSMPAttemptLimit(SMPAttemptLimit{MaxFailures: 2, BackOff: time.Minute})
+
+	fixtureSMPWithSecrets(t, alice, bob, "one", "two")
+	_, blocked := bob.SMPBlockedUntil()
+	assertFalse(t, blocked)
+	fixtureSMPWithSecrets(t, alice, bob, "one", "three")
+
+	until, blocked := bob.SMPBlockedUntil()
+	assertTrue(t, blocked)
+	assertEquals(t, until, clock.t.Add(time.Minute))
+
+	var events []SMPEvent
+	bob.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		events = append(events, event)
+	}}
+
+	toSend, _ := alice.StartAuthenticate("", []byte("one"))
+	_, toSend, err := bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, events, []SMPEvent{SMPEventAttemptsExceeded})
+	assertEquals(t, bob.SMPAttempts().Attempts, 2)
+
+	alice.Receive(toSend[0])
+	assertFalse(t, alice.smp.inProgress())
+
+	clock.t = clock.t.Add(time.Minute)
+	assertEquals(t, fixtureSMPWithSecrets(t, alice, bob, "one", "four"), SMPEventFailure)
+
+	until, _ = bob.SMPBlockedUntil()
+	assertEquals(t, until, clock.t.Add(2*time.Minute))
+}
+
+func Test_SMPAttempts_areSharedBetweenConversationsWithTheSameFingerprint(t *testing.T) {
+	tracker := NewSMPAttemptTracker()
+	limit := SMPAttemptLimit{MaxFailures: 1, BackOff: time.Hour}
+
+	alice, bob := fixtureEncryptedConversations()
+	bob.SetSMPAttemptTracker(tracker)
+	fixtureSMPWithSecrets(t, alice, bob, "one", "two")
+
+	fp := alice.ourCurrentKey.PublicKey().Fingerprint()
+	assertEquals(t, tracker.AttemptsFor(fp).Failures, 1)
+
+	alice2, bob2 := fixtureEncryptedConversations()
+	bob2.SetSMPAttemptTracker(tracker)
+	bob2.SetSMPAttemptLimit(limit)
+	_, blocked := bob2.SMPBlockedUntil()
+	assertTrue(t, blocked)
+
+	tracker.Reset(fp)
+	_, blocked = bob2.SMPBlockedUntil()
+	assertFalse(t, blocked)
+	assertEquals(t, fixtureSMPWithSecrets(t, alice2, bob2, "one", "one"), SMPEventSuccess)
+}
+
+func Test_SMPAttemptLimit_capsTheBackOff(t *testing.T) {
+	now := time.Now()
+	l := SMPAttemptLimit{MaxFailures: 1, BackOff: time.Second}
+
+	until, blocked := l.blockedUntil(SMPAttempts{Failures: 100, LastFailure: now}, now)
+	assertTrue(t, blocked)
+	assertEquals(t, until, now.Add(time.Second<<maxSMPBackOffShift))
+
+	_, blocked = SMPAttemptLimit{}.blockedUntil(SMPAttempts{Failures: 100, LastFailure: now}, now)
+	assertFalse(t, blocked)
+}
@@ -0,0 +1,152 @@
+package otr3
+
+// Authentication is an SMP exchange that can be waited for or cancelled. It is returned by Authenticate and AnswerAuthentication.
+// The SMP event handler is still called as usual while the exchange proceeds.
+// When the exchange is aborted because its context is done, there is no call to return the abort message from, so it is
+// returned by the next call to Poll instead. The application has to call Poll when NextTimer says, as it does for other timers.
+type Authentication struct {
+	c      *Conversation
+	done   chan struct{}
+	result SMPEvent
+}
+
+// Context is the part of context.Context used to cancel an exchange or give up waiting for it. Any context.Context can be
+// given, but this package doesn't depend on the context package, so that it still builds with versions of Go without it.
+type Context interface {
+	Done() <-chan struct{}
+	Err() error
+}
+
+// Authenticate starts authenticating the peer, like StartAuthenticate, and returns the messages to send together with
+// a handle for the result. If ctx is done before the exchange has finished, the exchange is aborted and the abort
+// message for the peer is returned by the next call to Poll.
+func (c *Conversation) Authenticate(ctx Context, question string, mutualSecret []byte) (*Authentication, []ValidMessage, error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	msgs, err := c.startAuthenticate(question, mutualSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.newAuthentication(ctx), msgs, nil
+}
+
+// AnswerAuthentication answers an authentication started by the peer, like ProvideAuthenticationSecret, and returns the
+// messages to send together with a handle for the result. If ctx is done before the exchange has finished, the exchange
+// is aborted and the abort message for the peer is returned by the next call to Poll.
+func (c *Conversation) AnswerAuthentication(ctx Context, mutualSecret []byte) (*Authentication, []ValidMessage, error) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	msgs, err := c.provideAuthenticationSecret(mutualSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.newAuthentication(ctx), msgs, nil
+}
+
+func (c *Conversation) newAuthentication(ctx Context) *Authentication {
+	// Starting a new exchange aborts the one in progress
+	c.authenticationFinished(SMPEventAbort)
+
+	a := &Authentication{c: c, done: make(chan struct{})}
+	c.smp.authentication = a
+
+	// A context that can never be done, like context.Background, doesn't need to be watched
+	if cancel := ctx.Done(); cancel != nil {
+		go a.abortWhenDone(cancel)
+	}
+	return a
+}
+
+// abortWhenDone aborts the exchange if cancel is closed before it has finished, and leaves the abort message for Poll.
+// It returns as soon as the exchange finishes, however that happens, so it never outlives the exchange.
+func (a *Authentication) abortWhenDone(cancel <-chan struct{}) {
+	select {
+	case <-a.done:
+		return
+	case <-cancel:
+	}
+
+	c := a.c
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	if c.smp.authentication != a {
+		return
+	}
+
+	// An error can only happen when the Rand reader is broken, and then the peer will time out
+	msgs, _ := c.abortAuthentication()
+	if c.msgState == encrypted {
+		c.schedule(c.now(), func() []ValidMessage { return msgs })
+	}
+}
+
+// Done returns a channel that is closed when the exchange has finished
+func (a *Authentication) Done() <-chan struct{} {
+	return a.done
+}
+
+// Result returns the event that finished the exchange, and false if it hasn't finished yet.
+// SMPEventSuccess means the peer was authenticated. Cancelling the exchange finishes it with SMPEventAbort.
+func (a *Authentication) Result() (SMPEvent, bool) {
+	select {
+	case <-a.done:
+		return a.result, true
+	default:
+		return 0, false
+	}
+}
+
+// Succeeded returns true if the exchange has finished and the peer was authenticated
+func (a *Authentication) Succeeded() bool {
+	r, ok := a.Result()
+	return ok && r == SMPEventSuccess
+}
+
+// Wait waits until the exchange has finished and returns the event that finished it, or the error of ctx if it is done first.
+// Giving up waiting doesn't cancel the exchange.
+func (a *Authentication) Wait(ctx Context) (SMPEvent, error) {
+	select {
+	case <-a.done:
+		return a.result, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// Cancel aborts the exchange, if it is still in progress, and returns the abort message to send to the peer
+func (a *Authentication) Cancel() ([]ValidMessage, error) {
+	c := a.c
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	if c.smp.authentication != a {
+		return nil, nil
+	}
+
+	return c.abortAuthentication()
+}
+
+func isFinalSMPEvent(e SMPEvent) bool {
+	switch e {
+	case SMPEventAskForAnswer, SMPEventAskForSecret, SMPEventInProgress:
+		return false
+	}
+	return true
+}
+
+// authenticationFinished finishes the exchange waited for, if there is one
+func (c *Conversation) authenticationFinished(e SMPEvent) {
+	a := c.smp.authentication
+	if a == nil {
+		return
+	}
+
+	c.smp.authentication = nil
+	a.result = e
+	close(a.done)
+}
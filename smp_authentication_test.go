@@ -0,0 +1,220 @@
+package otr3
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// testContext stands in for a context.Context, since not all the versions of Go supported have the context package
+type testContext struct {
+	done chan struct{}
+}
+
+var errTestContextCancelled = errors.New("context cancelled")
+
+func newTestContext() *testContext {
+	return &testContext{done: make(chan struct{})}
+}
+
+func (c *testContext) cancel() {
+	close(c.done)
+}
+
+func (c *testContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *testContext) Err() error {
+	select {
+	case <-c.done:
+		return errTestContextCancelled
+	default:
+		return nil
+	}
+}
+
+// backgroundContext is never done, like context.Background
+type backgroundContext struct{}
+
+func (backgroundContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (backgroundContext) Err() error {
+	return nil
+}
+
+func Test_Authenticate_finishesWithTheResultOfTheExchange(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetHeartbeatInterval(-1)
+	bob.SetHeartbeatInterval(-1)
+
+	a, toSend, err := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+	assertNil(t, err)
+	_, ok := a.Result()
+	assertFalse(t, ok)
+
+	bob.Receive(toSend[0])
+	b, toSend, err := bob.AnswerAuthentication(backgroundContext{}, []byte("secret"))
+	assertNil(t, err)
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	assertTrue(t, b.Succeeded())
+	assertFalse(t, a.Succeeded())
+
+	alice.Receive(toSend[0])
+	r, err := a.Wait(backgroundContext{})
+	assertNil(t, err)
+	assertEquals(t, r, SMPEventSuccess)
+	assertTrue(t, a.Succeeded())
+}
+
+func Test_Authenticate_finishesWithTheAbortSentByThePeerWhenTheSecretsDontMatch(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetHeartbeatInterval(-1)
+	bob.SetHeartbeatInterval(-1)
+
+	a, toSend, _ := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+	bob.Receive(toSend[0])
+	toSend, _ = bob.ProvideAuthenticationSecret([]byte("wrong"))
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, ok := a.Result()
+	assertFalse(t, ok)
+
+	alice.Receive(toSend[0])
+
+	r, ok := a.Result()
+	assertTrue(t, ok)
+	assertEquals(t, r, SMPEventAbort)
+	assertFalse(t, a.Succeeded())
+}
+
+func Test_Authenticate_stillCallsTheEventHandler(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	var events []SMPEvent
+	alice.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		events = append(events, event)
+	}}
+
+	a, _, _ := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+	alice.smpTimedOut()
+
+	r, _ := a.Result()
+	assertEquals(t, r, SMPEventTimeout)
+	assertDeepEquals(t, events, []SMPEvent{SMPEventTimeout})
+}
+
+func Test_Authentication_Cancel_returnsTheAbortMessage(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	a, _, _ := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+
+	toSend, err := a.Cancel()
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertFalse(t, alice.smp.inProgress())
+
+	r, _ := a.Result()
+	assertEquals(t, r, SMPEventAbort)
+
+	var events []SMPEvent
+	bob.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		events = append(events, event)
+	}}
+	bob.Receive(toSend[0])
+	assertDeepEquals(t, events, []SMPEvent{SMPEventAbort})
+
+	toSend, err = a.Cancel()
+	assertNil(t, err)
+	assertNil(t, toSend)
+}
+
+func Test_Authenticate_abortsTheExchangeWhenTheContextIsDone(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	alice.SetHeartbeatInterval(-1)
+	ctx := newTestContext()
+
+	a, _, _ := alice.Authenticate(ctx, "", []byte("secret"))
+	ctx.cancel()
+	<-a.Done()
+
+	r, _ := a.Result()
+	assertEquals(t, r, SMPEventAbort)
+	assertEquals(t, len(alice.Poll()), 1)
+}
+
+func Test_Authenticate_doesntStartAGoroutineForAContextThatIsNeverDone(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	alice.SetHeartbeatInterval(-1)
+
+	before := runtime.NumGoroutine()
+	alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+
+	assertTrue(t, runtime.NumGoroutine() <= before)
+}
+
+func Test_Authenticate_stopsWaitingForTheContextWhenTheExchangeFinishes(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	alice.SetHeartbeatInterval(-1)
+	ctx := newTestContext()
+
+	before := runtime.NumGoroutine()
+	a, _, _ := alice.Authenticate(ctx, "", []byte("secret"))
+	a.Cancel()
+
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assertTrue(t, runtime.NumGoroutine() <= before)
+}
+
+func Test_Authenticate_doesntAbortAFinishedExchangeWhenTheContextIsDone(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	alice.SetHeartbeatInterval(-1)
+	ctx := newTestContext()
+
+	alice.Authenticate(ctx, "", []byte("secret"))
+	b, _, _ := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+	ctx.cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	_, finished := b.Result()
+	assertFalse(t, finished)
+	assertEquals(t, len(alice.Poll()), 0)
+}
+
+func Test_Authenticate_abortsTheExchangeItReplaces(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	first, _, _ := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+	second, _, _ := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+
+	r, _ := first.Result()
+	assertEquals(t, r, SMPEventAbort)
+	_, ok := second.Result()
+	assertFalse(t, ok)
+}
+
+func Test_Authentication_Wait_givesUpWhenTheContextIsDone(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	a, _, _ := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+
+	ctx := newTestContext()
+	ctx.cancel()
+
+	_, err := a.Wait(ctx)
+	assertEquals(t, err, errTestContextCancelled)
+	assertTrue(t, alice.smp.inProgress())
+}
+
+func Test_Conversation_End_finishesTheExchangeWaitedFor(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	a, _, _ := alice.Authenticate(backgroundContext{}, "", []byte("secret"))
+
+	alice.End()
+
+	r, _ := a.Result()
+	assertEquals(t, r, SMPEventAbort)
+}
@@ -0,0 +1,260 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"math/big"
+)
+
+var errNotAnSMPMessage = newOtrError("not an SMP message")
+
+// SMPConfig contains what an SMP engine needs to know about the two parties and the session they share
+type SMPConfig struct {
+	// OurFingerprint and TheirFingerprint are the fingerprints of the keys of both parties
+	OurFingerprint   []byte
+	TheirFingerprint []byte
+	// SessionID identifies the secure session both parties share
+	SessionID []byte
+	// Hash is the hash used to compute the secret and the zero knowledge proofs. If it is nil, SHA-256 is used
+	Hash func() hash.Hash
+	// Rand is the source of randomness. If it is nil, crypto/rand is used
+	Rand io.Reader
+	// MaxBits limits the size of the values received from the peer. If it is zero, DefaultLimits.MaxSMPBits is used
+	MaxBits int
+}
+
+// SMP runs the Socialist Millionaires' Protocol, which lets two parties find out if they know the same secret without revealing it.
+// The messages it creates and receives are serialized TLVs, in the same format used inside OTR data messages, and can be
+// exchanged over any transport. Both parties have to use the same SessionID and opposite fingerprints.
+// The progress of the protocol is reported to the SMPEventHandler. SMP is not safe for concurrent use.
+type SMP struct {
+	state    smpState
+	question *string
+	secret   *big.Int
+	// secretMemory holds the words of secret, if it could be allocated
+	secretMemory *SecretBuffer
+	s1           *smp1State
+	s2           *smp2State
+	s3           *smp3State
+
+	ourFingerprint   []byte
+	theirFingerprint []byte
+	sessionID        []byte
+	params           smpParameters
+	rand             io.Reader
+	maxBits          int
+	eventHandler     SMPEventHandler
+}
+
+// smpParameters are the parts of the protocol version that SMP depends on
+type smpParameters interface {
+	parameterLength() int
+	isGroupElement(n *big.Int) bool
+	hash2Instance() hash.Hash
+}
+
+// standaloneSMPParameters are the parameters used by SMP outside of a conversation, which are the same as in OTR version 3
+type standaloneSMPParameters struct {
+	hash func() hash.Hash
+}
+
+func (standaloneSMPParameters) parameterLength() int {
+	return otrV3{}.parameterLength()
+}
+
+func (standaloneSMPParameters) isGroupElement(n *big.Int) bool {
+	return isGroupElement(n)
+}
+
+func (p standaloneSMPParameters) hash2Instance() hash.Hash {
+	return p.hash()
+}
+
+// NewSMP returns an SMP engine for the parties and session given
+func NewSMP(config SMPConfig) *SMP {
+	h := config.Hash
+	if h == nil {
+		h = sha256.New
+	}
+
+	return &SMP{
+		state:            smpStateExpect1{},
+		ourFingerprint:   config.OurFingerprint,
+		theirFingerprint: config.TheirFingerprint,
+		sessionID:        config.SessionID,
+		params:           standaloneSMPParameters{h},
+		rand:             config.Rand,
+		maxBits:          limitOrDefault(config.MaxBits, DefaultLimits.MaxSMPBits),
+	}
+}
+
+// SetEventHandler assigns the handler that is told about the progress of the protocol
+func (sm *SMP) SetEventHandler(handler SMPEventHandler) {
+	sm.eventHandler = handler
+}
+
+// Start starts the protocol with an optional question, and returns the message to send to the peer.
+// If an exchange is already in progress, it is aborted first.
+func (sm *SMP) Start(question string, secret []byte) ([]byte, error) {
+	sm.ensureSMP()
+
+	tlvs, err := sm.state.startAuthenticate(sm, question, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return serializeTLVs(tlvs), nil
+}
+
+// ProvideSecret continues the protocol started by the peer, after SMPEventAskForSecret or SMPEventAskForAnswer has been
+// signalled, and returns the message to send to the peer
+func (sm *SMP) ProvideSecret(secret []byte) ([]byte, error) {
+	sm.ensureSMP()
+
+	t, err := sm.continueSMP(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.serialize(), nil
+}
+
+// Receive handles a message from the peer, and returns the message to send back, if there is one
+func (sm *SMP) Receive(message []byte) ([]byte, error) {
+	sm.ensureSMP()
+
+	var toSend []tlv
+	for len(message) > 0 {
+		t := tlv{}
+		if err := t.deserialize(message); err != nil {
+			return nil, err
+		}
+		message = message[tlvHeaderLen+int(t.tlvLength):]
+
+		if !t.isSMPMessage() {
+			return nil, errNotAnSMPMessage
+		}
+
+		if err := checkSMPBits(t, sm.maxBits); err != nil {
+			return nil, err
+		}
+
+		m, ok := t.smpMessage()
+		if !ok {
+			return nil, newOtrError("corrupt SMP message")
+		}
+
+		reply, err := sm.receiveSMP(m)
+		if err != nil {
+			return nil, err
+		}
+
+		if reply != nil {
+			toSend = append(toSend, *reply)
+		}
+	}
+
+	return serializeTLVs(toSend), nil
+}
+
+// Abort aborts the exchange in progress, and returns the message to send to the peer
+func (sm *SMP) Abort() []byte {
+	t := sm.restartSMP()
+	return t.serialize()
+}
+
+// Question returns the question asked by the peer in the current exchange, and not ok if there isn't one
+func (sm *SMP) Question() (string, bool) {
+	if sm.question == nil {
+		return "", false
+	}
+	return *sm.question, true
+}
+
+// InProgress returns true if an exchange has been started and hasn't finished yet
+func (sm *SMP) InProgress() bool {
+	return sm.inProgress()
+}
+
+func (sm *SMP) inProgress() bool {
+	_, idle := sm.state.(smpStateExpect1)
+	return sm.state != nil && !idle
+}
+
+func (sm *SMP) wipe() {
+	sm.state = nil
+	sm.question = nil
+	sm.wipeSecret()
+	sm.s1 = nil
+	sm.s2 = nil
+	sm.s3 = nil
+}
+
+// setSecret moves the secret computed from the mutual secret into secret memory
+func (sm *SMP) setSecret(secret *big.Int) {
+	sm.wipeSecret()
+	sm.secret, sm.secretMemory = newSecretInt(secret)
+}
+
+func (sm *SMP) wipeSecret() {
+	wipeBigInt(sm.secret)
+	sm.secretMemory.Destroy()
+	sm.secret = nil
+	sm.secretMemory = nil
+}
+
+func (sm *SMP) ensureSMP() {
+	if sm.state != nil {
+		return
+	}
+
+	sm.state = smpStateExpect1{}
+}
+
+func (sm *SMP) randMPI(buf []byte) (*big.Int, error) {
+	if sm.rand == nil {
+		return randMPI(rand.Reader, buf)
+	}
+	return randMPI(sm.rand, buf)
+}
+
+func (sm *SMP) smpEvent(e SMPEvent, percent int) {
+	sm.smpEventWithQuestion(e, percent, "")
+}
+
+func (sm *SMP) smpEventWithQuestion(e SMPEvent, percent int, question string) {
+	if sm.eventHandler != nil {
+		sm.eventHandler.HandleSMPEvent(e, percent, question)
+	}
+}
+
+func serializeTLVs(tlvs []tlv) []byte {
+	var out []byte
+	for _, t := range tlvs {
+		out = append(out, t.serialize()...)
+	}
+	return out
+}
+
+// smpEngine configures the SMP engine of the conversation with the current keys and session, and returns it
+func (c *Conversation) smpEngine() *SMP {
+	sm := &c.smp.SMP
+
+	sm.ourFingerprint, sm.theirFingerprint = nil, nil
+	if c.ourCurrentKey != nil {
+		sm.ourFingerprint = c.ourCurrentKey.PublicKey().Fingerprint()
+	}
+	if c.theirKey != nil {
+		sm.theirFingerprint = c.theirKey.Fingerprint()
+	}
+
+	// Using ssid here should always be safe - we can't be in an encrypted state without having gone through the AKE
+	sm.sessionID = c.ssid[:]
+	sm.params = c.version
+	sm.rand = c.rand()
+	sm.eventHandler = dynamicSMPEventHandler{c.smpEventWithQuestion}
+
+	return sm
+}
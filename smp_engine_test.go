@@ -0,0 +1,139 @@
+package otr3
+
+import (
+	"crypto/sha1"
+	"testing"
+)
+
+func fixtureSMPEngines() (alice, bob *SMP) {
+	aliceFingerprint := bytesFromHex("0102030405060708090A0B0C0D0E0F1011121314")
+	bobFingerprint := bytesFromHex("3132333435363738393A3B3C3D3E3F4041424344")
+	sessionID := bytesFromHex("FFF1D1E412345668")
+
+	alice = NewSMP(SMPConfig{OurFingerprint: aliceFingerprint, TheirFingerprint: bobFingerprint, SessionID: sessionID})
+	bob = NewSMP(SMPConfig{OurFingerprint: bobFingerprint, TheirFingerprint: aliceFingerprint, SessionID: sessionID})
+	return
+}
+
+func recordSMPEvents(sm *SMP) *[]SMPEvent {
+	events := []SMPEvent{}
+	sm.SetEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		events = append(events, event)
+	}})
+	return &events
+}
+
+func runSMPEngines(t *testing.T, alice, bob *SMP, aliceSecret, bobSecret string) {
+	msg, err := alice.Start("", []byte(aliceSecret))
+	assertNil(t, err)
+	_, err = bob.Receive(msg)
+	assertNil(t, err)
+	msg, err = bob.ProvideSecret([]byte(bobSecret))
+	assertNil(t, err)
+	msg, err = alice.Receive(msg)
+	assertNil(t, err)
+	msg, err = bob.Receive(msg)
+	assertNil(t, err)
+	msg, err = alice.Receive(msg)
+	assertNil(t, err)
+	assertEquals(t, len(msg), 0)
+}
+
+func Test_SMP_succeedsWhenBothSidesKnowTheSameSecret(t *testing.T) {
+	alice, bob := fixtureSMPEngines()
+	aliceEvents := recordSMPEvents(alice)
+	bobEvents := recordSMPEvents(bob)
+
+	runSMPEngines(t, alice, bob, "the secret", "the secret")
+
+	assertDeepEquals(t, *aliceEvents, []SMPEvent{SMPEventInProgress, SMPEventSuccess})
+	assertDeepEquals(t, *bobEvents, []SMPEvent{SMPEventAskForSecret, SMPEventSuccess})
+	assertFalse(t, alice.InProgress())
+	assertFalse(t, bob.InProgress())
+}
+
+func Test_SMP_failsWhenTheSecretsAreDifferent(t *testing.T) {
+	alice, bob := fixtureSMPEngines()
+	aliceEvents := recordSMPEvents(alice)
+	bobEvents := recordSMPEvents(bob)
+
+	runSMPEngines(t, alice, bob, "the secret", "another secret")
+
+	assertDeepEquals(t, *aliceEvents, []SMPEvent{SMPEventInProgress, SMPEventAbort})
+	assertDeepEquals(t, *bobEvents, []SMPEvent{SMPEventAskForSecret, SMPEventFailure})
+}
+
+func Test_SMP_failsWhenTheSessionsAreDifferent(t *testing.T) {
+	alice, bob := fixtureSMPEngines()
+	bob.sessionID = bytesFromHex("0000000000000000")
+	bobEvents := recordSMPEvents(bob)
+
+	runSMPEngines(t, alice, bob, "the secret", "the secret")
+
+	assertDeepEquals(t, *bobEvents, []SMPEvent{SMPEventAskForSecret, SMPEventFailure})
+}
+
+func Test_SMP_usesTheHashGiven(t *testing.T) {
+	alice, bob := fixtureSMPEngines()
+	alice.params = standaloneSMPParameters{sha1.New}
+	bobEvents := recordSMPEvents(bob)
+
+	msg, _ := alice.Start("", []byte("the secret"))
+	bob.Receive(msg)
+
+	assertDeepEquals(t, *bobEvents, []SMPEvent{SMPEventCheated})
+}
+
+func Test_SMP_givesTheQuestionOfThePeer(t *testing.T) {
+	alice, bob := fixtureSMPEngines()
+
+	msg, _ := alice.Start("Where did we meet?", []byte("Paris"))
+	bob.Receive(msg)
+
+	q, ok := bob.Question()
+	assertTrue(t, ok)
+	assertEquals(t, q, "Where did we meet?")
+	assertTrue(t, bob.InProgress())
+}
+
+func Test_SMP_Abort_abortsThePeer(t *testing.T) {
+	alice, bob := fixtureSMPEngines()
+	bobEvents := recordSMPEvents(bob)
+
+	msg, _ := alice.Start("", []byte("the secret"))
+	bob.Receive(msg)
+	msg = alice.Abort()
+	assertFalse(t, alice.InProgress())
+
+	reply, err := bob.Receive(msg)
+	assertNil(t, err)
+	assertEquals(t, len(reply), 0)
+	assertFalse(t, bob.InProgress())
+	assertDeepEquals(t, *bobEvents, []SMPEvent{SMPEventAskForSecret, SMPEventAbort})
+}
+
+func Test_SMP_Receive_rejectsOtherTLVs(t *testing.T) {
+	_, bob := fixtureSMPEngines()
+
+	_, err := bob.Receive(tlv{tlvType: tlvTypeDisconnected}.serialize())
+	assertEquals(t, err, errNotAnSMPMessage)
+
+	_, err = bob.Receive([]byte{0x00, 0x02, 0x00})
+	assertNotNil(t, err)
+}
+
+func Test_SMP_Receive_rejectsValuesThatAreTooLarge(t *testing.T) {
+	alice, bob := fixtureSMPEngines()
+	bob.maxBits = 8
+
+	msg, _ := alice.Start("", []byte("the secret"))
+	_, err := bob.Receive(msg)
+	assertEquals(t, err, errMPITooLarge)
+}
+
+func Test_SMP_ProvideSecret_failsIfThePeerHasntStarted(t *testing.T) {
+	_, bob := fixtureSMPEngines()
+
+	_, err := bob.ProvideSecret([]byte("the secret"))
+	assertEquals(t, err, errNotWaitingForSMPSecret)
+}
@@ -22,6 +22,10 @@ const (
 	SMPEventSuccess
 	// SMPEventFailure means update the auth progress dialog with progress_percent
 	SMPEventFailure
+	// SMPEventTimeout means the current auth was aborted because the next step didn't happen within the SMP timeout
+	SMPEventTimeout
+	// SMPEventAttemptsExceeded means an auth started by the peer was refused, because it has failed too many times. See SetSMPAttemptLimit
+	SMPEventAttemptsExceeded
 )
 
 // SMPEventHandler handles SMPEvents
@@ -39,14 +43,27 @@ func (d dynamicSMPEventHandler) HandleSMPEvent(event SMPEvent, pp int, question
 }
 
 func (c *Conversation) smpEvent(e SMPEvent, percent int) {
-	if c.smpEventHandler != nil {
-		c.smpEventHandler.HandleSMPEvent(e, percent, "")
-	}
+	c.smpEventWithQuestion(e, percent, "")
 }
 
+// smpEventWithQuestion receives the events of the SMP engine, and the events of the conversation about SMP
 func (c *Conversation) smpEventWithQuestion(e SMPEvent, percent int, question string) {
-	if c.smpEventHandler != nil {
-		c.smpEventHandler.HandleSMPEvent(e, percent, question)
+	switch e {
+	case SMPEventFailure, SMPEventCheated:
+		c.smpAttemptFailed()
+	case SMPEventSuccess:
+		c.smpAttemptSucceeded()
+	}
+
+	if isFinalSMPEvent(e) {
+		c.smp.normalization = 0
+		c.smp.forgetNormalizedSecret()
+		c.authenticationFinished(e)
+		c.auditSMPFinished(e)
+	}
+
+	if h := c.smpEventHandler; h != nil {
+		c.callHandler(func() { h.HandleSMPEvent(e, percent, question) })
 	}
 }
 
@@ -68,6 +85,10 @@ func (s SMPEvent) String() string {
 		return "SMPEventSuccess"
 	case SMPEventFailure:
 		return "SMPEventFailure"
+	case SMPEventTimeout:
+		return "SMPEventTimeout"
+	case SMPEventAttemptsExceeded:
+		return "SMPEventAttemptsExceeded"
 	default:
 		return "SMP EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -26,17 +26,17 @@ func (m smp1Message) tlv() tlv {
 	return t
 }
 
-func (c *Conversation) generateSMP1Parameters() (s smp1State, err error) {
-	b := make([]byte, c.version.parameterLength())
+func (sm *SMP) generateSMP1Parameters() (s smp1State, err error) {
+	b := make([]byte, sm.params.parameterLength())
 	var err1, err2, err3, err4 error
-	s.a2, err1 = c.randMPI(b)
-	s.a3, err2 = c.randMPI(b)
-	s.r2, err3 = c.randMPI(b)
-	s.r3, err4 = c.randMPI(b)
+	s.a2, err1 = sm.randMPI(b)
+	s.a3, err2 = sm.randMPI(b)
+	s.r2, err3 = sm.randMPI(b)
+	s.r3, err4 = sm.randMPI(b)
 	return s, firstError(err1, err2, err3, err4)
 }
 
-func generateSMP1Message(s smp1State, v otrVersion) (m smp1Message) {
+func generateSMP1Message(s smp1State, v smpParameters) (m smp1Message) {
 	m.g2a = modExp(g1, s.a2)
 	m.g3a = modExp(g1, s.a3)
 	m.c2, m.d2 = generateZKP(s.r2, s.a2, 1, v)
@@ -44,28 +44,28 @@ func generateSMP1Message(s smp1State, v otrVersion) (m smp1Message) {
 	return
 }
 
-func (c *Conversation) generateSMP1() (s smp1State, err error) {
-	if s, err = c.generateSMP1Parameters(); err != nil {
+func (sm *SMP) generateSMP1() (s smp1State, err error) {
+	if s, err = sm.generateSMP1Parameters(); err != nil {
 		return s, err
 	}
-	s.msg = generateSMP1Message(s, c.version)
+	s.msg = generateSMP1Message(s, sm.params)
 	return
 }
 
-func (c *Conversation) verifySMP1(msg smp1Message) error {
-	if !c.version.isGroupElement(msg.g2a) {
+func (sm *SMP) verifySMP1(msg smp1Message) error {
+	if !sm.params.isGroupElement(msg.g2a) {
 		return newOtrError("g2a is an invalid group element")
 	}
 
-	if !c.version.isGroupElement(msg.g3a) {
+	if !sm.params.isGroupElement(msg.g3a) {
 		return newOtrError("g3a is an invalid group element")
 	}
 
-	if !verifyZKP(msg.d2, msg.g2a, msg.c2, 1, c.version) {
+	if !verifyZKP(msg.d2, msg.g2a, msg.c2, 1, sm.params) {
 		return newOtrError("c2 is not a valid zero knowledge proof")
 	}
 
-	if !verifyZKP(msg.d3, msg.g3a, msg.c3, 2, c.version) {
+	if !verifyZKP(msg.d3, msg.g3a, msg.c3, 2, sm.params) {
 		return newOtrError("c3 is not a valid zero knowledge proof")
 	}
 
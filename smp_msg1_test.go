@@ -7,7 +7,7 @@ import (
 
 func Test_generatesLongerAandRValuesForOtrV3(t *testing.T) {
 	otr := newConversation(otrV3{}, fixtureRand())
-	smp, err := otr.generateSMP1()
+	smp, err := otr.smpEngine().generateSMP1()
 	assertDeepEquals(t, smp.a2, fixtureLong1)
 	assertDeepEquals(t, smp.a3, fixtureLong2)
 	assertDeepEquals(t, smp.r2, fixtureLong3)
@@ -16,12 +16,12 @@ func Test_generatesLongerAandRValuesForOtrV3(t *testing.T) {
 }
 
 func Test_generateSMP1Parameters_ReturnsErrorIfThereIsntEnoughRandomnessForA2(t *testing.T) {
-	_, err := newConversation(otrV2{}, fixedRand([]string{"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b"})).generateSMP1Parameters()
+	_, err := newConversation(otrV2{}, fixedRand([]string{"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b"})).smpEngine().generateSMP1Parameters()
 	assertDeepEquals(t, err, errShortRandomRead)
 }
 
 func Test_generateSMP1_ReturnsErrorIfGenerateInitialParametersDoesntWork(t *testing.T) {
-	_, err := newConversation(otrV2{}, fixedRand([]string{"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b"})).generateSMP1()
+	_, err := newConversation(otrV2{}, fixedRand([]string{"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b"})).smpEngine().generateSMP1()
 	assertDeepEquals(t, err, errShortRandomRead)
 }
 
@@ -29,7 +29,7 @@ func Test_generateSMP1Parameters_ReturnsErrorIfThereIsntEnoughRandomnessForA3(t
 	_, err := newConversation(otrV2{}, fixedRand([]string{
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
-	})).generateSMP1Parameters()
+	})).smpEngine().generateSMP1Parameters()
 	assertDeepEquals(t, err, errShortRandomRead)
 }
 
@@ -38,7 +38,7 @@ func Test_generateSMP1Parameters_ReturnsErrorIfThereIsntEnoughRandomnessForR2(t
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
-	})).generateSMP1Parameters()
+	})).smpEngine().generateSMP1Parameters()
 	assertDeepEquals(t, err, errShortRandomRead)
 }
 
@@ -48,13 +48,13 @@ func Test_generateSMP1Parameters_ReturnsErrorIfThereIsntEnoughRandomnessForR3(t
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
 		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
-	})).generateSMP1Parameters()
+	})).smpEngine().generateSMP1Parameters()
 	assertDeepEquals(t, err, errShortRandomRead)
 }
 
 func Test_generatesShorterAandRValuesForOtrV2(t *testing.T) {
 	otr := newConversation(otrV2{}, fixtureRand())
-	smp, _ := otr.generateSMP1()
+	smp, _ := otr.smpEngine().generateSMP1()
 	assertDeepEquals(t, smp.a2, fixtureShort1)
 	assertDeepEquals(t, smp.a3, fixtureShort2)
 	assertDeepEquals(t, smp.r2, fixtureShort3)
@@ -63,47 +63,47 @@ func Test_generatesShorterAandRValuesForOtrV2(t *testing.T) {
 
 func Test_computesG2aAndG3aCorrectlyForOtrV3(t *testing.T) {
 	otr := newConversation(otrV3{}, fixtureRand())
-	smp, _ := otr.generateSMP1()
+	smp, _ := otr.smpEngine().generateSMP1()
 	assertDeepEquals(t, smp.msg.g2a, fixtureMessage1v3().g2a)
 	assertDeepEquals(t, smp.msg.g3a, fixtureMessage1v3().g3a)
 }
 
 func Test_computesG2aAndG3aCorrectlyForOtrV2(t *testing.T) {
 	otr := newConversation(otrV2{}, fixtureRand())
-	smp, _ := otr.generateSMP1()
+	smp, _ := otr.smpEngine().generateSMP1()
 	assertDeepEquals(t, smp.msg.g2a, fixtureMessage1().g2a)
 	assertDeepEquals(t, smp.msg.g3a, fixtureMessage1().g3a)
 }
 
 func Test_computesC2AndD2CorrectlyForOtrV2(t *testing.T) {
 	otr := newConversation(otrV2{}, fixtureRand())
-	smp, _ := otr.generateSMP1()
+	smp, _ := otr.smpEngine().generateSMP1()
 	assertDeepEquals(t, smp.msg.c2, fixtureMessage1().c2)
 	assertDeepEquals(t, smp.msg.d2, fixtureMessage1().d2)
 }
 
 func Test_computesC3AndD3CorrectlyForOtrV2(t *testing.T) {
 	otr := newConversation(otrV2{}, fixtureRand())
-	smp, _ := otr.generateSMP1()
+	smp, _ := otr.smpEngine().generateSMP1()
 	assertDeepEquals(t, smp.msg.c3, fixtureMessage1().c3)
 	assertDeepEquals(t, smp.msg.d3, fixtureMessage1().d3)
 }
 
 func Test_thatVerifySMPStartParametersCheckG2AForOtrV3(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
-	err := c.verifySMP1(smp1Message{g2a: new(big.Int).SetInt64(1)})
+	err := c.smpEngine().verifySMP1(smp1Message{g2a: new(big.Int).SetInt64(1)})
 	assertDeepEquals(t, err, newOtrError("g2a is an invalid group element"))
 }
 
 func Test_thatVerifySMPStartParametersCheckG3AForOtrV3(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
-	err := c.verifySMP1(smp1Message{g2a: new(big.Int).SetInt64(3), g3a: p})
+	err := c.smpEngine().verifySMP1(smp1Message{g2a: new(big.Int).SetInt64(3), g3a: p})
 	assertDeepEquals(t, err, newOtrError("g3a is an invalid group element"))
 }
 
 func Test_thatVerifySMPStartParametersDoesntCheckG2AForOtrV2(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
-	err := c.verifySMP1(smp1Message{
+	err := c.smpEngine().verifySMP1(smp1Message{
 		g2a: new(big.Int).SetInt64(1),
 		g3a: new(big.Int).SetInt64(1),
 		c2:  new(big.Int).SetInt64(1),
@@ -116,7 +116,7 @@ func Test_thatVerifySMPStartParametersDoesntCheckG2AForOtrV2(t *testing.T) {
 
 func Test_thatVerifySMPStartParametersDoesntCheckG3AForOtrV2(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
-	err := c.verifySMP1(smp1Message{
+	err := c.smpEngine().verifySMP1(smp1Message{
 		g2a: new(big.Int).SetInt64(3),
 		g3a: new(big.Int).SetInt64(1),
 		c2:  new(big.Int).SetInt64(1),
@@ -129,7 +129,7 @@ func Test_thatVerifySMPStartParametersDoesntCheckG3AForOtrV2(t *testing.T) {
 
 func Test_thatVerifySMPStartParametersChecksThatc2IsAValidZeroKnowledgeProof(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
-	err := c.verifySMP1(smp1Message{
+	err := c.smpEngine().verifySMP1(smp1Message{
 		g2a: new(big.Int).SetInt64(3),
 		g3a: new(big.Int).SetInt64(3),
 		c2:  new(big.Int).SetInt64(3),
@@ -142,7 +142,7 @@ func Test_thatVerifySMPStartParametersChecksThatc2IsAValidZeroKnowledgeProof(t *
 
 func Test_thatVerifySMPStartParametersChecksThatc3IsAValidZeroKnowledgeProof(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
-	err := c.verifySMP1(smp1Message{
+	err := c.smpEngine().verifySMP1(smp1Message{
 		g2a: fixtureMessage1().g2a,
 		g3a: new(big.Int).SetInt64(3),
 		c2:  fixtureMessage1().c2,
@@ -163,7 +163,7 @@ func Test_thatVerifySMPStartParametersIsOKWithAValidParameterMessage(t *testing.
 	c3, _ := new(big.Int).SetString("57d8cfda442854ecb01b28e631aa9165d51d1192f7f464bf17ea7f6665c05030", 16)
 	d3, _ := new(big.Int).SetString("7fffffffffffffffe487ed5110b4611a62633145c06e0e68948127044533e63a0105df531d89cd9128a5043cc71a026ef7ca8cd9e69d218d98158536f92f8a1ba7f09ab6b6a8e122f242dabb312f3f637a262174d31bf6b585ffae5b7a035bf6f71c35fdad44cfd2d74f9208be258ff324943328f6722d9ee1003e5c50b1df82cc6d241b0e2ae9cd348b1fd47e9267af8140bb2aa65628bcff455920bba95a1392f2fcb5c115f43a7a828b5bf0393c5c775a17a88506a7893ff509d674cd655c", 16)
 
-	err := c.verifySMP1(smp1Message{
+	err := c.smpEngine().verifySMP1(smp1Message{
 		g2a: g2a,
 		g3a: g3a,
 		c2:  c2,
@@ -184,7 +184,7 @@ func Test_thatVerifySMPStartParametersIsOKWithAValidParameterMessageWithProtocol
 	c3, _ := new(big.Int).SetString("57d8cfda442854ecb01b28e631aa9165d51d1192f7f464bf17ea7f6665c05030", 16)
 	d3, _ := new(big.Int).SetString("7fffffffffffffffe487ed5110b4611a62633145c06e0e68948127044533e63a0105df531d89cd9128a5043cc71a026ef7ca8cd9e69d218d98158536f92f8a1ba7f09ab6b6a8e122f242dabb312f3f637a262174d31bf6b585ffae5b7a035bf6f71c35fdad44cfd2d74f9208be258ff324943328f6722d9ee1003e5c50b1df82cc6d241b0e2ae9cd348b1fd47e9267af8140bb2aa65628bcff455920bba95a1392f2fcb5c115f43a7a828b5bf0393c5c775a17a88506a7893ff509d674cd655c", 16)
 
-	err := c.verifySMP1(smp1Message{
+	err := c.smpEngine().verifySMP1(smp1Message{
 		g2a: g2a,
 		g3a: g3a,
 		c2:  c2,
@@ -25,21 +25,21 @@ func (m smp2Message) tlv() tlv {
 	return genSMPTLV(uint16(tlvTypeSMP2), m.g2b, m.c2, m.d2, m.g3b, m.c3, m.d3, m.pb, m.qb, m.cp, m.d5, m.d6)
 }
 
-func (c *Conversation) generateSMP2Parameters() (s smp2State, err error) {
-	b := make([]byte, c.version.parameterLength())
+func (sm *SMP) generateSMP2Parameters() (s smp2State, err error) {
+	b := make([]byte, sm.params.parameterLength())
 	var err1, err2, err3, err4, err5, err6, err7 error
-	s.b2, err1 = c.randMPI(b)
-	s.b3, err2 = c.randMPI(b)
-	s.r2, err3 = c.randMPI(b)
-	s.r3, err4 = c.randMPI(b)
-	s.r4, err5 = c.randMPI(b)
-	s.r5, err6 = c.randMPI(b)
-	s.r6, err7 = c.randMPI(b)
+	s.b2, err1 = sm.randMPI(b)
+	s.b3, err2 = sm.randMPI(b)
+	s.r2, err3 = sm.randMPI(b)
+	s.r3, err4 = sm.randMPI(b)
+	s.r4, err5 = sm.randMPI(b)
+	s.r5, err6 = sm.randMPI(b)
+	s.r6, err7 = sm.randMPI(b)
 
 	return s, firstError(err1, err2, err3, err4, err5, err6, err7)
 }
 
-func generateSMP2Message(s *smp2State, s1 smp1Message, v otrVersion) smp2Message {
+func generateSMP2Message(s *smp2State, s1 smp1Message, v smpParameters) smp2Message {
 	var m smp2Message
 
 	m.g2b = modExp(g1, s.b2)
@@ -62,51 +62,51 @@ func generateSMP2Message(s *smp2State, s1 smp1Message, v otrVersion) smp2Message
 		modExp(s.g3, s.r5),
 		mulMod(modExp(g1, s.r5), modExp(s.g2, s.r6), p))
 
-	m.d5 = subMod(s.r5, mul(s.r4, m.cp), q)
-	m.d6 = subMod(s.r6, mul(s.y, m.cp), q)
+	m.d5 = subMod(s.r5, mulMod(s.r4, m.cp, q), q)
+	m.d6 = subMod(s.r6, mulMod(s.y, m.cp, q), q)
 
 	return m
 }
 
-func (c *Conversation) generateSMP2(secret *big.Int, s1 smp1Message) (s smp2State, err error) {
-	if s, err = c.generateSMP2Parameters(); err != nil {
+func (sm *SMP) generateSMP2(secret *big.Int, s1 smp1Message) (s smp2State, err error) {
+	if s, err = sm.generateSMP2Parameters(); err != nil {
 		return s, err
 	}
 
 	s.y = secret
-	s.msg = generateSMP2Message(&s, s1, c.version)
+	s.msg = generateSMP2Message(&s, s1, sm.params)
 	return
 }
 
-func (c *Conversation) verifySMP2(s1 *smp1State, msg smp2Message) error {
-	if !c.version.isGroupElement(msg.g2b) {
+func (sm *SMP) verifySMP2(s1 *smp1State, msg smp2Message) error {
+	if !sm.params.isGroupElement(msg.g2b) {
 		return newOtrError("g2b is an invalid group element")
 	}
 
-	if !c.version.isGroupElement(msg.g3b) {
+	if !sm.params.isGroupElement(msg.g3b) {
 		return newOtrError("g3b is an invalid group element")
 	}
 
-	if !c.version.isGroupElement(msg.pb) {
+	if !sm.params.isGroupElement(msg.pb) {
 		return newOtrError("Pb is an invalid group element")
 	}
 
-	if !c.version.isGroupElement(msg.qb) {
+	if !sm.params.isGroupElement(msg.qb) {
 		return newOtrError("Qb is an invalid group element")
 	}
 
-	if !verifyZKP(msg.d2, msg.g2b, msg.c2, 3, c.version) {
+	if !verifyZKP(msg.d2, msg.g2b, msg.c2, 3, sm.params) {
 		return newOtrError("c2 is not a valid zero knowledge proof")
 	}
 
-	if !verifyZKP(msg.d3, msg.g3b, msg.c3, 4, c.version) {
+	if !verifyZKP(msg.d3, msg.g3b, msg.c3, 4, sm.params) {
 		return newOtrError("c3 is not a valid zero knowledge proof")
 	}
 
 	g2 := modExp(msg.g2b, s1.a2)
 	g3 := modExp(msg.g3b, s1.a3)
 
-	if !verifyZKP2(g2, g3, msg.d5, msg.d6, msg.pb, msg.qb, msg.cp, 5, c.version) {
+	if !verifyZKP2(g2, g3, msg.d5, msg.d6, msg.pb, msg.qb, msg.cp, 5, sm.params) {
 		return newOtrError("cP is not a valid zero knowledge proof")
 	}
 
@@ -22,19 +22,19 @@ func (m smp3Message) tlv() tlv {
 	return genSMPTLV(uint16(tlvTypeSMP3), m.pa, m.qa, m.cp, m.d5, m.d6, m.ra, m.cr, m.d7)
 }
 
-func (c *Conversation) generateSMP3Parameters() (s smp3State, err error) {
-	b := make([]byte, c.version.parameterLength())
+func (sm *SMP) generateSMP3Parameters() (s smp3State, err error) {
+	b := make([]byte, sm.params.parameterLength())
 	var err1, err2, err3, err4 error
 
-	s.r4, err1 = c.randMPI(b)
-	s.r5, err2 = c.randMPI(b)
-	s.r6, err3 = c.randMPI(b)
-	s.r7, err4 = c.randMPI(b)
+	s.r4, err1 = sm.randMPI(b)
+	s.r5, err2 = sm.randMPI(b)
+	s.r6, err3 = sm.randMPI(b)
+	s.r7, err4 = sm.randMPI(b)
 
 	return s, firstError(err1, err2, err3, err4)
 }
 
-func generateSMP3Message(s *smp3State, s1 smp1State, m2 smp2Message, v otrVersion) smp3Message {
+func generateSMP3Message(s *smp3State, s1 smp1State, m2 smp2Message, v smpParameters) smp3Message {
 	var m smp3Message
 
 	g2 := modExp(m2.g2b, s1.a2)
@@ -54,47 +54,47 @@ func generateSMP3Message(s *smp3State, s1 smp1State, m2 smp2Message, v otrVersio
 	m.ra = modExp(s.qaqb, s1.a3)
 
 	m.cr = hashMPIsBN(v.hash2Instance(), 7, modExp(g1, s.r7), modExp(s.qaqb, s.r7))
-	m.d7 = subMod(s.r7, mul(s1.a3, m.cr), q)
+	m.d7 = subMod(s.r7, mulMod(s1.a3, m.cr, q), q)
 
 	return m
 }
 
-func (c *Conversation) generateSMP3(secret *big.Int, s1 smp1State, m2 smp2Message) (s smp3State, err error) {
-	if s, err = c.generateSMP3Parameters(); err != nil {
+func (sm *SMP) generateSMP3(secret *big.Int, s1 smp1State, m2 smp2Message) (s smp3State, err error) {
+	if s, err = sm.generateSMP3Parameters(); err != nil {
 		return s, err
 	}
 	s.x = secret
-	s.msg = generateSMP3Message(&s, s1, m2, c.version)
+	s.msg = generateSMP3Message(&s, s1, m2, sm.params)
 	return
 }
 
-func (c *Conversation) verifySMP3(s2 *smp2State, msg smp3Message) error {
-	if !c.version.isGroupElement(msg.pa) {
+func (sm *SMP) verifySMP3(s2 *smp2State, msg smp3Message) error {
+	if !sm.params.isGroupElement(msg.pa) {
 		return newOtrError("Pa is an invalid group element")
 	}
 
-	if !c.version.isGroupElement(msg.qa) {
+	if !sm.params.isGroupElement(msg.qa) {
 		return newOtrError("Qa is an invalid group element")
 	}
 
-	if !c.version.isGroupElement(msg.ra) {
+	if !sm.params.isGroupElement(msg.ra) {
 		return newOtrError("Ra is an invalid group element")
 	}
 
-	if !verifyZKP3(msg.cp, s2.g2, s2.g3, msg.d5, msg.d6, msg.pa, msg.qa, 6, c.version) {
+	if !verifyZKP3(msg.cp, s2.g2, s2.g3, msg.d5, msg.d6, msg.pa, msg.qa, 6, sm.params) {
 		return newOtrError("cP is not a valid zero knowledge proof")
 	}
 
 	qaqb := divMod(msg.qa, s2.qb, p)
 
-	if !verifyZKP4(msg.cr, s2.g3a, msg.d7, qaqb, msg.ra, 7, c.version) {
+	if !verifyZKP4(msg.cr, s2.g3a, msg.d7, qaqb, msg.ra, 7, sm.params) {
 		return newOtrError("cR is not a valid zero knowledge proof")
 	}
 
 	return nil
 }
 
-func (c *Conversation) verifySMP3ProtocolSuccess(s2 *smp2State, msg smp3Message) error {
+func (sm *SMP) verifySMP3ProtocolSuccess(s2 *smp2State, msg smp3Message) error {
 	papb := divMod(msg.pa, s2.pb, p)
 
 	rab := modExp(msg.ra, s2.b3)
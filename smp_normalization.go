@@ -0,0 +1,170 @@
+package otr3
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/coyim/gotrax"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SecretNormalization is a set of rules used to normalize the SMP secret before it is used, so that secrets typed
+// differently by both users can still match. The rules chosen by the user starting the authentication are offered to the
+// peer together with the first SMP message, and are only applied if the peer acknowledges them in its reply. Otherwise, for
+// example with libotr or an older version of this library, both sides use the secret as it was typed.
+type SecretNormalization uint32
+
+const (
+	// NormalizeUnicode applies Unicode normalization form KC, so that equivalent ways of writing the same characters match
+	NormalizeUnicode SecretNormalization = 1 << iota
+	// NormalizeCaseFold makes the secret case insensitive
+	NormalizeCaseFold
+	// NormalizeTrimSpace removes white space at the start and end of the secret
+	NormalizeTrimSpace
+	// NormalizeCollapseSpace replaces every sequence of white space in the secret with a single space
+	NormalizeCollapseSpace
+
+	// NormalizeAll applies all the normalization rules
+	NormalizeAll = NormalizeUnicode | NormalizeCaseFold | NormalizeTrimSpace | NormalizeCollapseSpace
+)
+
+// SetSMPSecretNormalization sets the normalization applied to the secret in the authentications we start. The default is no normalization.
+func (c *Conversation) SetSMPSecretNormalization(n SecretNormalization) {
+	c.smp.ourNormalization = n
+}
+
+// SMPSecretNormalization returns the normalization that will be applied to the secret in the current authentication
+// started by the peer, so the user can be told about it. It is zero if the peer didn't offer any, or offered rules this
+// conversation can't apply.
+func (c *Conversation) SMPSecretNormalization() SecretNormalization {
+	return c.smp.normalization
+}
+
+// canNormalize returns true if all the rules in n can be applied
+func canNormalize(n SecretNormalization) bool {
+	return n&^NormalizeAll == 0
+}
+
+func normalizeSecret(n SecretNormalization, secret []byte) []byte {
+	if n&NormalizeUnicode != 0 {
+		secret = norm.NFKC.Bytes(secret)
+	}
+
+	if n&NormalizeCaseFold != 0 {
+		secret = bytes.Map(foldRune, secret)
+	}
+
+	if n&NormalizeTrimSpace != 0 {
+		secret = bytes.TrimSpace(secret)
+	}
+
+	if n&NormalizeCollapseSpace != 0 {
+		secret = collapseSpace(secret)
+	}
+
+	return secret
+}
+
+// foldRune returns the smallest rune that is equivalent to r under simple Unicode case folding
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+func collapseSpace(secret []byte) []byte {
+	result := make([]byte, 0, len(secret))
+	inSpace := false
+	for len(secret) > 0 {
+		r, size := utf8.DecodeRune(secret)
+		if unicode.IsSpace(r) {
+			if !inSpace {
+				result = append(result, ' ')
+			}
+			inSpace = true
+		} else {
+			result = append(result, secret[:size]...)
+			inSpace = false
+		}
+		secret = secret[size:]
+	}
+	return result
+}
+
+func normalizationTLV(tlvType uint16, n SecretNormalization) tlv {
+	value := gotrax.AppendWord(nil, uint32(n))
+	return tlv{
+		tlvType:   tlvType,
+		tlvLength: uint16(len(value)),
+		tlvValue:  value,
+	}
+}
+
+// withNormalizationTLV puts the TLV of the given type right before the first message of the SMP message type given,
+// so the peer knows about the normalization when that message is processed
+func withNormalizationTLV(tlvs []tlv, tlvType uint16, before []uint16, n SecretNormalization) []tlv {
+	result := make([]tlv, 0, len(tlvs)+1)
+	for _, t := range tlvs {
+		for _, b := range before {
+			if t.tlvType == b {
+				result = append(result, normalizationTLV(tlvType, n))
+			}
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// offerNormalization keeps the normalized secret, to be used instead of the secret as it was typed if the peer
+// acknowledges the normalization
+func (c *Conversation) offerNormalization(tlvs []tlv, normalizedSecret []byte) []tlv {
+	c.smp.offeredNormalization = c.smp.ourNormalization
+	c.smp.normalizedSecret = makeCopy(normalizedSecret)
+	return withNormalizationTLV(tlvs, tlvTypeSMPNormalization, []uint16{tlvTypeSMP1, tlvTypeSMP1WithQuestion}, c.smp.ourNormalization)
+}
+
+// acceptNormalization lets the peer know we applied the normalization it offered
+func (c *Conversation) acceptNormalization(tlvs []tlv) []tlv {
+	return withNormalizationTLV(tlvs, tlvTypeSMPNormalizationAck, []uint16{tlvTypeSMP2}, c.smp.normalization)
+}
+
+func extractNormalization(t tlv) (SecretNormalization, error) {
+	_, n, ok := gotrax.ExtractWord(t.tlvValue)
+	if !ok {
+		return 0, newOtrError("corrupt data message")
+	}
+	return SecretNormalization(n), nil
+}
+
+func (c *Conversation) processSMPNormalizationTLV(t tlv, x dataMessageExtra) (*tlv, error) {
+	n, err := extractNormalization(t)
+	if err != nil {
+		return nil, err
+	}
+
+	c.smp.nextNormalization = n
+	return nil, nil
+}
+
+// processSMPNormalizationAckTLV switches to the normalized secret when the peer has applied the normalization we offered.
+// Our secret is only used after the second SMP message has arrived, so it isn't too late to change it.
+func (c *Conversation) processSMPNormalizationAckTLV(t tlv, x dataMessageExtra) (*tlv, error) {
+	n, err := extractNormalization(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, expect2 := c.smp.state.(smpStateExpect2); !expect2 || c.smp.normalizedSecret == nil || n != c.smp.offeredNormalization {
+		return nil, nil
+	}
+
+	sm := c.smpEngine()
+	sm.setSecret(generateSMPSecret(sm.ourFingerprint, sm.theirFingerprint, sm.sessionID, c.smp.normalizedSecret, sm.params))
+	c.smp.forgetNormalizedSecret()
+	return nil, nil
+}
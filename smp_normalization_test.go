@@ -0,0 +1,117 @@
+package otr3
+
+import "testing"
+
+func fixtureSMPWithSecrets(t *testing.T, alice, bob *Conversation, aliceSecret, bobSecret string) SMPEvent {
+	alice.SetHeartbeatInterval(-1)
+	bob.SetHeartbeatInterval(-1)
+
+	// On failure only the peer finds out, and sends an abort instead of the last SMP message
+	var result SMPEvent = -1
+	recordResult := dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		if event == SMPEventSuccess || event == SMPEventFailure {
+			result = event
+		}
+	}}
+	alice.smpEventHandler = recordResult
+	bob.smpEventHandler = recordResult
+
+	toSend, err := alice.StartAuthenticate("", []byte(aliceSecret))
+	assertNil(t, err)
+	bob.Receive(toSend[0])
+	toSend, err = bob.ProvideAuthenticationSecret([]byte(bobSecret))
+	assertNil(t, err)
+	_, toSend, _ = alice.Receive(toSend[0])
+	_, toSend, _ = bob.Receive(toSend[0])
+	alice.Receive(toSend[0])
+
+	return result
+}
+
+func Test_SMPSecretNormalization_letsSecretsTypedDifferentlyMatch(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetSMPSecretNormalization(NormalizeCaseFold | NormalizeTrimSpace | NormalizeCollapseSpace)
+
+	assertEquals(t, fixtureSMPWithSecrets(t, alice, bob, "Paris  France", " paris france "), SMPEventSuccess)
+}
+
+func Test_SMPSecretNormalization_isNotAppliedByDefault(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+
+	assertEquals(t, fixtureSMPWithSecrets(t, alice, bob, "Paris", "paris"), SMPEventFailure)
+}
+
+func Test_SMPSecretNormalization_isOnlyAppliedToTheExchangeItWasSentWith(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetSMPSecretNormalization(NormalizeCaseFold)
+	assertEquals(t, fixtureSMPWithSecrets(t, alice, bob, "Paris", "paris"), SMPEventSuccess)
+	assertEquals(t, bob.SMPSecretNormalization(), SecretNormalization(0))
+
+	alice.SetSMPSecretNormalization(0)
+	assertEquals(t, fixtureSMPWithSecrets(t, alice, bob, "Paris", "paris"), SMPEventFailure)
+}
+
+func Test_SMPSecretNormalization_appliesUnicodeNormalization(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetSMPSecretNormalization(NormalizeUnicode)
+
+	assertEquals(t, fixtureSMPWithSecrets(t, alice, bob, "Pa\u0302ris", "P\u00e2ris"), SMPEventSuccess)
+}
+
+func Test_SMPSecretNormalization_isNotAppliedWhenThePeerDoesntAcknowledgeIt(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetHeartbeatInterval(-1)
+	bob.SetHeartbeatInterval(-1)
+	alice.SetSMPSecretNormalization(NormalizeCaseFold)
+
+	var result SMPEvent = -1
+	bob.smpEventHandler = dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		if event == SMPEventSuccess || event == SMPEventFailure {
+			result = event
+		}
+	}}
+
+	toSend, _ := alice.StartAuthenticate("", []byte("Paris"))
+	bob.Receive(toSend[0])
+	// Like a peer that doesn't understand the normalization TLV, and hashes the secret as it was typed
+	bob.smp.normalization = 0
+	toSend, _ = bob.ProvideAuthenticationSecret([]byte("Paris"))
+	_, toSend, _ = alice.Receive(toSend[0])
+	bob.Receive(toSend[0])
+
+	assertEquals(t, result, SMPEventSuccess)
+	assertNil(t, alice.smp.normalizedSecret)
+}
+
+func Test_SMPSecretNormalization_isRefusedWhenThePeerOffersUnknownRules(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetSMPSecretNormalization(NormalizeCaseFold | 1<<31)
+
+	assertEquals(t, fixtureSMPWithSecrets(t, alice, bob, "Paris", "Paris"), SMPEventSuccess)
+	assertEquals(t, fixtureSMPWithSecrets(t, alice, bob, "Paris", "paris"), SMPEventFailure)
+}
+
+func Test_normalizeSecret_appliesTheRulesGiven(t *testing.T) {
+	s := normalizeSecret(NormalizeCaseFold, []byte("ÀbC"))
+	assertEquals(t, string(s), "ÀBC")
+
+	s = normalizeSecret(NormalizeTrimSpace, []byte(" \ta  b\n"))
+	assertEquals(t, string(s), "a  b")
+
+	s = normalizeSecret(NormalizeCollapseSpace, []byte("a \t b"))
+	assertEquals(t, string(s), "a b")
+
+	s = normalizeSecret(NormalizeUnicode, []byte("\ufb01 A\u030a"))
+	assertEquals(t, string(s), "fi \u00c5")
+
+	s = normalizeSecret(0, []byte(" A "))
+	assertEquals(t, string(s), " A ")
+}
+
+func Test_withNormalizationTLV_putsTheTLVBeforeTheFirstSMPMessage(t *testing.T) {
+	tlvs := withNormalizationTLV([]tlv{smpMessageAbort{}.tlv(), tlv{tlvType: tlvTypeSMP1}}, tlvTypeSMPNormalization, []uint16{tlvTypeSMP1, tlvTypeSMP1WithQuestion}, NormalizeCaseFold)
+
+	assertEquals(t, len(tlvs), 3)
+	assertEquals(t, tlvs[1].tlvType, tlvTypeSMPNormalization)
+	assertEquals(t, tlvs[2].tlvType, tlvTypeSMP1)
+}
@@ -13,43 +13,43 @@ func TestFullSMPHandshake(t *testing.T) {
 	// Alice -> Bob
 	// Stores: x, a2, and a3
 	// Sends: g2a, c2, D2, g3a, c3 and D3
-	s1, _ := alice.generateSMP1()
+	s1, _ := alice.smpEngine().generateSMP1()
 
 	//Bob
-	err := bob.verifySMP1(s1.msg)
+	err := bob.smpEngine().verifySMP1(s1.msg)
 	assertDeepEquals(t, err, nil)
 
 	// Bob -> Alice
 	// Stores: g3a, g2, g3, b3, Pb and Qb
 	// Sends: g2b, c2, D2, g3b, c3, D3, Pb, Qb, cP, D5 and D6
-	s2, _ := bob.generateSMP2(secret, s1.msg)
+	s2, _ := bob.smpEngine().generateSMP2(secret, s1.msg)
 
 	// Alice
-	err = alice.verifySMP2(&s1, s2.msg)
+	err = alice.smpEngine().verifySMP2(&s1, s2.msg)
 	assertDeepEquals(t, err, nil)
 
 	// Alice -> Bob
 	// Stores: g3b, (Pa / Pb), (Qa / Qb) and Ra
 	// Sends: Pa, Qa, cP, D5, D6, Ra, cR and D7
-	s3, _ := alice.generateSMP3(secret, s1, s2.msg)
+	s3, _ := alice.smpEngine().generateSMP3(secret, s1, s2.msg)
 
 	// Bob
-	err = bob.verifySMP3(&s2, s3.msg)
+	err = bob.smpEngine().verifySMP3(&s2, s3.msg)
 	assertDeepEquals(t, err, nil)
 
-	err = bob.verifySMP3ProtocolSuccess(&s2, s3.msg)
+	err = bob.smpEngine().verifySMP3ProtocolSuccess(&s2, s3.msg)
 	assertDeepEquals(t, err, nil)
 
 	// Bob -> Alice
 	// Stores: ???
 	// Sends: Rb, cR and D7
-	s4, _ := bob.generateSMP4(secret, s2, s3.msg)
+	s4, _ := bob.smpEngine().generateSMP4(secret, s2, s3.msg)
 
 	// Alice
-	err = alice.verifySMP4(&s3, s4.msg)
+	err = alice.smpEngine().verifySMP4(&s3, s4.msg)
 	assertDeepEquals(t, err, nil)
 
-	err = alice.verifySMP4ProtocolSuccess(&s1, &s3, s4.msg)
+	err = alice.smpEngine().verifySMP4ProtocolSuccess(&s1, &s3, s4.msg)
 	assertDeepEquals(t, err, nil)
 }
 
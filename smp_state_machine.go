@@ -11,24 +11,24 @@ type smpStateWaitingForSecret struct {
 }
 
 type smpMessage interface {
-	receivedMessage(*Conversation) (smpMessage, error)
+	receivedMessage(*SMP) (smpMessage, error)
 	tlv() tlv
 }
 
 type smpState interface {
-	startAuthenticate(*Conversation, string, []byte) ([]tlv, error)
-	receiveMessage1(*Conversation, smp1Message) (smpState, smpMessage, error)
-	continueMessage1(*Conversation, []byte) (smpState, smpMessage, error)
-	receiveMessage2(*Conversation, smp2Message) (smpState, smpMessage, error)
-	receiveMessage3(*Conversation, smp3Message) (smpState, smpMessage, error)
-	receiveMessage4(*Conversation, smp4Message) (smpState, smpMessage, error)
+	startAuthenticate(*SMP, string, []byte) ([]tlv, error)
+	receiveMessage1(*SMP, smp1Message) (smpState, smpMessage, error)
+	continueMessage1(*SMP, []byte) (smpState, smpMessage, error)
+	receiveMessage2(*SMP, smp2Message) (smpState, smpMessage, error)
+	receiveMessage3(*SMP, smp3Message) (smpState, smpMessage, error)
+	receiveMessage4(*SMP, smp4Message) (smpState, smpMessage, error)
 	identity() int
 	identityString() string
 }
 
-func (c *Conversation) restartSMP() tlv {
+func (sm *SMP) restartSMP() tlv {
 	var ret smpMessage
-	c.smp.state, ret, _ = sendSMPAbortAndRestartStateMachine()
+	sm.state, ret, _ = sendSMPAbortAndRestartStateMachine()
 	return ret.tlv()
 }
 
@@ -41,13 +41,13 @@ func sendSMPAbortAndRestartStateMachine() (smpState, smpMessage, error) {
 	return abortState(nil)
 }
 
-func (c *Conversation) abortStateMachineAndNotifyCheated() (smpState, smpMessage, error) {
-	c.smpEvent(SMPEventCheated, 0)
+func (sm *SMP) abortStateMachineAndNotifyCheated() (smpState, smpMessage, error) {
+	sm.smpEvent(SMPEventCheated, 0)
 	return sendSMPAbortAndRestartStateMachine()
 }
 
-func (c *Conversation) receiveSMP(m smpMessage) (*tlv, error) {
-	toSend, err := m.receivedMessage(c)
+func (sm *SMP) receiveSMP(m smpMessage) (*tlv, error) {
+	toSend, err := m.receivedMessage(sm)
 
 	if err != nil {
 		return nil, err
@@ -62,8 +62,8 @@ func (c *Conversation) receiveSMP(m smpMessage) (*tlv, error) {
 	return &result, nil
 }
 
-func (c *Conversation) continueSMP(mutualSecret []byte) (*tlv, error) {
-	toSend, err := c.continueMessage(mutualSecret)
+func (sm *SMP) continueSMP(mutualSecret []byte) (*tlv, error) {
+	toSend, err := sm.continueMessage(mutualSecret)
 
 	if err != nil {
 		return nil, err
@@ -74,149 +74,144 @@ func (c *Conversation) continueSMP(mutualSecret []byte) (*tlv, error) {
 	return &result, nil
 }
 
-func abortStateMachineAndNotifyError(c *Conversation) (smpState, smpMessage, error) {
-	c.smpEvent(SMPEventError, 0)
+func abortStateMachineAndNotifyError(sm *SMP) (smpState, smpMessage, error) {
+	sm.smpEvent(SMPEventError, 0)
 	return sendSMPAbortAndRestartStateMachine()
 }
 
-func (smpStateBase) receiveMessage1(c *Conversation, m smp1Message) (smpState, smpMessage, error) {
-	return abortStateMachineAndNotifyError(c)
+func (smpStateBase) receiveMessage1(sm *SMP, m smp1Message) (smpState, smpMessage, error) {
+	return abortStateMachineAndNotifyError(sm)
 }
 
-func (smpStateBase) continueMessage1(c *Conversation, mutualSecret []byte) (smpState, smpMessage, error) {
+func (smpStateBase) continueMessage1(sm *SMP, mutualSecret []byte) (smpState, smpMessage, error) {
 	return abortState(errNotWaitingForSMPSecret)
 }
 
-func (smpStateBase) receiveMessage2(c *Conversation, m smp2Message) (smpState, smpMessage, error) {
-	return abortStateMachineAndNotifyError(c)
+func (smpStateBase) receiveMessage2(sm *SMP, m smp2Message) (smpState, smpMessage, error) {
+	return abortStateMachineAndNotifyError(sm)
 }
 
-func (smpStateBase) receiveMessage3(c *Conversation, m smp3Message) (smpState, smpMessage, error) {
-	return abortStateMachineAndNotifyError(c)
+func (smpStateBase) receiveMessage3(sm *SMP, m smp3Message) (smpState, smpMessage, error) {
+	return abortStateMachineAndNotifyError(sm)
 }
 
-func (smpStateBase) receiveMessage4(c *Conversation, m smp4Message) (smpState, smpMessage, error) {
-	return abortStateMachineAndNotifyError(c)
+func (smpStateBase) receiveMessage4(sm *SMP, m smp4Message) (smpState, smpMessage, error) {
+	return abortStateMachineAndNotifyError(sm)
 }
 
-func (smpStateExpect1) receiveMessage1(c *Conversation, m smp1Message) (smpState, smpMessage, error) {
-	err := c.verifySMP1(m)
+func (smpStateExpect1) receiveMessage1(sm *SMP, m smp1Message) (smpState, smpMessage, error) {
+	err := sm.verifySMP1(m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return sm.abortStateMachineAndNotifyCheated()
 	}
 
 	if m.hasQuestion {
-		c.smp.question = &m.question
-		c.smpEventWithQuestion(SMPEventAskForAnswer, 25, m.question)
+		sm.question = &m.question
+		sm.smpEventWithQuestion(SMPEventAskForAnswer, 25, m.question)
 	} else {
-		c.smpEvent(SMPEventAskForSecret, 25)
+		sm.smpEvent(SMPEventAskForSecret, 25)
 	}
 
 	return smpStateWaitingForSecret{msg: m}, nil, nil
 }
 
-func (s smpStateWaitingForSecret) continueMessage1(c *Conversation, mutualSecret []byte) (smpState, smpMessage, error) {
-	if !c.IsEncrypted() {
-		return abortState(errCantAuthenticateWithoutEncryption)
-	}
-
-	// Using ssid here should always be safe - we can't be in an encrypted state without having gone through the AKE
-	c.smp.secret = generateSMPSecret(c.theirKey.Fingerprint(), c.ourCurrentKey.PublicKey().Fingerprint(), c.ssid[:], mutualSecret, c.version)
-	s2, err := c.generateSMP2(c.smp.secret, s.msg)
+func (s smpStateWaitingForSecret) continueMessage1(sm *SMP, mutualSecret []byte) (smpState, smpMessage, error) {
+	sm.setSecret(generateSMPSecret(sm.theirFingerprint, sm.ourFingerprint, sm.sessionID, mutualSecret, sm.params))
+	s2, err := sm.generateSMP2(sm.secret, s.msg)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return sm.abortStateMachineAndNotifyCheated()
 	}
 
-	c.smp.s2 = &s2
+	sm.s2 = &s2
 
 	return smpStateExpect3{}, s2.msg, nil
 }
 
-func (smpStateExpect2) receiveMessage2(c *Conversation, m smp2Message) (smpState, smpMessage, error) {
-	err := c.verifySMP2(c.smp.s1, m)
+func (smpStateExpect2) receiveMessage2(sm *SMP, m smp2Message) (smpState, smpMessage, error) {
+	err := sm.verifySMP2(sm.s1, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return sm.abortStateMachineAndNotifyCheated()
 	}
 
-	s3, err := c.generateSMP3(c.smp.secret, *c.smp.s1, m)
+	s3, err := sm.generateSMP3(sm.secret, *sm.s1, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return sm.abortStateMachineAndNotifyCheated()
 	}
 
-	c.smpEvent(SMPEventInProgress, 60)
+	sm.smpEvent(SMPEventInProgress, 60)
 
-	c.smp.s3 = &s3
+	sm.s3 = &s3
 
 	return smpStateExpect4{}, s3.msg, nil
 }
 
-func (smpStateExpect3) receiveMessage3(c *Conversation, m smp3Message) (smpState, smpMessage, error) {
-	err := c.verifySMP3(c.smp.s2, m)
+func (smpStateExpect3) receiveMessage3(sm *SMP, m smp3Message) (smpState, smpMessage, error) {
+	err := sm.verifySMP3(sm.s2, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return sm.abortStateMachineAndNotifyCheated()
 	}
 
-	err = c.verifySMP3ProtocolSuccess(c.smp.s2, m)
+	err = sm.verifySMP3ProtocolSuccess(sm.s2, m)
 	if err != nil {
-		c.smpEvent(SMPEventFailure, 100)
+		sm.smpEvent(SMPEventFailure, 100)
 		return sendSMPAbortAndRestartStateMachine()
 	}
-	c.smpEvent(SMPEventSuccess, 100)
+	sm.smpEvent(SMPEventSuccess, 100)
 
-	ret, err := c.generateSMP4(c.smp.secret, *c.smp.s2, m)
+	ret, err := sm.generateSMP4(sm.secret, *sm.s2, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return sm.abortStateMachineAndNotifyCheated()
 	}
 
-	c.smp.wipe()
+	sm.wipe()
 	return smpStateExpect1{}, ret.msg, nil
 }
 
-func (smpStateExpect4) receiveMessage4(c *Conversation, m smp4Message) (smpState, smpMessage, error) {
-	err := c.verifySMP4(c.smp.s3, m)
+func (smpStateExpect4) receiveMessage4(sm *SMP, m smp4Message) (smpState, smpMessage, error) {
+	err := sm.verifySMP4(sm.s3, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return sm.abortStateMachineAndNotifyCheated()
 	}
 
-	err = c.verifySMP4ProtocolSuccess(c.smp.s1, c.smp.s3, m)
+	err = sm.verifySMP4ProtocolSuccess(sm.s1, sm.s3, m)
 	if err != nil {
-		c.smpEvent(SMPEventFailure, 100)
+		sm.smpEvent(SMPEventFailure, 100)
 		return sendSMPAbortAndRestartStateMachine()
 	}
-	c.smpEvent(SMPEventSuccess, 100)
+	sm.smpEvent(SMPEventSuccess, 100)
 
-	c.smp.wipe()
+	sm.wipe()
 	return smpStateExpect1{}, nil, nil
 }
 
-func (m smp1Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.receiveMessage1(c, m)
+func (m smp1Message) receivedMessage(sm *SMP) (ret smpMessage, err error) {
+	sm.state, ret, err = sm.state.receiveMessage1(sm, m)
 	return
 }
 
-func (m smp2Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.receiveMessage2(c, m)
+func (m smp2Message) receivedMessage(sm *SMP) (ret smpMessage, err error) {
+	sm.state, ret, err = sm.state.receiveMessage2(sm, m)
 	return
 }
 
-func (m smp3Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.receiveMessage3(c, m)
+func (m smp3Message) receivedMessage(sm *SMP) (ret smpMessage, err error) {
+	sm.state, ret, err = sm.state.receiveMessage3(sm, m)
 	return
 }
 
-func (m smp4Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.receiveMessage4(c, m)
+func (m smp4Message) receivedMessage(sm *SMP) (ret smpMessage, err error) {
+	sm.state, ret, err = sm.state.receiveMessage4(sm, m)
 	return
 }
 
-func (m smpMessageAbort) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state = smpStateExpect1{}
-	c.smpEvent(SMPEventAbort, 0)
+func (m smpMessageAbort) receivedMessage(sm *SMP) (ret smpMessage, err error) {
+	sm.state = smpStateExpect1{}
+	sm.smpEvent(SMPEventAbort, 0)
 	return
 }
 
-func (c *Conversation) continueMessage(mutualSecret []byte) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.continueMessage1(c, mutualSecret)
+func (sm *SMP) continueMessage(mutualSecret []byte) (ret smpMessage, err error) {
+	sm.state, ret, err = sm.state.continueMessage1(sm, mutualSecret)
 	return
 }
 
@@ -226,21 +221,16 @@ func (smpStateExpect3) String() string          { return "SMPSTATE_EXPECT3" }
 func (smpStateExpect4) String() string          { return "SMPSTATE_EXPECT4" }
 func (smpStateWaitingForSecret) String() string { return "SMPSTATE_WAITINGFORSECRET (internal)" }
 
-func (smpStateBase) startAuthenticate(c *Conversation, question string, mutualSecret []byte) (tlvs []tlv, err error) {
-	tlvs, err = smpStateExpect1{}.startAuthenticate(c, question, mutualSecret)
+func (smpStateBase) startAuthenticate(sm *SMP, question string, mutualSecret []byte) (tlvs []tlv, err error) {
+	tlvs, err = smpStateExpect1{}.startAuthenticate(sm, question, mutualSecret)
 	tlvs = append([]tlv{smpMessageAbort{}.tlv()}, tlvs...)
 	return
 }
 
-func (smpStateExpect1) startAuthenticate(c *Conversation, question string, mutualSecret []byte) (tlvs []tlv, err error) {
-	if !c.IsEncrypted() {
-		return nil, errCantAuthenticateWithoutEncryption
-	}
-
-	// Using ssid here should always be safe - we can't be in an encrypted state without having gone through the AKE
-	c.smp.secret = generateSMPSecret(c.ourCurrentKey.PublicKey().Fingerprint(), c.theirKey.Fingerprint(), c.ssid[:], mutualSecret, c.version)
+func (smpStateExpect1) startAuthenticate(sm *SMP, question string, mutualSecret []byte) (tlvs []tlv, err error) {
+	sm.setSecret(generateSMPSecret(sm.ourFingerprint, sm.theirFingerprint, sm.sessionID, mutualSecret, sm.params))
 
-	s1, err := c.generateSMP1()
+	s1, err := sm.generateSMP1()
 	if err != nil {
 		return nil, errShortRandomRead
 	}
@@ -250,8 +240,8 @@ func (smpStateExpect1) startAuthenticate(c *Conversation, question string, mutua
 		s1.msg.question = question
 	}
 
-	c.smp.s1 = &s1
-	c.smp.state = smpStateExpect2{}
+	sm.s1 = &s1
+	sm.state = smpStateExpect2{}
 
 	return []tlv{s1.msg.tlv()}, nil
 }
@@ -8,7 +8,7 @@ import (
 func Test_smpStateExpect1_goToWaitingForSecretWhenReceivesSmpMessage1(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
 	msg := fixtureMessage1()
-	nextState, _, _ := smpStateExpect1{}.receiveMessage1(c, msg)
+	nextState, _, _ := smpStateExpect1{}.receiveMessage1(c.smpEngine(), msg)
 
 	assertDeepEquals(t, nextState, smpStateWaitingForSecret{msg: msg})
 }
@@ -16,7 +16,7 @@ func Test_smpStateExpect1_goToWaitingForSecretWhenReceivesSmpMessage1(t *testing
 func Test_smpStateExpect1_willSendANotificationThatASecretIsNeeded(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
 	c.expectSMPEvent(t, func() {
-		smpStateExpect1{}.receiveMessage1(c, fixtureMessage1())
+		smpStateExpect1{}.receiveMessage1(c.smpEngine(), fixtureMessage1())
 	}, SMPEventAskForSecret, 25, "")
 }
 
@@ -27,7 +27,7 @@ func Test_smpStateExpect1_willSendANotificationThatAnAnswerIsNeededIfQuestionPro
 	msg.question = "What do you think?"
 
 	c.expectSMPEvent(t, func() {
-		smpStateExpect1{}.receiveMessage1(c, msg)
+		smpStateExpect1{}.receiveMessage1(c.smpEngine(), msg)
 	}, SMPEventAskForAnswer, 25, "What do you think?")
 }
 
@@ -40,7 +40,7 @@ func Test_smpStateWaitingForSecret_goToExpectState3WhenReceivesContinueSmpMessag
 	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
 
 	msg := fixtureMessage1()
-	nextState, _, err := smpStateWaitingForSecret{msg: msg}.continueMessage1(c, []byte{})
+	nextState, _, err := smpStateWaitingForSecret{msg: msg}.continueMessage1(c.smpEngine(), []byte{})
 
 	assertNil(t, err)
 	assertNotNil(t, c.smp.s2)
@@ -52,7 +52,7 @@ func Test_smpStateExpect1_receiveMessage1_setsTheSMPQuestionIfThereWasOneInTheMe
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	msg := fixtureMessage1Q()
 
-	smpStateExpect1{}.receiveMessage1(c, msg)
+	smpStateExpect1{}.receiveMessage1(c.smpEngine(), msg)
 	v, ok := c.SMPQuestion()
 
 	assertDeepEquals(t, ok, true)
@@ -62,15 +62,15 @@ func Test_smpStateExpect1_receiveMessage1_setsTheSMPQuestionIfThereWasOneInTheMe
 func Test_smpStateExpect1_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect1{}
 	c := newConversation(otrV3{}, fixtureRand())
-	_, msg, err := state.receiveMessage2(c, smp2Message{})
+	_, msg, err := state.receiveMessage2(c.smpEngine(), smp2Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 
-	_, msg, err = state.receiveMessage3(c, smp3Message{})
+	_, msg, err = state.receiveMessage3(c.smpEngine(), smp3Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 
-	_, msg, err = state.receiveMessage4(c, smp4Message{})
+	_, msg, err = state.receiveMessage4(c.smpEngine(), smp4Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 }
@@ -80,15 +80,15 @@ func Test_smpStateExpect1_givesAnErrorNotificationIfTheWrongMessageIsSent(t *tes
 	c := newConversation(otrV3{}, fixtureRand())
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage2(c, smp2Message{})
+		state.receiveMessage2(c.smpEngine(), smp2Message{})
 	}, SMPEventError, 0, "")
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage3(c, smp3Message{})
+		state.receiveMessage3(c.smpEngine(), smp3Message{})
 	}, SMPEventError, 0, "")
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage4(c, smp4Message{})
+		state.receiveMessage4(c.smpEngine(), smp4Message{})
 	}, SMPEventError, 0, "")
 }
 
@@ -97,15 +97,15 @@ func Test_smpStateExpect2_givesAnErrorNotificationIfTheWrongMessageIsSent(t *tes
 	c := newConversation(otrV3{}, fixtureRand())
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage1(c, smp1Message{})
+		state.receiveMessage1(c.smpEngine(), smp1Message{})
 	}, SMPEventError, 0, "")
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage3(c, smp3Message{})
+		state.receiveMessage3(c.smpEngine(), smp3Message{})
 	}, SMPEventError, 0, "")
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage4(c, smp4Message{})
+		state.receiveMessage4(c.smpEngine(), smp4Message{})
 	}, SMPEventError, 0, "")
 }
 
@@ -114,15 +114,15 @@ func Test_smpStateExpect3_givesAnErrorNotificationIfTheWrongMessageIsSent(t *tes
 	c := newConversation(otrV3{}, fixtureRand())
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage1(c, smp1Message{})
+		state.receiveMessage1(c.smpEngine(), smp1Message{})
 	}, SMPEventError, 0, "")
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage2(c, smp2Message{})
+		state.receiveMessage2(c.smpEngine(), smp2Message{})
 	}, SMPEventError, 0, "")
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage4(c, smp4Message{})
+		state.receiveMessage4(c.smpEngine(), smp4Message{})
 	}, SMPEventError, 0, "")
 }
 
@@ -131,15 +131,15 @@ func Test_smpStateExpect4_givesAnErrorNotificationIfTheWrongMessageIsSent(t *tes
 	c := newConversation(otrV3{}, fixtureRand())
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage1(c, smp1Message{})
+		state.receiveMessage1(c.smpEngine(), smp1Message{})
 	}, SMPEventError, 0, "")
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage2(c, smp2Message{})
+		state.receiveMessage2(c.smpEngine(), smp2Message{})
 	}, SMPEventError, 0, "")
 
 	c.expectSMPEvent(t, func() {
-		state.receiveMessage3(c, smp3Message{})
+		state.receiveMessage3(c.smpEngine(), smp3Message{})
 	}, SMPEventError, 0, "")
 }
 
@@ -149,7 +149,7 @@ func Test_smpStateExpect2_goToExpectState4WhenReceivesSmpMessage2(t *testing.T)
 	c.smp.s1 = fixtureSmp1()
 
 	msg := fixtureMessage2()
-	nextState, _, err := smpStateExpect2{}.receiveMessage2(c, msg)
+	nextState, _, err := smpStateExpect2{}.receiveMessage2(c.smpEngine(), msg)
 
 	assertNil(t, err)
 	assertNotNil(t, c.smp.s3)
@@ -162,22 +162,22 @@ func Test_smpStateExpect2_sendsAnSMPEventAboutSMPProgressHere(t *testing.T) {
 	c.smp.s1 = fixtureSmp1()
 
 	c.expectSMPEvent(t, func() {
-		smpStateExpect2{}.receiveMessage2(c, fixtureMessage2())
+		smpStateExpect2{}.receiveMessage2(c.smpEngine(), fixtureMessage2())
 	}, SMPEventInProgress, 60, "")
 }
 
 func Test_smpStateExpect2_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect2{}
 	c := newConversation(otrV3{}, fixtureRand())
-	_, msg, err := state.receiveMessage1(c, smp1Message{})
+	_, msg, err := state.receiveMessage1(c.smpEngine(), smp1Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 
-	_, msg, err = state.receiveMessage3(c, smp3Message{})
+	_, msg, err = state.receiveMessage3(c.smpEngine(), smp3Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 
-	_, msg, err = state.receiveMessage4(c, smp4Message{})
+	_, msg, err = state.receiveMessage4(c.smpEngine(), smp4Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 }
@@ -188,7 +188,7 @@ func Test_smpStateExpect3_goToExpectState1WhenReceivesSmpMessage3(t *testing.T)
 	c.smp.s2 = fixtureSmp2()
 	msg := fixtureMessage3()
 
-	nextState, _, _ := smpStateExpect3{}.receiveMessage3(c, msg)
+	nextState, _, _ := smpStateExpect3{}.receiveMessage3(c.smpEngine(), msg)
 
 	assertEquals(t, nextState, smpStateExpect1{})
 }
@@ -198,7 +198,7 @@ func Test_smpStateExpect3_wipesSMPWhenReceivesSmpMessage3(t *testing.T) {
 	c.smp.s2 = fixtureSmp2()
 	msg := fixtureMessage3()
 
-	nextState, _, _ := smpStateExpect3{}.receiveMessage3(c, msg)
+	nextState, _, _ := smpStateExpect3{}.receiveMessage3(c.smpEngine(), msg)
 
 	assertEquals(t, nextState, smpStateExpect1{})
 	assertNil(t, c.smp.secret)
@@ -213,22 +213,22 @@ func Test_smpStateExpect3_willSendAnSMPNotificationOnProtocolSuccess(t *testing.
 	c.smp.s2 = fixtureSmp2()
 
 	c.expectSMPEvent(t, func() {
-		smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
+		smpStateExpect3{}.receiveMessage3(c.smpEngine(), fixtureMessage3())
 	}, SMPEventSuccess, 100, "")
 }
 
 func Test_smpStateExpect3_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect3{}
 	c := newConversation(otrV3{}, fixtureRand())
-	_, msg, err := state.receiveMessage1(c, smp1Message{})
+	_, msg, err := state.receiveMessage1(c.smpEngine(), smp1Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 
-	_, msg, err = state.receiveMessage2(c, smp2Message{})
+	_, msg, err = state.receiveMessage2(c.smpEngine(), smp2Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 
-	_, msg, err = state.receiveMessage4(c, smp4Message{})
+	_, msg, err = state.receiveMessage4(c.smpEngine(), smp4Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 }
@@ -239,7 +239,7 @@ func Test_smpStateExpect4_goToExpectState1WhenReceivesSmpMessage4(t *testing.T)
 	c.smp.s3 = fixtureSmp3()
 	msg := fixtureMessage4()
 
-	nextState, _, _ := smpStateExpect4{}.receiveMessage4(c, msg)
+	nextState, _, _ := smpStateExpect4{}.receiveMessage4(c.smpEngine(), msg)
 
 	assertEquals(t, nextState, smpStateExpect1{})
 }
@@ -250,7 +250,7 @@ func Test_smpStateExpect4_willSendAnSMPNotificationOnProtocolSuccess(t *testing.
 	c.smp.s3 = fixtureSmp3()
 
 	c.expectSMPEvent(t, func() {
-		smpStateExpect4{}.receiveMessage4(c, fixtureMessage4())
+		smpStateExpect4{}.receiveMessage4(c.smpEngine(), fixtureMessage4())
 	}, SMPEventSuccess, 100, "")
 }
 
@@ -260,7 +260,7 @@ func Test_smpStateExpect4_wipesSMPWhenReceivesSmpMessage4(t *testing.T) {
 	c.smp.s3 = fixtureSmp3()
 	msg := fixtureMessage4()
 
-	nextState, _, _ := smpStateExpect4{}.receiveMessage4(c, msg)
+	nextState, _, _ := smpStateExpect4{}.receiveMessage4(c.smpEngine(), msg)
 
 	assertEquals(t, nextState, smpStateExpect1{})
 	assertNil(t, c.smp.secret)
@@ -272,15 +272,15 @@ func Test_smpStateExpect4_wipesSMPWhenReceivesSmpMessage4(t *testing.T) {
 func Test_smpStateExpect4_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect4{}
 	c := newConversation(otrV3{}, fixtureRand())
-	_, msg, err := state.receiveMessage1(c, smp1Message{})
+	_, msg, err := state.receiveMessage1(c.smpEngine(), smp1Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 
-	_, msg, err = state.receiveMessage2(c, smp2Message{})
+	_, msg, err = state.receiveMessage2(c.smpEngine(), smp2Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 
-	_, msg, err = state.receiveMessage3(c, smp3Message{})
+	_, msg, err = state.receiveMessage3(c.smpEngine(), smp3Message{})
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, msg, smpMessageAbort{})
 }
@@ -290,7 +290,7 @@ func Test_contextTransitionsFromSmpExpect1ToSmpWaitingForSecret(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
-	c.receiveSMP(m)
+	c.smpEngine().receiveSMP(m)
 	assertDeepEquals(t, c.smp.state, smpStateWaitingForSecret{msg: m})
 }
 
@@ -301,7 +301,7 @@ func Test_contextTransitionsFromSmpExpect2ToSmpExpect4(t *testing.T) {
 	c.smp.s1 = fixtureSmp1()
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
-	c.receiveSMP(m)
+	c.smpEngine().receiveSMP(m)
 	assertEquals(t, c.smp.state, smpStateExpect4{})
 }
 
@@ -312,7 +312,7 @@ func Test_contextTransitionsFromSmpExpect3ToSmpExpect1(t *testing.T) {
 	c.smp.s2 = fixtureSmp2()
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
-	c.receiveSMP(m)
+	c.smpEngine().receiveSMP(m)
 	assertEquals(t, c.smp.state, smpStateExpect1{})
 }
 
@@ -323,7 +323,7 @@ func Test_contextTransitionsFromSmpExpect4ToSmpExpect1(t *testing.T) {
 	c.smp.s1 = fixtureSmp1()
 	c.smp.s3 = fixtureSmp3()
 
-	c.receiveSMP(m)
+	c.smpEngine().receiveSMP(m)
 	assertEquals(t, c.smp.state, smpStateExpect1{})
 }
 
@@ -332,7 +332,7 @@ func Test_contextUnexpectedMessageTransitionsToSmpExpected1(t *testing.T) {
 
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.state = smpStateExpect3{}
-	toSend, err := c.receiveSMP(m)
+	toSend, err := c.smpEngine().receiveSMP(m)
 
 	assertNil(t, err)
 	assertEquals(t, c.smp.state, smpStateExpect1{})
@@ -342,7 +342,7 @@ func Test_contextUnexpectedMessageTransitionsToSmpExpected1(t *testing.T) {
 func Test_smpStateExpect1_receiveMessage1_abortsSMPIfVerifySMP1ReturnsError(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
 
-	s, m, err := smpStateExpect1{}.receiveMessage1(c, smp1Message{g2a: big.NewInt(1)})
+	s, m, err := smpStateExpect1{}.receiveMessage1(c.smpEngine(), smp1Message{g2a: big.NewInt(1)})
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -353,7 +353,7 @@ func Test_smpStateExpect1_receiveMessage1_signalsCheatingIfVerifySMP1Fails(t *te
 	c := newConversation(otrV3{}, fixtureRand())
 
 	c.expectSMPEvent(t, func() {
-		smpStateExpect1{}.receiveMessage1(c, smp1Message{g2a: big.NewInt(1)})
+		smpStateExpect1{}.receiveMessage1(c.smpEngine(), smp1Message{g2a: big.NewInt(1)})
 	}, SMPEventCheated, 0, "")
 }
 
@@ -361,7 +361,7 @@ func Test_smp1Message_receivedMessage_abortsSMPIfFailsToVerifyMessage1(t *testin
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.state = smpStateExpect1{}
 	m := smp1Message{g2a: big.NewInt(1)}
-	ret, err := m.receivedMessage(c)
+	ret, err := m.receivedMessage(c.smpEngine())
 
 	assertNil(t, err)
 	assertDeepEquals(t, ret, smpMessageAbort{})
@@ -376,7 +376,7 @@ func Test_smpStateWaitingForSecret_continueMessage1_abortsSMPIfgenerateSMP2Fails
 	c.theirKey = alicePrivateKey.PublicKey()
 	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
 
-	s, m, err := smpStateWaitingForSecret{msg: fixtureMessage1()}.continueMessage1(c, []byte("hello world"))
+	s, m, err := smpStateWaitingForSecret{msg: fixtureMessage1()}.continueMessage1(c.smpEngine(), []byte("hello world"))
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -387,7 +387,7 @@ func Test_smpStateExpect2_receiveMessage2_abortsSMPIfVerifySMPReturnsError(t *te
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.s1 = fixtureSmp1()
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	s, m, err := smpStateExpect2{}.receiveMessage2(c, smp2Message{g2b: big.NewInt(1)})
+	s, m, err := smpStateExpect2{}.receiveMessage2(c.smpEngine(), smp2Message{g2b: big.NewInt(1)})
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -399,7 +399,7 @@ func Test_smp2Message_receivedMessage_abortsSMPIfUnderlyingPrimitiveHasErrors(t
 	c.smp.state = smpStateExpect2{}
 	c.smp.s1 = fixtureSmp1()
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	ret, err := smp2Message{g2b: big.NewInt(1)}.receivedMessage(c)
+	ret, err := smp2Message{g2b: big.NewInt(1)}.receivedMessage(c.smpEngine())
 
 	assertNil(t, err)
 	assertDeepEquals(t, ret, smpMessageAbort{})
@@ -409,7 +409,7 @@ func Test_smpStateExpect2_receiveMessage2_abortsSMPIfgenerateSMPFails(t *testing
 	c := newConversation(otrV3{}, fixedRand([]string{"ABCD"}))
 	c.smp.s1 = fixtureSmp1()
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
-	s, m, err := smpStateExpect2{}.receiveMessage2(c, fixtureMessage2())
+	s, m, err := smpStateExpect2{}.receiveMessage2(c.smpEngine(), fixtureMessage2())
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -420,7 +420,7 @@ func Test_smpStateExpect3_receiveMessage3_abortsSMPIfVerifySMPReturnsError(t *te
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	c.smp.s2 = fixtureSmp2()
-	s, m, err := smpStateExpect3{}.receiveMessage3(c, smp3Message{pa: big.NewInt(1)})
+	s, m, err := smpStateExpect3{}.receiveMessage3(c.smpEngine(), smp3Message{pa: big.NewInt(1)})
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -432,7 +432,7 @@ func Test_smp3Message_receivedMessage_abortsSMPIfUnderlyingPrimitiveDoes(t *test
 	c.smp.state = smpStateExpect3{}
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	c.smp.s2 = fixtureSmp2()
-	ret, err := smp3Message{pa: big.NewInt(1)}.receivedMessage(c)
+	ret, err := smp3Message{pa: big.NewInt(1)}.receivedMessage(c.smpEngine())
 
 	assertNil(t, err)
 	assertDeepEquals(t, ret, smpMessageAbort{})
@@ -443,7 +443,7 @@ func Test_smpStateExpect3_receiveMessage3_abortsSMPIfProtocolFails(t *testing.T)
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	c.smp.s2 = fixtureSmp2()
 	c.smp.s2.b3 = sub(c.smp.s2.b3, big.NewInt(1))
-	s, m, err := smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
+	s, m, err := smpStateExpect3{}.receiveMessage3(c.smpEngine(), fixtureMessage3())
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -457,7 +457,7 @@ func Test_smpStateExpect3_receiveMessage3_willSendAnSMPNotificationOnProtocolFai
 	c.smp.s2.b3 = sub(c.smp.s2.b3, big.NewInt(1))
 
 	c.expectSMPEvent(t, func() {
-		smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
+		smpStateExpect3{}.receiveMessage3(c.smpEngine(), fixtureMessage3())
 	}, SMPEventFailure, 100, "")
 
 }
@@ -466,7 +466,7 @@ func Test_smpStateExpect3_receiveMessage3_abortsSMPIfCantGenerateFinalParameters
 	c := newConversation(otrV3{}, fixedRand([]string{"ABCD"}))
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	c.smp.s2 = fixtureSmp2()
-	s, m, err := smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
+	s, m, err := smpStateExpect3{}.receiveMessage3(c.smpEngine(), fixtureMessage3())
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -477,7 +477,7 @@ func Test_smpStateExpect4_receiveMessage4_abortsSMPIfVerifySMPReturnsError(t *te
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.s1 = fixtureSmp1()
 	c.smp.s3 = fixtureSmp3()
-	s, m, err := smpStateExpect4{}.receiveMessage4(c, smp4Message{rb: big.NewInt(1)})
+	s, m, err := smpStateExpect4{}.receiveMessage4(c.smpEngine(), smp4Message{rb: big.NewInt(1)})
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -489,7 +489,7 @@ func Test_smpStateExpect4_receiveMessage4_abortsSMPIfProtocolFails(t *testing.T)
 	c.smp.s1 = fixtureSmp1()
 	c.smp.s3 = fixtureSmp3()
 	c.smp.s3.papb = sub(c.smp.s3.papb, big.NewInt(1))
-	s, m, err := smpStateExpect4{}.receiveMessage4(c, fixtureMessage4())
+	s, m, err := smpStateExpect4{}.receiveMessage4(c.smpEngine(), fixtureMessage4())
 
 	assertNil(t, err)
 	assertEquals(t, s, smpStateExpect1{})
@@ -503,7 +503,7 @@ func Test_smpStateExpect4_receiveMessage4_willSendAnSMPNotificationOnProtocolFai
 	c.smp.s3.papb = sub(c.smp.s3.papb, big.NewInt(1))
 
 	c.expectSMPEvent(t, func() {
-		smpStateExpect4{}.receiveMessage4(c, fixtureMessage4())
+		smpStateExpect4{}.receiveMessage4(c.smpEngine(), fixtureMessage4())
 	}, SMPEventFailure, 100, "")
 }
 
@@ -513,7 +513,7 @@ func Test_smp4Message_receivedMessage_abortsSMPIfTheUnderlyingPrimitiveDoes(t *t
 	c.smp.s1 = fixtureSmp1()
 	c.smp.s3 = fixtureSmp3()
 
-	ret, err := smp4Message{rb: big.NewInt(1)}.receivedMessage(c)
+	ret, err := smp4Message{rb: big.NewInt(1)}.receivedMessage(c.smpEngine())
 	assertNil(t, err)
 	assertDeepEquals(t, ret, smpMessageAbort{})
 }
@@ -525,7 +525,7 @@ func Test_receive_returnsAnyErrorThatOccurs(t *testing.T) {
 	c.smp.state = smpStateExpect2{}
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
-	ret, err := c.receiveSMP(m)
+	ret, err := c.smpEngine().receiveSMP(m)
 	assertNil(t, err)
 	assertDeepEquals(t, *ret, smpMessageAbort{}.tlv())
 }
@@ -549,7 +549,7 @@ func Test_smpStateExpect4_String_returnsTheCorrectString(t *testing.T) {
 func Test_smpMessageAbort_receivedMessage_setsTheNewState(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.state = smpStateExpect2{}
-	ret, err := smpMessageAbort{}.receivedMessage(c)
+	ret, err := smpMessageAbort{}.receivedMessage(c.smpEngine())
 	assertDeepEquals(t, ret, nil)
 	assertDeepEquals(t, err, nil)
 	assertDeepEquals(t, c.smp.state, smpStateExpect1{})
@@ -560,7 +560,7 @@ func Test_smpMessageAbort_receivedMessage_sendsAnSMPEventAboutTheAbort(t *testin
 	c.smp.state = smpStateExpect2{}
 
 	c.expectSMPEvent(t, func() {
-		smpMessageAbort{}.receivedMessage(c)
+		smpMessageAbort{}.receivedMessage(c.smpEngine())
 	}, SMPEventAbort, 0, "")
 }
 
@@ -568,6 +568,6 @@ func Test_restartSMP_createsSMPAbort(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.state = smpStateExpect2{}
 
-	assertDeepEquals(t, c.restartSMP(), smpMessageAbort{}.tlv())
+	assertDeepEquals(t, c.smp.restartSMP(), smpMessageAbort{}.tlv())
 	assertDeepEquals(t, c.smp.state, smpStateExpect1{})
 }
@@ -0,0 +1,45 @@
+package otr3
+
+import "time"
+
+const smpTimeoutTimer = "smp-timeout"
+
+// SetSMPTimeout sets how long an SMP exchange can wait for the next step, either a message from the peer or the secret from the user,
+// before it is aborted. When it times out, the secrets are wiped, SMPEventTimeout is signalled and Poll returns the SMP abort message
+// for the peer. Zero disables the timeout, which is the default.
+func (c *Conversation) SetSMPTimeout(d time.Duration) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	c.smp.timeout = d
+	c.updateSMPTimeout()
+}
+
+// updateSMPTimeout restarts the timeout after every step of the SMP exchange, and cancels it when the exchange is over
+func (c *Conversation) updateSMPTimeout() {
+	if c.smp.timeout <= 0 || !c.smp.inProgress() {
+		c.cancelTimer(smpTimeoutTimer)
+		return
+	}
+
+	c.scheduleNamed(smpTimeoutTimer, c.now().Add(c.smp.timeout), c.smpTimedOut)
+}
+
+func (c *Conversation) smpTimedOut() []ValidMessage {
+	if !c.smp.inProgress() {
+		return nil
+	}
+
+	t := c.smp.restartSMP()
+	c.smp.wipe()
+	c.smp.ensureSMP()
+	c.smpEvent(SMPEventTimeout, 0)
+
+	if c.msgState != encrypted {
+		return nil
+	}
+
+	// An error can only happen when the Rand reader is broken, and then the peer will time out as well
+	msgs, _, _ := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{t})
+	return msgs
+}
@@ -0,0 +1,82 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+type fixedClock struct {
+	t time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.t
+}
+
+func Test_SMPTimeout_abortsTheExchangeWhenThePeerDoesntAnswer(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	clock := &fixedClock{time.Now()}
+	alice.SetClock(clock)
+	alice.SetSMPTimeout(time.Minute)
+
+	alice.StartAuthenticate("", []byte("secret"))
+	assertTrue(t, alice.smp.inProgress())
+
+	next, ok := alice.NextTimer()
+	assertTrue(t, ok)
+	assertEquals(t, next, clock.t.Add(time.Minute))
+
+	assertNil(t, alice.Poll())
+
+	clock.t = clock.t.Add(time.Minute)
+	var toSend []ValidMessage
+	alice.expectSMPEvent(t, func() {
+		toSend = alice.Poll()
+	}, SMPEventTimeout, 0, "")
+
+	assertFalse(t, alice.smp.inProgress())
+	assertNil(t, alice.smp.secret)
+	assertEquals(t, len(toSend), 1)
+
+	bob.SetHeartbeatInterval(-1)
+	bob.smp.state = smpStateExpect3{}
+	bob.Receive(toSend[0])
+	assertEquals(t, bob.smp.state, smpStateExpect1{})
+}
+
+func Test_SMPTimeout_isRestartedAfterEveryStep(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	clock := &fixedClock{time.Now()}
+	bob.SetClock(clock)
+	bob.SetSMPTimeout(time.Minute)
+
+	toSend, _ := alice.StartAuthenticate("", []byte("secret"))
+	bob.Receive(toSend[0])
+	first, _ := bob.NextTimer()
+
+	clock.t = clock.t.Add(30 * time.Second)
+	bob.ProvideAuthenticationSecret([]byte("secret"))
+	second, _ := bob.NextTimer()
+
+	assertEquals(t, second, first.Add(30*time.Second))
+}
+
+func Test_SMPTimeout_isCancelledWhenTheExchangeIsAborted(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	alice.SetSMPTimeout(time.Minute)
+
+	alice.StartAuthenticate("", []byte("secret"))
+	alice.AbortAuthentication()
+
+	_, ok := alice.NextTimer()
+	assertFalse(t, ok)
+}
+
+func Test_SMPTimeout_isDisabledByDefault(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	alice.StartAuthenticate("", []byte("secret"))
+
+	_, ok := alice.NextTimer()
+	assertFalse(t, ok)
+}
@@ -0,0 +1,477 @@
+package otr3
+
+import (
+	"io"
+	"sync"
+
+	"github.com/coyim/gotrax"
+)
+
+const (
+	streamChunkSize    = 4096
+	streamWindow       = 16
+	maxIncomingStreams = 16
+)
+
+var errStreamAborted = newOtrError("stream was aborted")
+var errStreamClosed = newOtrError("stream is closed")
+var errNoMessageSink = newOtrError("streams need a message sink")
+var errTooManyStreams = newOtrError("too many open streams")
+
+// MessageSink is used by streams to send messages to the peer outside of calls to Send and Receive.
+// It will be called from the goroutine reading from or writing to the stream, while the conversation is locked,
+// so that no later data message can be created before the messages have been handed to the transport.
+// It must not call methods of the conversation.
+type MessageSink func(msgs []ValidMessage) error
+
+// StreamHandler is an interface that will be invoked when the peer opens a stream
+type StreamHandler interface {
+	// ReceivedStream is called at the end of Receive, when the first chunk of a new stream has arrived.
+	// The stream should be read from a different goroutine, since the rest of the data will only
+	// arrive through later calls to Receive. It must be closed when no longer needed.
+	ReceivedStream(r *StreamReader)
+}
+
+type dynamicStreamHandler struct {
+	eh func(r *StreamReader)
+}
+
+func (d dynamicStreamHandler) ReceivedStream(r *StreamReader) {
+	d.eh(r)
+}
+
+type streams struct {
+	handler  StreamHandler
+	sink     MessageSink
+	lastID   uint32
+	outgoing map[uint32]*StreamWriter
+	incoming map[uint32]*StreamReader
+}
+
+// StreamWriter sends an arbitrary amount of data to the peer, split in chunks sent in separate data messages.
+// At most a fixed window of chunks can be waiting for the peer to read them, after which Write blocks until
+// the peer acknowledges them. Acknowledgements arrive through Receive, so it has to be called from a different goroutine.
+type StreamWriter struct {
+	c    *Conversation
+	id   uint32
+	sink MessageSink
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	sent    uint32
+	acked   uint32
+	aborted bool
+	closed  bool
+}
+
+// StreamReader receives the data of a stream opened by the peer
+type StreamReader struct {
+	c  *Conversation
+	id uint32
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	received map[uint32][]byte
+	next     uint32
+	ready    [][]byte
+	consumed uint32
+	acked    uint32
+	end      uint32
+	ended    bool
+	aborted  bool
+	closed   bool
+}
+
+// SetStreamHandler assigns the handler for streams opened by the peer, and the sink used to send acknowledgements for them.
+// Without a handler, streams opened by the peer are aborted.
+func (c *Conversation) SetStreamHandler(handler StreamHandler, sink MessageSink) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	c.streams.handler = handler
+	c.streams.sink = sink
+}
+
+// OpenStream starts a new stream to the peer. Messages for the stream will be sent using the sink.
+// Streams can only be used in an encrypted conversation, and are aborted when it ends.
+func (c *Conversation) OpenStream(sink MessageSink) (*StreamWriter, error) {
+	if sink == nil {
+		return nil, errNoMessageSink
+	}
+
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	if c.msgState != encrypted {
+		return nil, errCannotSendUnencrypted
+	}
+
+	c.streams.lastID++
+	w := newStreamWriter(c, c.streams.lastID, sink)
+
+	if c.streams.outgoing == nil {
+		c.streams.outgoing = make(map[uint32]*StreamWriter)
+	}
+	c.streams.outgoing[w.id] = w
+
+	return w, nil
+}
+
+func newStreamWriter(c *Conversation, id uint32, sink MessageSink) *StreamWriter {
+	w := &StreamWriter{c: c, id: id, sink: sink}
+	w.cond = sync.NewCond(&w.lock)
+	return w
+}
+
+func streamTLV(tlvType uint16, id, n uint32, data []byte) tlv {
+	value := append(gotrax.AppendWord(gotrax.AppendWord(nil, id), n), data...)
+
+	return tlv{
+		tlvType:   tlvType,
+		tlvLength: uint16(len(value)),
+		tlvValue:  value,
+	}
+}
+
+func (c tlv) isStreamMessage() bool {
+	return c.tlvType >= tlvTypeStreamData && c.tlvType <= tlvTypeStreamCancel
+}
+
+// sendStreamTLV creates the data message for a stream TLV, and sends it using the sink given. The lock is held
+// until the sink returns, since the peer drops data messages that arrive after one with a later counter.
+func (c *Conversation) sendStreamTLV(sink MessageSink, t tlv) error {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{t})
+	if err != nil {
+		return err
+	}
+	return sink(msgs)
+}
+
+// Write sends the data to the peer. It blocks while the window of unacknowledged chunks is full.
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > streamChunkSize {
+			n = streamChunkSize
+		}
+
+		seq, err := w.reserveChunk()
+		if err != nil {
+			return written, err
+		}
+
+		if err := w.c.sendStreamTLV(w.sink, streamTLV(tlvTypeStreamData, w.id, seq, p[:n])); err != nil {
+			return written, err
+		}
+
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+func (w *StreamWriter) reserveChunk() (uint32, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for !w.aborted && !w.closed && w.sent-w.acked >= streamWindow {
+		w.cond.Wait()
+	}
+
+	if w.aborted {
+		return 0, errStreamAborted
+	}
+	if w.closed {
+		return 0, errStreamClosed
+	}
+
+	w.sent++
+	return w.sent - 1, nil
+}
+
+// Close finishes the stream, telling the peer that no more data will be sent.
+func (w *StreamWriter) Close() error {
+	w.lock.Lock()
+	if w.aborted || w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	sent := w.sent
+	w.cond.Broadcast()
+	w.lock.Unlock()
+
+	w.c.forgetOutgoingStream(w.id)
+	return w.c.sendStreamTLV(w.sink, streamTLV(tlvTypeStreamEnd, w.id, sent, nil))
+}
+
+// Abort stops the stream, telling the peer to discard it.
+func (w *StreamWriter) Abort() error {
+	if !w.abort() {
+		return nil
+	}
+
+	w.c.forgetOutgoingStream(w.id)
+	return w.c.sendStreamTLV(w.sink, streamTLV(tlvTypeStreamAbort, w.id, 0, nil))
+}
+
+func (w *StreamWriter) abort() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.aborted || w.closed {
+		return false
+	}
+
+	w.aborted = true
+	w.cond.Broadcast()
+	return true
+}
+
+func (w *StreamWriter) acknowledge(consumed uint32) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if consumed > w.acked && consumed <= w.sent {
+		w.acked = consumed
+		w.cond.Broadcast()
+	}
+}
+
+func (c *Conversation) forgetOutgoingStream(id uint32) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	delete(c.streams.outgoing, id)
+}
+
+func (c *Conversation) forgetIncomingStream(id uint32) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	delete(c.streams.incoming, id)
+}
+
+// Read reads data from the stream. It blocks until data is available, and returns io.EOF when the peer has closed the stream.
+func (r *StreamReader) Read(p []byte) (int, error) {
+	r.lock.Lock()
+	for len(r.ready) == 0 && !r.aborted && !r.closed && !(r.ended && r.consumed == r.end) {
+		r.cond.Wait()
+	}
+
+	if r.aborted || r.closed {
+		r.lock.Unlock()
+		return 0, errStreamAborted
+	}
+
+	if len(r.ready) == 0 {
+		r.lock.Unlock()
+		r.c.forgetIncomingStream(r.id)
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.ready[0])
+	r.ready[0] = r.ready[0][n:]
+	if len(r.ready[0]) == 0 {
+		r.ready = r.ready[1:]
+		r.consumed++
+	}
+
+	ack := r.consumed-r.acked >= streamWindow/2
+	if ack {
+		r.acked = r.consumed
+	}
+	consumed := r.consumed
+	r.lock.Unlock()
+
+	if ack {
+		if err := r.c.sendStreamTLV(r.c.streamSink(), streamTLV(tlvTypeStreamAck, r.id, consumed, nil)); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Close stops reading from the stream. If the stream hasn't been read completely, the peer is told to abort it.
+func (r *StreamReader) Close() error {
+	r.lock.Lock()
+	finished := r.ended && r.consumed == r.end
+	wasOpen := !r.closed && !r.aborted
+	r.closed = true
+	r.ready = nil
+	r.received = nil
+	r.cond.Broadcast()
+	r.lock.Unlock()
+
+	r.c.forgetIncomingStream(r.id)
+
+	if finished || !wasOpen {
+		return nil
+	}
+
+	return r.c.sendStreamTLV(r.c.streamSink(), streamTLV(tlvTypeStreamCancel, r.id, 0, nil))
+}
+
+func (c *Conversation) streamSink() MessageSink {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	if c.streams.sink == nil {
+		return func([]ValidMessage) error { return errNoMessageSink }
+	}
+	return c.streams.sink
+}
+
+// receiveChunk stores the chunk in the reader. It returns false if the chunk is outside of the window the peer is allowed to send.
+func (r *StreamReader) receiveChunk(seq uint32, data []byte) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed || r.aborted {
+		return true
+	}
+
+	if seq < r.next {
+		return true
+	}
+
+	if seq-r.acked >= streamWindow || (r.ended && seq >= r.end) {
+		return false
+	}
+
+	r.received[seq] = makeCopy(data)
+	for {
+		d, ok := r.received[r.next]
+		if !ok {
+			break
+		}
+		delete(r.received, r.next)
+		r.ready = append(r.ready, d)
+		r.next++
+	}
+
+	r.cond.Broadcast()
+	return true
+}
+
+func (r *StreamReader) receiveEnd(end uint32) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.ended = true
+	r.end = end
+	r.cond.Broadcast()
+}
+
+func (r *StreamReader) abort() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.aborted = true
+	r.ready = nil
+	r.received = nil
+	r.cond.Broadcast()
+}
+
+func newStreamReader(c *Conversation, id uint32) *StreamReader {
+	r := &StreamReader{c: c, id: id, received: make(map[uint32][]byte)}
+	r.cond = sync.NewCond(&r.lock)
+	return r
+}
+
+func (c *Conversation) incomingStream(id uint32) (*StreamReader, error) {
+	if c.streams.handler == nil || len(c.streams.incoming) >= maxIncomingStreams {
+		return nil, errTooManyStreams
+	}
+
+	if c.streams.incoming == nil {
+		c.streams.incoming = make(map[uint32]*StreamReader)
+	}
+
+	r := newStreamReader(c, id)
+	c.streams.incoming[id] = r
+
+	h := c.streams.handler
+	c.callHandler(func() { h.ReceivedStream(r) })
+	return r, nil
+}
+
+func cancelStreamTLV(id uint32) *tlv {
+	t := streamTLV(tlvTypeStreamCancel, id, 0, nil)
+	return &t
+}
+
+func (c *Conversation) processStreamTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
+	rest, id, ok1 := gotrax.ExtractWord(t.tlvValue[:t.tlvLength])
+	data, n, ok2 := gotrax.ExtractWord(rest)
+	if !ok1 || !ok2 {
+		return nil, newOtrError("corrupt data message")
+	}
+
+	switch t.tlvType {
+	case tlvTypeStreamData:
+		return c.receiveStreamChunk(id, n, data)
+	case tlvTypeStreamEnd:
+		if r, ok := c.streams.incoming[id]; ok {
+			r.receiveEnd(n)
+		}
+	case tlvTypeStreamAbort:
+		if r, ok := c.streams.incoming[id]; ok {
+			r.abort()
+			delete(c.streams.incoming, id)
+		}
+	case tlvTypeStreamAck:
+		if w, ok := c.streams.outgoing[id]; ok {
+			w.acknowledge(n)
+		}
+	case tlvTypeStreamCancel:
+		if w, ok := c.streams.outgoing[id]; ok {
+			w.abort()
+			delete(c.streams.outgoing, id)
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *Conversation) receiveStreamChunk(id, seq uint32, data []byte) (*tlv, error) {
+	r, ok := c.streams.incoming[id]
+	if !ok {
+		if seq != 0 {
+			return cancelStreamTLV(id), nil
+		}
+
+		var err error
+		if r, err = c.incomingStream(id); err != nil {
+			return cancelStreamTLV(id), nil
+		}
+	}
+
+	if !r.receiveChunk(seq, data) {
+		r.abort()
+		delete(c.streams.incoming, id)
+		return cancelStreamTLV(id), nil
+	}
+
+	return nil, nil
+}
+
+// abortAllStreams aborts all streams locally, without telling the peer. It is used when the encrypted session ends.
+func (c *Conversation) abortAllStreams() {
+	for _, w := range c.streams.outgoing {
+		w.abort()
+	}
+
+	for _, r := range c.streams.incoming {
+		r.abort()
+	}
+
+	c.streams.outgoing = nil
+	c.streams.incoming = nil
+}
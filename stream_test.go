@@ -0,0 +1,250 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+type streamPeer struct {
+	c     *Conversation
+	inbox chan ValidMessage
+}
+
+func (p *streamPeer) sink(to *streamPeer) MessageSink {
+	return func(msgs []ValidMessage) error {
+		for _, m := range msgs {
+			to.inbox <- m
+		}
+		return nil
+	}
+}
+
+func (p *streamPeer) pump(to *streamPeer, done chan struct{}) {
+	for {
+		select {
+		case m := <-p.inbox:
+			_, toSend, _ := p.c.Receive(m)
+			for _, ts := range toSend {
+				to.inbox <- ts
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func fixtureStreamPeers() (alice, bob *streamPeer, done chan struct{}) {
+	a, b := fixtureEncryptedConversations()
+	alice = &streamPeer{a, make(chan ValidMessage, 1000)}
+	bob = &streamPeer{b, make(chan ValidMessage, 1000)}
+	done = make(chan struct{})
+
+	go alice.pump(bob, done)
+	go bob.pump(alice, done)
+
+	return
+}
+
+func Test_Stream_transfersALargePayload(t *testing.T) {
+	alice, bob, done := fixtureStreamPeers()
+	defer close(done)
+
+	payload := make([]byte, 50*streamChunkSize+123)
+	rand.Read(payload)
+
+	readers := make(chan *StreamReader, 1)
+	bob.c.SetStreamHandler(dynamicStreamHandler{func(r *StreamReader) { readers <- r }}, bob.sink(alice))
+
+	w, err := alice.c.OpenStream(alice.sink(bob))
+	assertNil(t, err)
+
+	written := make(chan error)
+	go func() {
+		_, err := w.Write(payload)
+		if err == nil {
+			err = w.Close()
+		}
+		written <- err
+	}()
+
+	r := <-readers
+	received, err := ioutil.ReadAll(r)
+	assertNil(t, err)
+	assertNil(t, <-written)
+	assertDeepEquals(t, received, payload)
+	assertNil(t, r.Close())
+}
+
+func Test_Stream_closingTheReaderAbortsTheWriter(t *testing.T) {
+	alice, bob, done := fixtureStreamPeers()
+	defer close(done)
+
+	readers := make(chan *StreamReader, 1)
+	bob.c.SetStreamHandler(dynamicStreamHandler{func(r *StreamReader) { readers <- r }}, bob.sink(alice))
+
+	w, _ := alice.c.OpenStream(alice.sink(bob))
+	written := make(chan error)
+	go func() {
+		_, err := w.Write(make([]byte, (streamWindow+1)*streamChunkSize))
+		written <- err
+	}()
+
+	r := <-readers
+	assertNil(t, r.Close())
+	assertEquals(t, <-written, errStreamAborted)
+}
+
+func Test_Stream_abortingTheWriterAbortsTheReader(t *testing.T) {
+	alice, bob, done := fixtureStreamPeers()
+	defer close(done)
+
+	readers := make(chan *StreamReader, 1)
+	bob.c.SetStreamHandler(dynamicStreamHandler{func(r *StreamReader) { readers <- r }}, bob.sink(alice))
+
+	w, _ := alice.c.OpenStream(alice.sink(bob))
+	w.Write([]byte("hello"))
+	r := <-readers
+	assertNil(t, w.Abort())
+
+	_, err := ioutil.ReadAll(r)
+	assertEquals(t, err, errStreamAborted)
+}
+
+func Test_OpenStream_returnsErrorIfTheConversationIsNotEncrypted(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+
+	_, err := c.OpenStream(func([]ValidMessage) error { return nil })
+	assertEquals(t, err, errCannotSendUnencrypted)
+
+	_, err = c.OpenStream(nil)
+	assertEquals(t, err, errNoMessageSink)
+}
+
+func Test_StreamWriter_reserveChunk_waitsForAcknowledgements(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	w, _ := alice.OpenStream(func([]ValidMessage) error { return nil })
+	w.sent = streamWindow
+
+	reserved := make(chan uint32)
+	go func() {
+		seq, _ := w.reserveChunk()
+		reserved <- seq
+	}()
+
+	w.acknowledge(streamWindow / 2)
+	assertEquals(t, <-reserved, uint32(streamWindow))
+}
+
+func Test_StreamWriter_acknowledge_ignoresAcknowledgementsForChunksNotSent(t *testing.T) {
+	w := newStreamWriter(&Conversation{}, 1, nil)
+	w.sent = 3
+	w.acknowledge(4)
+	assertEquals(t, w.acked, uint32(0))
+
+	w.acknowledge(3)
+	assertEquals(t, w.acked, uint32(3))
+}
+
+func Test_StreamReader_reassemblesChunksReceivedOutOfOrder(t *testing.T) {
+	r := newStreamReader(&Conversation{}, 1)
+
+	assertTrue(t, r.receiveChunk(2, []byte("c")))
+	assertTrue(t, r.receiveChunk(1, []byte("b")))
+	assertEquals(t, len(r.ready), 0)
+	assertTrue(t, r.receiveChunk(0, []byte("a")))
+	r.receiveEnd(3)
+
+	var out bytes.Buffer
+	_, err := io.Copy(&out, r)
+	assertNil(t, err)
+	assertEquals(t, out.String(), "abc")
+}
+
+func Test_StreamReader_receiveChunk_rejectsChunksOutsideTheWindow(t *testing.T) {
+	r := newStreamReader(&Conversation{}, 1)
+
+	assertFalse(t, r.receiveChunk(streamWindow, []byte("a")))
+	assertTrue(t, r.receiveChunk(streamWindow-1, []byte("a")))
+}
+
+func Test_receiveStreamChunk_cancelsTheStreamIfThereIsNoHandler(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+
+	toSend, err := c.processTLVs([]tlv{streamTLV(tlvTypeStreamData, 5, 0, []byte("hello"))}, dataMessageExtra{})
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []tlv{streamTLV(tlvTypeStreamCancel, 5, 0, nil)})
+}
+
+func Test_receiveStreamChunk_cancelsTheStreamIfAChunkIsOutsideTheWindow(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.SetStreamHandler(dynamicStreamHandler{func(r *StreamReader) {}}, nil)
+
+	toSend, _ := c.processTLVs([]tlv{
+		streamTLV(tlvTypeStreamData, 5, 0, []byte("hello")),
+		streamTLV(tlvTypeStreamData, 5, streamWindow+1, []byte("hello")),
+	}, dataMessageExtra{})
+
+	assertDeepEquals(t, toSend, []tlv{streamTLV(tlvTypeStreamCancel, 5, 0, nil)})
+	assertEquals(t, len(c.streams.incoming), 0)
+}
+
+func Test_processStreamTLV_returnsErrorForCorruptTLVs(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+
+	_, err := c.processTLVs([]tlv{tlv{tlvType: tlvTypeStreamData, tlvLength: 3, tlvValue: []byte{0x00, 0x00, 0x01}}}, dataMessageExtra{})
+
+	assertDeepEquals(t, err, newOtrError("corrupt data message"))
+}
+
+func Test_End_abortsAllStreams(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	w, _ := alice.OpenStream(func([]ValidMessage) error { return nil })
+	r := newStreamReader(alice, 1)
+	alice.streams.incoming = map[uint32]*StreamReader{1: r}
+
+	alice.End()
+
+	_, err := w.Write([]byte("hello"))
+	assertEquals(t, err, errStreamAborted)
+	_, err = r.Read(make([]byte, 1))
+	assertEquals(t, err, errStreamAborted)
+}
+
+func Test_decideFlagFrom_setsIgnoreUnreadableForStreamTLVs(t *testing.T) {
+	assertEquals(t, decideFlagFrom([]tlv{streamTLV(tlvTypeStreamAck, 1, 1, nil)}), messageFlagIgnoreUnreadable)
+}
+
+func Test_StreamWriter_Write_deliversTheChunkBeforeALaterMessageIsCreated(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	w, _ := alice.OpenStream(func(msgs []ValidMessage) error {
+		close(entered)
+		<-release
+		return nil
+	})
+
+	go w.Write([]byte("hello"))
+	<-entered
+
+	sent := make(chan struct{})
+	go func() {
+		alice.Send(ValidMessage("hi"))
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		t.Errorf("Send created a data message before the stream chunk had been delivered")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-sent
+}
@@ -0,0 +1,88 @@
+package otr3
+
+import "time"
+
+// timer is something that has to be done at a later time, without waiting for a message from the peer.
+// When it fires, it returns the messages that should be sent to the peer.
+type timer struct {
+	at   time.Time
+	name string
+	fire func() []ValidMessage
+}
+
+type timers struct {
+	pending []timer
+}
+
+func (c *Conversation) schedule(at time.Time, fire func() []ValidMessage) {
+	c.timers.pending = append(c.timers.pending, timer{at: at, fire: fire})
+}
+
+// scheduleNamed schedules a timer that replaces any earlier timer with the same name
+func (c *Conversation) scheduleNamed(name string, at time.Time, fire func() []ValidMessage) {
+	c.cancelTimer(name)
+	c.timers.pending = append(c.timers.pending, timer{at: at, name: name, fire: fire})
+}
+
+func (c *Conversation) cancelTimer(name string) {
+	remaining := c.timers.pending[:0]
+	for _, t := range c.timers.pending {
+		if t.name != name {
+			remaining = append(remaining, t)
+		}
+	}
+	c.timers.pending = remaining
+}
+
+// NextTimer returns when Poll should be called next, or false if there is nothing waiting to be done
+func (c *Conversation) NextTimer() (time.Time, bool) {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	var next time.Time
+	for _, t := range c.timers.pending {
+		if next.IsZero() || t.at.Before(next) {
+			next = t.at
+		}
+	}
+
+	ctx := &c.fragmentationContext
+	if m, ok := ctx.messages[ctx.oldest()]; ok {
+		if at := m.started.Add(fragmentExpiry); next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// Poll does all the work that was waiting for a certain time, like reporting expired messages and dropping
+// incomplete fragmented messages. The application should call it at the time returned by NextTimer, and send the
+// messages returned to the peer. It is safe to call Poll at any time, and calling it too often only means some calls will do nothing.
+func (c *Conversation) Poll() []ValidMessage {
+	c.lockConversation()
+	defer c.unlockConversation()
+
+	return c.pollAt(c.now())
+}
+
+func (c *Conversation) pollAt(now time.Time) []ValidMessage {
+	c.expireFragments(now)
+
+	var due []timer
+	remaining := c.timers.pending[:0]
+	for _, t := range c.timers.pending {
+		if t.at.After(now) {
+			remaining = append(remaining, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers.pending = remaining
+
+	var toSend []ValidMessage
+	for _, t := range due {
+		toSend = append(toSend, t.fire()...)
+	}
+	return toSend
+}
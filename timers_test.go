@@ -0,0 +1,74 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func Test_NextTimer_returnsFalseWhenThereIsNothingToDo(t *testing.T) {
+	c := &Conversation{}
+
+	_, ok := c.NextTimer()
+	assertFalse(t, ok)
+}
+
+func Test_NextTimer_returnsTheEarliestTimer(t *testing.T) {
+	c := &Conversation{}
+	now := time.Now()
+	c.schedule(now.Add(time.Hour), func() []ValidMessage { return nil })
+	c.schedule(now.Add(time.Minute), func() []ValidMessage { return nil })
+
+	next, _ := c.NextTimer()
+	assertEquals(t, next, now.Add(time.Minute))
+}
+
+func Test_NextTimer_includesTheExpiryOfFragments(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.receiveFragment([]byte("?OTR,00001,00002,one ,"))
+	started := c.fragmentationContext.messages[0].started
+
+	next, ok := c.NextTimer()
+	assertTrue(t, ok)
+	assertEquals(t, next, started.Add(fragmentExpiry))
+}
+
+func Test_Poll_dropsExpiredFragments(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.receiveFragment([]byte("?OTR,00001,00002,one ,"))
+
+	c.expectMessageEvent(t, func() {
+		c.pollAt(time.Now().Add(fragmentExpiry + time.Second))
+	}, MessageEventReceivedFragmentsDropped, nil, errFragmentsExpired)
+
+	assertEquals(t, len(c.fragmentationContext.messages), 0)
+}
+
+func Test_Poll_firesOnlyTheTimersThatAreDue(t *testing.T) {
+	c := &Conversation{}
+	now := time.Now()
+	var fired []int
+	c.schedule(now.Add(time.Hour), func() []ValidMessage { fired = append(fired, 1); return nil })
+	c.schedule(now.Add(-time.Second), func() []ValidMessage { fired = append(fired, 2); return []ValidMessage{ValidMessage("two")} })
+
+	toSend := c.pollAt(now)
+
+	assertDeepEquals(t, fired, []int{2})
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("two")})
+	assertEquals(t, len(c.timers.pending), 1)
+}
+
+func Test_scheduleNamed_replacesTheEarlierTimerWithTheSameName(t *testing.T) {
+	c := &Conversation{}
+	now := time.Now()
+	c.schedule(now.Add(time.Hour), func() []ValidMessage { return nil })
+	c.scheduleNamed("test", now.Add(time.Minute), func() []ValidMessage { return nil })
+	c.scheduleNamed("test", now.Add(2*time.Minute), func() []ValidMessage { return nil })
+
+	assertEquals(t, len(c.timers.pending), 2)
+	next, _ := c.NextTimer()
+	assertEquals(t, next, now.Add(2*time.Minute))
+
+	c.cancelTimer("test")
+	assertEquals(t, len(c.timers.pending), 1)
+}
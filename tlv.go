@@ -18,11 +18,35 @@ const (
 	tlvTypeSMPAbort          = uint16(0x06)
 	tlvTypeSMP1WithQuestion  = uint16(0x07)
 	tlvTypeExtraSymmetricKey = uint16(0x08)
+
+	// These TLV types are not part of the OTR specification, and are only understood by otr3.
+	// They are all in the range from tlvTypeOTR3First to tlvTypeOTR3Last, which is reserved up front.
+	tlvTypeStreamData   = uint16(0x0100)
+	tlvTypeStreamEnd    = uint16(0x0101)
+	tlvTypeStreamAbort  = uint16(0x0102)
+	tlvTypeStreamAck    = uint16(0x0103)
+	tlvTypeStreamCancel = uint16(0x0104)
+
+	tlvTypeReceiptRequest  = uint16(0x0105)
+	tlvTypeDeliveryReceipt = uint16(0x0106)
+	tlvTypeReadReceipt     = uint16(0x0107)
+
+	tlvTypeRetention = uint16(0x0108)
+
+	tlvTypeSMPNormalization    = uint16(0x0109)
+	tlvTypeSMPNormalizationAck = uint16(0x010A)
+)
+
+// The TLV types reserved for the extensions otr3 understands, including ones not defined yet,
+// so that adding an extension never takes a type an application has registered a handler for
+const (
+	tlvTypeOTR3First = uint16(0x0100)
+	tlvTypeOTR3Last  = uint16(0x01FF)
 )
 
 type tlvHandler func(*Conversation, tlv, dataMessageExtra) (*tlv, error)
 
-var tlvHandlers = make([]tlvHandler, 9)
+var tlvHandlers = make(map[uint16]tlvHandler)
 
 func initTLVHandlers() {
 	tlvHandlers[tlvTypePadding] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
@@ -52,13 +76,41 @@ func initTLVHandlers() {
 	tlvHandlers[tlvTypeExtraSymmetricKey] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
 		return c.processExtraSymmetricKeyTLV(t, x)
 	}
+	for _, tt := range []uint16{tlvTypeStreamData, tlvTypeStreamEnd, tlvTypeStreamAbort, tlvTypeStreamAck, tlvTypeStreamCancel} {
+		tlvHandlers[tt] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
+			return c.processStreamTLV(t, x)
+		}
+	}
+	for _, tt := range []uint16{tlvTypeReceiptRequest, tlvTypeDeliveryReceipt, tlvTypeReadReceipt} {
+		tlvHandlers[tt] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
+			return c.processReceiptTLV(t, x)
+		}
+	}
+	tlvHandlers[tlvTypeRetention] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
+		return c.processRetentionTLV(t, x)
+	}
+	tlvHandlers[tlvTypeSMPNormalization] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
+		return c.processSMPNormalizationTLV(t, x)
+	}
+	tlvHandlers[tlvTypeSMPNormalizationAck] = func(c *Conversation, t tlv, x dataMessageExtra) (*tlv, error) {
+		return c.processSMPNormalizationAckTLV(t, x)
+	}
 }
 
 func messageHandlerForTLV(t tlv) (tlvHandler, error) {
-	if t.tlvType >= uint16(len(tlvHandlers)) {
+	h, ok := tlvHandlers[t.tlvType]
+	if !ok {
 		return nil, newOtrError("unexpected TLV type")
 	}
-	return tlvHandlers[t.tlvType], nil
+	return h, nil
+}
+
+func isBuiltinTLV(tlvType uint16) bool {
+	if tlvType >= tlvTypeOTR3First && tlvType <= tlvTypeOTR3Last {
+		return true
+	}
+	_, ok := tlvHandlers[tlvType]
+	return ok
 }
 
 type tlv struct {
@@ -114,7 +166,7 @@ func (c tlv) smpMessage() (smpMessage, bool) {
 }
 
 func toSmpMessage1(t tlv) (msg smp1Message, ok bool) {
-	_, mpis, ok := gotrax.ExtractMPIs(t.tlvValue)
+	_, mpis, ok := extractMPIs(t.tlvValue)
 	if !ok || len(mpis) < 6 {
 		return msg, false
 	}
@@ -141,7 +193,7 @@ func toSmpMessage1Q(t tlv) (msg smp1Message, ok bool) {
 }
 
 func toSmpMessage2(t tlv) (msg smp2Message, ok bool) {
-	_, mpis, ok := gotrax.ExtractMPIs(t.tlvValue)
+	_, mpis, ok := extractMPIs(t.tlvValue)
 	if !ok || len(mpis) < 11 {
 		return msg, false
 	}
@@ -160,7 +212,7 @@ func toSmpMessage2(t tlv) (msg smp2Message, ok bool) {
 }
 
 func toSmpMessage3(t tlv) (msg smp3Message, ok bool) {
-	_, mpis, ok := gotrax.ExtractMPIs(t.tlvValue)
+	_, mpis, ok := extractMPIs(t.tlvValue)
 	if !ok || len(mpis) < 8 {
 		return msg, false
 	}
@@ -176,7 +228,7 @@ func toSmpMessage3(t tlv) (msg smp3Message, ok bool) {
 }
 
 func toSmpMessage4(t tlv) (msg smp4Message, ok bool) {
-	_, mpis, ok := gotrax.ExtractMPIs(t.tlvValue)
+	_, mpis, ok := extractMPIs(t.tlvValue)
 	if !ok || len(mpis) < 3 {
 		return msg, false
 	}
@@ -9,8 +9,10 @@ func (p *dhKeyPair) wipe() {
 
 	wipeBigInt(p.pub)
 	wipeBigInt(p.priv)
+	p.privMemory.Destroy()
 	p.pub = nil
 	p.priv = nil
+	p.privMemory = nil
 }
 
 func (k *akeKeys) wipe() {
@@ -30,8 +32,7 @@ func (a *ake) wipe(wipeKeys bool) {
 		return
 	}
 
-	wipeBigInt(a.secretExponent)
-	a.secretExponent = nil
+	a.wipeSecretExponent()
 
 	wipeBigInt(a.ourPublicValue)
 	a.ourPublicValue = nil
@@ -52,6 +53,13 @@ func (a *ake) wipe(wipeKeys bool) {
 	}
 }
 
+func (a *ake) wipeSecretExponent() {
+	wipeBigInt(a.secretExponent)
+	a.secretExponentMemory.Destroy()
+	a.secretExponent = nil
+	a.secretExponentMemory = nil
+}
+
 func (a *ake) wipeGX() {
 	if a == nil {
 		return
@@ -100,7 +108,9 @@ func (c *keyManagementContext) wipe() {
 func (c *keyManagementContext) wipeAndKeepRevealKeys() keyManagementContext {
 	ret := keyManagementContext{}
 	ret.oldMACKeys = make([]macKey, len(c.oldMACKeys))
-	copy(ret.oldMACKeys, c.oldMACKeys)
+	for i, k := range c.oldMACKeys {
+		ret.oldMACKeys[i] = macKey(makeCopy(k))
+	}
 
 	c.wipe()
 
@@ -123,3 +123,180 @@ func Test_macKeyUsage_wipe_HandlesNilWell(t *testing.T) {
 func Test_macKey_wipe_HandlesNilWell(t *testing.T) {
 	(*macKey)(nil).wipe()
 }
+
+func assertBytesWiped(t *testing.T, b []byte) {
+	assertDeepEquals(t, b, zeroes(len(b)))
+}
+
+func assertBigIntWiped(t *testing.T, n *big.Int) {
+	assertEquals(t, n.Sign(), 0)
+}
+
+func Test_wipe_dhKeyPair_wipesBothKeysAndDestroysTheSecretMemory(t *testing.T) {
+	pub := big.NewInt(2)
+	p := newDHKeyPair(big.NewInt(1), pub)
+	priv, mem := p.priv, p.privMemory
+
+	p.wipe()
+
+	assertBigIntWiped(t, pub)
+	assertDeepEquals(t, p, dhKeyPair{})
+	if mem != nil {
+		assertNil(t, mem.Bytes())
+	} else {
+		assertBigIntWiped(t, priv)
+	}
+}
+
+func Test_wipe_akeKeys_wipesAllKeys(t *testing.T) {
+	c, m1, m2 := []byte{1, 2}, []byte{3, 4}, []byte{5, 6}
+	k := akeKeys{c: c, m1: m1, m2: m2}
+
+	k.wipe()
+
+	assertBytesWiped(t, c)
+	assertBytesWiped(t, m1)
+	assertBytesWiped(t, m2)
+	assertDeepEquals(t, k, akeKeys{})
+}
+
+func Test_wipe_ake_wipesEverySecret(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.initAKE()
+	c.setSecretExponent(fixedX())
+	a := c.ake
+	mem := a.secretExponentMemory
+	ourPublic := a.ourPublicValue
+	theirPublic := big.NewInt(7)
+	a.theirPublicValue = theirPublic
+	a.r = [16]byte{1, 2, 3}
+	encryptedGx, xhashedGx := []byte{1, 2}, []byte{3, 4}
+	a.encryptedGx, a.xhashedGx = encryptedGx, xhashedGx
+	revealC, sigM1 := []byte{5, 6}, []byte{7, 8}
+	a.revealKey.c, a.sigKey.m1 = revealC, sigM1
+	keysPub := big.NewInt(9)
+	a.keys.ourCurrentDHKeys.pub = keysPub
+
+	a.wipe(true)
+
+	assertNil(t, mem.Bytes())
+	assertNil(t, a.secretExponent)
+	assertNil(t, a.secretExponentMemory)
+	assertBigIntWiped(t, ourPublic)
+	assertNil(t, a.ourPublicValue)
+	assertBigIntWiped(t, theirPublic)
+	assertNil(t, a.theirPublicValue)
+	assertDeepEquals(t, a.r, [16]byte{})
+	assertBytesWiped(t, encryptedGx)
+	assertBytesWiped(t, xhashedGx)
+	assertNil(t, a.encryptedGx)
+	assertNil(t, a.xhashedGx)
+	assertBytesWiped(t, revealC)
+	assertBytesWiped(t, sigM1)
+	assertDeepEquals(t, a.revealKey, akeKeys{})
+	assertDeepEquals(t, a.sigKey, akeKeys{})
+	assertBigIntWiped(t, keysPub)
+	assertDeepEquals(t, a.keys, keyManagementContext{})
+}
+
+func Test_wipe_ake_keepsTheKeysIfAskedTo(t *testing.T) {
+	keysPub := big.NewInt(9)
+	a := &ake{}
+	a.keys.ourCurrentDHKeys.pub = keysPub
+
+	a.wipe(false)
+
+	assertEquals(t, keysPub.Cmp(big.NewInt(9)), 0)
+	assertDeepEquals(t, a.keys, keyManagementContext{})
+}
+
+func Test_wipe_keyManagementContext_wipesTheUnderlyingValues(t *testing.T) {
+	current := newDHKeyPair(big.NewInt(1), big.NewInt(2))
+	previous := newDHKeyPair(big.NewInt(3), big.NewInt(4))
+	theirCurrent, theirPrevious := big.NewInt(5), big.NewInt(6)
+	counter := &keyPairCounter{1, 2, 3, 4}
+	receivingKey := macKey{1, 2, 3, 4}
+	oldKey := macKey{5, 6, 7, 8}
+
+	keys := keyManagementContext{
+		ourKeyID:              2,
+		theirKeyID:            3,
+		ourCurrentDHKeys:      current,
+		ourPreviousDHKeys:     previous,
+		theirCurrentDHPubKey:  theirCurrent,
+		theirPreviousDHPubKey: theirPrevious,
+		counterHistory:        counterHistory{counters: []*keyPairCounter{counter}},
+		macKeyHistory:         macKeyHistory{items: []macKeyUsage{{ourKeyID: 2, theirKeyID: 3, receivingKey: receivingKey}}},
+		oldMACKeys:            []macKey{oldKey},
+	}
+
+	keys.wipe()
+
+	assertNil(t, current.privMemory.Bytes())
+	assertNil(t, previous.privMemory.Bytes())
+	assertBigIntWiped(t, current.pub)
+	assertBigIntWiped(t, previous.pub)
+	assertBigIntWiped(t, theirCurrent)
+	assertBigIntWiped(t, theirPrevious)
+	assertDeepEquals(t, *counter, keyPairCounter{})
+	assertBytesWiped(t, receivingKey)
+	assertBytesWiped(t, oldKey)
+	assertDeepEquals(t, keys, keyManagementContext{})
+}
+
+func Test_wipeAndKeepRevealKeys_returnsACopyOfTheOldMACKeys(t *testing.T) {
+	oldKey := macKey{5, 6, 7, 8}
+	keys := keyManagementContext{
+		ourKeyID:   2,
+		oldMACKeys: []macKey{oldKey},
+	}
+
+	ret := keys.wipeAndKeepRevealKeys()
+
+	assertDeepEquals(t, keys, keyManagementContext{})
+	assertDeepEquals(t, ret, keyManagementContext{oldMACKeys: []macKey{macKey{5, 6, 7, 8}}})
+}
+
+func Test_wipe_macKeyUsage_wipesTheReceivingKey(t *testing.T) {
+	k := macKey{1, 2, 3}
+	u := macKeyUsage{ourKeyID: 1, theirKeyID: 2, receivingKey: k}
+
+	u.wipe()
+
+	assertBytesWiped(t, k)
+	assertDeepEquals(t, u.receivingKey, macKey{})
+}
+
+func Test_wipe_SMP_destroysTheSecret(t *testing.T) {
+	sm := NewSMP(SMPConfig{})
+	sm.setSecret(big.NewInt(42))
+	mem := sm.secretMemory
+
+	sm.wipe()
+
+	assertNil(t, mem.Bytes())
+	assertNil(t, sm.secret)
+	assertNil(t, sm.secretMemory)
+}
+
+func Test_wipe_DSAPrivateKey_Destroy_destroysTheSecretMemory(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	mem := priv.xMemory
+
+	priv.Destroy()
+
+	assertNil(t, mem.Bytes())
+	assertNil(t, priv.X)
+	assertNil(t, priv.xMemory)
+}
+
+func Test_sessionKeys_destroy_wipesAllKeys(t *testing.T) {
+	keys := calculateDHSessionKeys(fixedX(), fixedGX(), fixedGY(), otrV3{})
+	mem := keys.memory
+
+	keys.destroy()
+
+	assertNil(t, mem.Bytes())
+	assertDeepEquals(t, keys, sessionKeys{})
+}